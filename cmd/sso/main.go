@@ -24,24 +24,53 @@ func main() {
 		slog.Any("cfg", cfg),
 	)
 
-	application := app.New(
-		log,
-		cfg.GRPC.Port,
-		cfg.StoragePath,
-		cfg.TokenTTL,
-	)
+	application := app.New(log, cfg)
 
 	go func() {
 		application.GRPCApp.MustRun()
 	}()
 
+	go func() {
+		application.HTTPApp.MustRun()
+	}()
+
+	go application.Keys.Run()
+	go application.Cleaner.Run()
+	go application.Health.Run()
+
+	// Приложения меняются прямо в хранилище, SIGHUP сбрасывает их кэш, не дожидаясь ttl
+	if application.AppCache != nil {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		go func() {
+			for range reload {
+				application.AppCache.Purge()
+				log.Info("app cache purged")
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
+	application.Health.Stop()
+	application.Cleaner.Stop()
+	application.Keys.Stop()
+	application.HTTPApp.Stop()
 	application.GRPCApp.Stop()
+	if err := application.Storage.Stop(); err != nil {
+		log.Error("failed to close storage", prettyhandler.Err(err))
+	}
+	if application.AppCache != nil {
+		stats := application.AppCache.Stats()
+		log.Info("app cache stats",
+			slog.Uint64("hits", stats.Hits),
+			slog.Uint64("misses", stats.Misses),
+		)
+	}
 	log.Info("Gracefully stopped")
 	// app init
 
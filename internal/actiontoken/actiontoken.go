@@ -0,0 +1,141 @@
+// Package actiontoken signs short-lived tokens for links in emails (подтверждение email и т.п.).
+// Токен - base64url(payload).base64url(HMAC-SHA256), в хранилище не сохраняется.
+// Одноразовость обеспечивает действие: например, email подтверждается, только пока он ещё не подтверждён
+package actiontoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Назначения токенов: токен одного назначения не принимается для другого
+const (
+	PurposeVerifyEmail = "verify_email"
+	PurposeChangeEmail = "change_email"
+)
+
+const nonceSize = 8
+
+var (
+	ErrInvalid = errors.New("invalid action token")
+	ErrExpired = errors.New("action token expired")
+)
+
+// Claims - содержимое токена
+type Claims struct {
+	Purpose string
+	UserID  uint32
+	Email   string
+	// Для смены email - адрес до смены, токен действует, пока он не изменился
+	OldEmail string
+	// Для смены email - отпечаток пароля при выдаче, токен действует, пока пароль не сменили
+	Stamp string
+	// Задаётся Sign
+	ExpiresAt time.Time
+}
+
+type payload struct {
+	Purpose string `json:"p"`
+	UserID  uint32 `json:"u"`
+	Email   string `json:"e"`
+	Old     string `json:"o,omitempty"`
+	Stamp   string `json:"s,omitempty"`
+	Exp     int64  `json:"x"`
+	// Случайная часть, чтобы токены, выданные в одну секунду, отличались
+	Nonce []byte `json:"n"`
+}
+
+// Signer signs and verifies tokens with the server secret
+type Signer struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func New(secret []byte) (*Signer, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("actiontoken: secret must be at least 16 bytes")
+	}
+
+	return &Signer{
+		secret: secret,
+		now:    time.Now,
+	}, nil
+}
+
+// Sign returns token with the claims, valid for ttl
+func (s *Signer) Sign(claims Claims, ttl time.Duration) (string, error) {
+	const op = "actiontoken.Sign"
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	data, err := json.Marshal(payload{
+		Purpose: claims.Purpose,
+		UserID:  claims.UserID,
+		Email:   claims.Email,
+		Old:     claims.OldEmail,
+		Stamp:   claims.Stamp,
+		Exp:     s.now().Add(ttl).Unix(),
+		Nonce:   nonce,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Verify checks signature, purpose and expiration of the token
+func (s *Signer) Verify(token string, purpose string) (Claims, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Claims{}, ErrInvalid
+	}
+
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, s.sign(encoded)) {
+		return Claims{}, ErrInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Claims{}, ErrInvalid
+	}
+	if p.Purpose != purpose {
+		return Claims{}, ErrInvalid
+	}
+
+	expiresAt := time.Unix(p.Exp, 0)
+	if !s.now().Before(expiresAt) {
+		return Claims{}, ErrExpired
+	}
+
+	return Claims{
+		Purpose:   p.Purpose,
+		UserID:    p.UserID,
+		Email:     p.Email,
+		OldEmail:  p.Old,
+		Stamp:     p.Stamp,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func (s *Signer) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
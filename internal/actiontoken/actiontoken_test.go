@@ -0,0 +1,139 @@
+package actiontoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("0123456789abcdef0123456789abcdef")
+	testClaims = Claims{Purpose: PurposeVerifyEmail, UserID: 42, Email: "user@example.com"}
+)
+
+func newSigner(t *testing.T, secret []byte) *Signer {
+	t.Helper()
+
+	s, err := New(secret)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func TestSignVerify(t *testing.T) {
+	s := newSigner(t, testSecret)
+
+	token, err := s.Sign(testClaims, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	claims, err := s.Verify(token, PurposeVerifyEmail)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.UserID != 42 || claims.Email != "user@example.com" || claims.Purpose != PurposeVerifyEmail {
+		t.Errorf("Claims = %+v, want user 42, user@example.com", claims)
+	}
+
+	other, err := s.Sign(testClaims, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if other == token {
+		t.Error("tokens signed at the same time are equal")
+	}
+}
+
+func TestOldEmail(t *testing.T) {
+	s := newSigner(t, testSecret)
+
+	token, err := s.Sign(Claims{
+		Purpose:  PurposeChangeEmail,
+		UserID:   42,
+		Email:    "new@example.com",
+		OldEmail: "user@example.com",
+		Stamp:    "stamp",
+	}, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	claims, err := s.Verify(token, PurposeChangeEmail)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Email != "new@example.com" || claims.OldEmail != "user@example.com" || claims.Stamp != "stamp" {
+		t.Errorf("Claims = %+v, want new@example.com from user@example.com with stamp", claims)
+	}
+	if _, err := s.Verify(token, PurposeVerifyEmail); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Verify as verify_email: err = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s := newSigner(t, testSecret)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	token, err := s.Sign(testClaims, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	now = now.Add(time.Hour - time.Second)
+	if _, err := s.Verify(token, PurposeVerifyEmail); err != nil {
+		t.Fatalf("Verify before expiration: %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := s.Verify(token, PurposeVerifyEmail); !errors.Is(err, ErrExpired) {
+		t.Errorf("Verify: err = %v, want %v", err, ErrExpired)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	s := newSigner(t, testSecret)
+
+	token, err := s.Sign(testClaims, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	payload, sig, _ := strings.Cut(token, ".")
+
+	otherSigner := newSigner(t, []byte("another secret of the other server"))
+	otherToken, err := otherSigner.Sign(testClaims, time.Hour)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	otherPayload, _, _ := strings.Cut(otherToken, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+	}{
+		{"empty", "", PurposeVerifyEmail},
+		{"no signature", payload, PurposeVerifyEmail},
+		{"other purpose", token, "reset_password"},
+		{"other secret", otherToken, PurposeVerifyEmail},
+		{"changed payload", otherPayload + "." + sig, PurposeVerifyEmail},
+		{"bad base64", payload + ".!!!", PurposeVerifyEmail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Verify(tt.token, tt.purpose); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Verify: err = %v, want %v", err, ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestShortSecret(t *testing.T) {
+	if _, err := New([]byte("short")); err == nil {
+		t.Error("New with short secret: err = nil")
+	}
+}
@@ -1,36 +1,470 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"expvar"
+	"fmt"
+	"grpc_service/internal/actiontoken"
 	"grpc_service/internal/app/grpcapp"
+	"grpc_service/internal/app/httpapp"
+	"grpc_service/internal/certs"
+	"grpc_service/internal/config"
+	"grpc_service/internal/db/appcache"
+	"grpc_service/internal/db/memory"
 	"grpc_service/internal/db/pg"
+	"grpc_service/internal/db/sqlite"
+	"grpc_service/internal/entities"
+	"grpc_service/internal/http/gateway"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/mailer"
+	"grpc_service/internal/notify"
+	"grpc_service/internal/passhash"
+	"grpc_service/internal/passpolicy"
 	"grpc_service/internal/services/auth"
+	"grpc_service/internal/services/cleanup"
+	"grpc_service/internal/services/health"
+	"grpc_service/internal/services/keys"
+	"grpc_service/internal/services/limiter"
 	"log/slog"
-	"time"
+	"net/http"
+	"os"
+	"strings"
 )
 
 type App struct {
 	GRPCApp *grpcapp.App
+	HTTPApp *httpapp.App
+	Keys    *keys.Manager
+	Cleaner *cleanup.Cleaner
+	Health  *health.Checker
+	Storage Storage
+	// Кэш приложений: Purge по SIGHUP, Stats для метрик
+	// nil, если кэш выключен
+	AppCache *appcache.Cache
+}
+
+// Storage - всё, что нужно сервисам от хранилища
+type Storage interface {
+	auth.UserSaver
+	auth.UserProvider
+	auth.AppProvider
+	auth.RoleSaver
+	auth.TokenStorage
+	auth.Transactor
+	auth.AuditLog
+	keys.KeyStorage
+	limiter.Storage
+	cleanup.Storage
+	health.Pinger
+	Stop() error
 }
 
 func New(
 	log *slog.Logger,
-	gRPCPort int,
-	storagePath string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
 	//init storage
-	db, err := pg.New(storagePath)
+	db, err := newStorage(log, cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// Токены, подписанные старым ключом, должны проверяться до истечения их TTL
+	keysOverlap := max(cfg.Keys.Overlap, cfg.TokenTTL)
+	keysEncryptionKey, err := keysEncryptionKey(log, cfg.Env, cfg.Keys.EncryptionKey)
+	if err != nil {
+		panic(err)
+	}
+	keyManager, err := keys.New(
+		log,
+		db,
+		cfg.Keys.RotationPeriod,
+		keysOverlap,
+		cfg.Keys.CheckInterval,
+		cfg.Keys.PerApp,
+		keysEncryptionKey,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	tokenParams := jwt.Params{
+		Issuer:        cfg.JWT.Issuer,
+		TTL:           cfg.TokenTTL,
+		LegacyClaims:  cfg.JWT.LegacyClaims,
+		MaxAccessSize: cfg.JWT.MaxAccessClaimsSize,
+	}
+
+	var (
+		appProvider auth.AppProvider = db
+		appCache    *appcache.Cache
+	)
+	if cfg.AppCache.TTL > 0 {
+		appCache = appcache.New(db, cfg.AppCache.TTL, cfg.AppCache.MaxSize)
+		appProvider = appCache
+		expvar.Publish("app_cache", expvar.Func(func() any {
+			return appCache.Stats()
+		}))
+	}
+
+	hasher, err := passwordHasher(cfg.Password)
+	if err != nil {
+		panic(err)
+	}
+
+	policy, err := passpolicy.New(passpolicy.Rules{
+		MinLength:     cfg.PasswordPolicy.MinLength,
+		MaxLength:     cfg.PasswordPolicy.MaxLength,
+		RequireUpper:  cfg.PasswordPolicy.RequireUpper,
+		RequireLower:  cfg.PasswordPolicy.RequireLower,
+		RequireDigit:  cfg.PasswordPolicy.RequireDigit,
+		RequireSymbol: cfg.PasswordPolicy.RequireSymbol,
+		RejectEmail:   cfg.PasswordPolicy.RejectEmail,
+		BreachedFile:  cfg.PasswordPolicy.BreachedFile,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	loginLimiter, err := newLoginLimiter(log, db, cfg.LoginLimit, "")
+	if err != nil {
+		panic(err)
+	}
+	// Счётчики сброса пароля отдельно от входов: запросы сброса не должны блокировать вход
+	resetLimiter, err := newLoginLimiter(log, db, cfg.PasswordReset.Limit, "reset:")
+	if err != nil {
+		panic(err)
+	}
+
+	sender, err := newMailer(log, cfg.Mail)
+	if err != nil {
+		panic(err)
+	}
+	notifier := notify.New(sender, cfg.Mail.From)
 
+	actionTokens, err := newActionTokens(log, cfg.Env, cfg.EmailVerification)
 	if err != nil {
 		panic(err)
 	}
+	authService := auth.New(log, auth.Deps{
+		UserSaver:      db,
+		UserProvider:   db,
+		AppProvider:    appProvider,
+		RoleSaver:      db,
+		TokenStorage:   db,
+		Transactor:     db,
+		KeyProvider:    keyManager,
+		Hasher:         hasher,
+		PasswordPolicy: policy,
+		LoginLimiter:   loginLimiter,
+		Notifier:       notifier,
+		ActionTokens:   actionTokens,
+		Audit:          db,
+		ResetLimiter:   resetLimiter,
+	}, auth.Options{
+		Verification: auth.LinkParams{
+			URL: cfg.EmailVerification.URL,
+			TTL: cfg.EmailVerification.TTL,
+		},
+		PasswordReset: auth.LinkParams{
+			URL: cfg.PasswordReset.URL,
+			TTL: cfg.PasswordReset.TTL,
+		},
+		EmailChange: auth.LinkParams{
+			URL: cfg.EmailChange.URL,
+			TTL: cfg.EmailChange.TTL,
+		},
+		TokenParams:       tokenParams,
+		RefreshTokenTTL:   cfg.RefreshTokenTTL,
+		HideExistingUsers: cfg.Registration.HideExisting,
+		MaxPendingNotices: cfg.Mail.MaxPending,
+	})
+
+	cleaner := cleanup.New(log, db, cfg.CleanupInterval)
+
+	tlsConfig, err := grpcTLS(log, cfg.GRPC)
+	if err != nil {
+		panic(err)
+	}
+
+	gRPCApp := grpcapp.New(log, authService, authService, cfg.GRPC, tlsConfig)
+	healthChecker := health.New(log, db, gRPCApp, cfg.HealthCheckInterval)
+
+	var restGateway http.Handler
+	if cfg.HTTP.Gateway {
+		conn, err := gRPCApp.LocalConn()
+		if err != nil {
+			panic(err)
+		}
+		restGateway, err = gateway.New(context.Background(), conn)
+		if err != nil {
+			panic(err)
+		}
+	}
 
-	authService := auth.New(log, db, db, db, tokenTTL)
+	httpTLSConfig, err := httpTLS(log, cfg)
+	if err != nil {
+		panic(err)
+	}
 
-	gRPCApp := grpcapp.New(log, authService, gRPCPort)
+	httpApp := httpapp.New(log, keyManager, restGateway, cfg.HTTP.DebugVars, cfg.HTTP.Port, cfg.HTTP.Timeout, httpTLSConfig)
 
 	//init auth service
 	return &App{
-		GRPCApp: gRPCApp,
+		GRPCApp:  gRPCApp,
+		HTTPApp:  httpApp,
+		Keys:     keyManager,
+		Cleaner:  cleaner,
+		Health:   healthChecker,
+		Storage:  db,
+		AppCache: appCache,
+	}
+}
+
+// grpcTLS returns TLS config of the gRPC server or nil if TLS is disabled
+func grpcTLS(log *slog.Logger, cfg config.GRPCConfig) (*tls.Config, error) {
+	const op = "app.grpcTLS"
+
+	if !cfg.TLS.Enabled {
+		// Без mTLS нельзя проверить сервис, метод оказался бы недоступен всем
+		if len(cfg.ServiceMethods) > 0 {
+			return nil, fmt.Errorf("%s: service_methods require tls with client certificates", op)
+		}
+		return nil, nil
+	}
+
+	clientAuth, err := certs.ParseClientAuth(cfg.TLS.ClientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(cfg.ServiceMethods) > 0 && clientAuth == tls.NoClientCert {
+		return nil, fmt.Errorf("%s: service_methods require client_auth %q or %q",
+			op, certs.ClientAuthRequest, certs.ClientAuthRequireAndVerify)
+	}
+
+	reloader, err := certs.New(
+		log,
+		cfg.TLS.CertFile,
+		cfg.TLS.KeyFile,
+		cfg.TLS.ClientCAFile,
+		clientAuth,
+		cfg.TLS.ReloadInterval,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reloader.TLSConfig(), nil
+}
+
+// httpTLS returns TLS config of the HTTP server or nil if TLS is disabled
+// Gateway без TLS при включённом grpc.tls открыл бы тот же API в открытом виде, такой конфиг не запускается
+func httpTLS(log *slog.Logger, cfg *config.Config) (*tls.Config, error) {
+	const op = "app.httpTLS"
+
+	if !cfg.HTTP.TLS.Enabled {
+		if cfg.HTTP.Gateway && cfg.GRPC.TLS.Enabled {
+			return nil, fmt.Errorf("%s: http.gateway with grpc.tls requires http.tls, otherwise the API is served over plain HTTP", op)
+		}
+		return nil, nil
+	}
+
+	clientAuth, err := certs.ParseClientAuth(cfg.HTTP.TLS.ClientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	reloader, err := certs.New(
+		log,
+		cfg.HTTP.TLS.CertFile,
+		cfg.HTTP.TLS.KeyFile,
+		cfg.HTTP.TLS.ClientCAFile,
+		clientAuth,
+		cfg.HTTP.TLS.ReloadInterval,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reloader.TLSConfig(), nil
+}
+
+// passwordHasher returns hasher of new passwords
+// Pepper из файла важнее pepper из конфига или env
+func passwordHasher(cfg config.PasswordConfig) (*passhash.Hasher, error) {
+	const op = "app.passwordHasher"
+
+	pepper := []byte(cfg.Pepper)
+	if cfg.PepperFile != "" {
+		data, err := os.ReadFile(cfg.PepperFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		pepper = bytes.TrimSpace(data)
+		if len(pepper) == 0 {
+			return nil, fmt.Errorf("%s: pepper file %s is empty", op, cfg.PepperFile)
+		}
+	}
+
+	hasher, err := passhash.New(passhash.Params{
+		Algorithm:     cfg.Algorithm,
+		BcryptCost:    cfg.BcryptCost,
+		Argon2Memory:  cfg.Argon2Memory,
+		Argon2Time:    cfg.Argon2Time,
+		Argon2Threads: cfg.Argon2Threads,
+		Pepper:        pepper,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hasher, nil
+}
+
+// newLoginLimiter returns limiter with counters in the process or in the storage
+// keyPrefix отделяет счётчики разных лимитеров в общем хранилище
+func newLoginLimiter(log *slog.Logger, db Storage, cfg config.LoginLimitConfig, keyPrefix string) (*limiter.Limiter, error) {
+	const op = "app.newLoginLimiter"
+
+	var storage limiter.Storage
+	switch cfg.Storage {
+	case "memory":
+		storage = limiter.NewMemoryStorage()
+	case "storage":
+		storage = db
+	default:
+		return nil, fmt.Errorf("%s: unknown login limit storage %q", op, cfg.Storage)
+	}
+
+	rules := func(r config.LoginLimitRules) limiter.Rules {
+		return limiter.Rules{
+			BackoffAfter:    r.BackoffAfter,
+			LockoutAfter:    r.LockoutAfter,
+			LockoutDuration: r.LockoutDuration,
+		}
+	}
+
+	return limiter.New(log, storage, limiter.Config{
+		Enabled:   cfg.Enabled,
+		Email:     rules(cfg.Email),
+		IP:        rules(cfg.IP),
+		BaseDelay: cfg.BaseDelay,
+		MaxDelay:  cfg.MaxDelay,
+		Window:    cfg.Window,
+		KeyPrefix: keyPrefix,
+	}), nil
+}
+
+// newMailer returns sender of emails selected by mail.sender
+func newMailer(log *slog.Logger, cfg config.MailConfig) (notify.Mailer, error) {
+	const op = "app.newMailer"
+
+	switch cfg.Sender {
+	case "log":
+		return mailer.NewLog(log), nil
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("%s: mail.smtp.host is required", op)
+		}
+		return mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			Timeout:  cfg.SMTP.Timeout,
+		}), nil
+	case "spool":
+		if cfg.SpoolDir == "" {
+			return nil, fmt.Errorf("%s: mail.spool_dir is required", op)
+		}
+		spool, err := mailer.NewSpool(cfg.SpoolDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return spool, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown mail sender %q", op, cfg.Sender)
+	}
+}
+
+// newActionTokens returns signer of links in emails
+// Без секрета ключ случайный: ссылки не переживут перезапуск и не подходят для нескольких реплик,
+// поэтому так можно только локально
+func newActionTokens(log *slog.Logger, env string, cfg config.EmailVerificationConfig) (*actiontoken.Signer, error) {
+	const op = "app.newActionTokens"
+
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		if env != entities.EnvLocal {
+			return nil, fmt.Errorf("%s: email_verification.secret is required in %s env", op, env)
+		}
+		log.Warn("email_verification.secret is not set, using random key")
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	signer, err := actiontoken.New(secret)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return signer, nil
+}
+
+// keysEncryptionKey decodes keys.encryption_key, empty key is allowed but reported outside local env
+func keysEncryptionKey(log *slog.Logger, env string, encoded string) ([]byte, error) {
+	const op = "app.keysEncryptionKey"
+
+	if encoded == "" {
+		if env != entities.EnvLocal {
+			log.Warn("keys.encryption_key is not set, private signing keys are stored unencrypted")
+		}
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: keys.encryption_key must be base64: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// newStorage creates storage selected by the storage_path scheme
+func newStorage(log *slog.Logger, cfg *config.Config) (Storage, error) {
+	const op = "app.newStorage"
+
+	scheme, rest, ok := strings.Cut(cfg.StoragePath, "://")
+	if !ok {
+		return nil, fmt.Errorf("%s: storage_path must start with postgres://, sqlite:// or memory://", op)
 	}
+
+	switch scheme {
+	case "postgres", "postgresql":
+		// DSN передаётся целиком, схему pgx понимает сам
+		return pg.New(log, cfg.StoragePath, cfg.Postgres)
+	case "sqlite":
+		if rest == "" {
+			return nil, fmt.Errorf("%s: sqlite:// requires a file path", op)
+		}
+		return sqlite.New(rest)
+	case "memory":
+		db := memory.New()
+		if cfg.StorageSeed != "" {
+			if err := db.Seed(context.Background(), cfg.StorageSeed); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+		log.Warn("using in-memory storage, data will be lost on restart")
+		return db, nil
+	}
+
+	return nil, fmt.Errorf("%s: unknown storage scheme %q", op, scheme)
 }
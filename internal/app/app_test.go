@@ -0,0 +1,40 @@
+package app
+
+import (
+	"grpc_service/internal/config"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// Gateway без http.tls при включённом grpc.tls открыл бы gRPC API по открытому HTTP
+func TestHTTPTLSRequiredForGateway(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		name    string
+		gateway bool
+		grpcTLS bool
+		wantErr bool
+	}{
+		{"gateway with grpc tls", true, true, true},
+		{"gateway without grpc tls", true, false, false},
+		{"no gateway", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.HTTP.Gateway = tt.gateway
+			cfg.GRPC.TLS.Enabled = tt.grpcTLS
+
+			tlsConfig, err := httpTLS(log, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("httpTLS err = %v, want error %v", err, tt.wantErr)
+			}
+			if tlsConfig != nil {
+				t.Errorf("tls config without http.tls")
+			}
+		})
+	}
+}
@@ -1,34 +1,169 @@
 package grpcapp
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"grpc_service/internal/config"
 	authgrpc "grpc_service/internal/grpc/auth"
+	"grpc_service/internal/grpc/interceptors"
+	"grpc_service/internal/slogger"
+	ssov1 "grpc_service/protos/gen/go/sso"
 	"log/slog"
 	"net"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionalphapb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
 )
 
+const localBufferSize = 1 << 20
+
 type App struct {
-	log        *slog.Logger
-	gRPCServer *grpc.Server
-	port       int // по нему приходят gRPC сообщения
+	log          *slog.Logger
+	gRPCServer   *grpc.Server
+	healthServer *health.Server
+	port         int // по нему приходят gRPC сообщения
+	tls          bool
+
+	// Тот же сервис без TLS внутри процесса, для REST gateway
+	// Запросы проходят те же interceptor'ы, что и сетевые
+	localServer   *grpc.Server
+	localListener *bufconn.Listener
+	localConn     *grpc.ClientConn
 }
 
 // Creates new gRPC server app
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
-	port int,
+	tokenVerifier interceptors.TokenVerifier,
+	cfg config.GRPCConfig,
+	tlsConfig *tls.Config, // nil - без TLS
 ) *App {
-	gRPCServer := grpc.NewServer()
-	authgrpc.Register(gRPCServer, authService)
+	var (
+		requestID = interceptors.NewRequestID(log)
+		accessLog = interceptors.NewAccessLog(log)
+		recovery  = interceptors.NewRecovery(log)
+		auth      = interceptors.NewAuth(log, tokenVerifier, policies(cfg.ServiceMethods), cfg.ServiceIdentities)
+	)
+
+	if err := authgrpc.CheckServiceMethods(cfg.ServiceMethods); err != nil {
+		panic(err)
+	}
+
+	trustedProxies, err := interceptors.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+
+	// Порядок важен: request_id нужен всем, access log видит код после recovery,
+	// а recovery ловит панику и в проверке токена
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			requestID.Unary(),
+			accessLog.Unary(),
+			recovery.Unary(),
+			auth.Unary(),
+		),
+		grpc.ChainStreamInterceptor(
+			requestID.Stream(),
+			accessLog.Stream(),
+			recovery.Stream(),
+			auth.Stream(),
+		),
+	}
+
+	localServer := grpc.NewServer(opts...)
+	authgrpc.Register(localServer, authService, trustedProxies)
+
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	gRPCServer := grpc.NewServer(opts...)
+	authgrpc.Register(gRPCServer, authService, trustedProxies)
+
+	// Пока хранилище не проверено, сервис считается не готовым
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(ssov1.Auth_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(gRPCServer, healthServer)
+
+	// Для grpcurl и подобных, в prod лучше выключать
+	if cfg.Reflection {
+		reflection.Register(gRPCServer)
+	}
 
 	return &App{
-		log:        log,
-		gRPCServer: gRPCServer,
-		port:       port,
+		log:           log,
+		gRPCServer:    gRPCServer,
+		healthServer:  healthServer,
+		port:          cfg.Port,
+		tls:           tlsConfig != nil,
+		localServer:   localServer,
+		localListener: bufconn.Listen(localBufferSize),
+	}
+}
+
+// LocalConn returns in-process connection to the server
+// Соединение одно на App и закрывается в Stop
+func (a *App) LocalConn() (*grpc.ClientConn, error) {
+	const op = "grpcapp.LocalConn"
+
+	if a.localConn != nil {
+		return a.localConn, nil
+	}
+
+	conn, err := grpc.NewClient(
+		"passthrough:///local",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return a.localListener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+
+	a.localConn = conn
+	return conn, nil
+}
+
+// policies returns policies of all registered services
+// Health и reflection доступны без токена: их вызывают оркестратор и grpcurl
+// serviceMethods доступны только сервисам по mTLS
+func policies(serviceMethods []string) interceptors.Policies {
+	policies := interceptors.Policies{
+		healthpb.Health_Check_FullMethodName:                                   interceptors.PolicyPublic,
+		healthpb.Health_Watch_FullMethodName:                                   interceptors.PolicyPublic,
+		reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName:      interceptors.PolicyPublic,
+		reflectionalphapb.ServerReflection_ServerReflectionInfo_FullMethodName: interceptors.PolicyPublic,
+	}
+	for method, policy := range authgrpc.Policies {
+		policies[method] = policy
+	}
+	for _, method := range serviceMethods {
+		policies[method] = interceptors.PolicyService
+	}
+	return policies
+}
+
+// SetServing sets health status of the server and the Auth service
+func (a *App) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	a.healthServer.SetServingStatus("", status)
+	a.healthServer.SetServingStatus(ssov1.Auth_ServiceDesc.ServiceName, status)
 }
 
 func (a *App) MustRun() {
@@ -50,7 +185,16 @@ func (a *App) Run() error {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("gRPC server is running", slog.String("addr", l.Addr().String()))
+	go func() {
+		if err := a.localServer.Serve(a.localListener); err != nil {
+			log.Error("local gRPC server stopped", slogger.Err(err))
+		}
+	}()
+
+	log.Info("gRPC server is running",
+		slog.String("addr", l.Addr().String()),
+		slog.Bool("tls", a.tls),
+	)
 
 	if err := a.gRPCServer.Serve(l); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -66,5 +210,14 @@ func (a *App) Stop() {
 		slog.String("op", op),
 		slog.Int("port", a.port),
 	).Info("stopping gRPC server", slog.Int("port", a.port))
+
+	// NOT_SERVING до конца работы: балансировщик перестаёт слать запросы,
+	// пока GracefulStop дожидается текущих
+	a.healthServer.Shutdown()
 	a.gRPCServer.GracefulStop()
+
+	if a.localConn != nil {
+		a.localConn.Close()
+	}
+	a.localServer.GracefulStop()
 }
@@ -0,0 +1,108 @@
+package httpapp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
+	"fmt"
+	"grpc_service/internal/http/gateway"
+	"grpc_service/internal/http/jwks"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+const shutdownTimeout = 10 * time.Second
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+	tls        bool
+}
+
+// Creates new HTTP server app
+func New(
+	log *slog.Logger,
+	jwksProvider jwks.Provider,
+	restGateway http.Handler, // nil - без REST API
+	debugVars bool, // /debug/vars (expvar)
+	port int,
+	timeout time.Duration,
+	tlsConfig *tls.Config, // nil - без TLS
+) *App {
+	mux := http.NewServeMux()
+	jwks.Register(mux, log, jwksProvider)
+	if restGateway != nil {
+		gateway.Register(mux, restGateway)
+	}
+	if debugVars {
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: timeout,
+			ReadTimeout:       timeout,
+			WriteTimeout:      timeout,
+			TLSConfig:         tlsConfig,
+		},
+		port: port,
+		tls:  tlsConfig != nil,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int("port", a.port),
+	)
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server is running", slog.String("addr", l.Addr().String()), slog.Bool("tls", a.tls))
+
+	if a.tls {
+		// Сертификаты берутся из TLSConfig
+		err = a.httpServer.ServeTLS(l, "", "")
+	} else {
+		err = a.httpServer.Serve(l)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(
+		slog.String("op", op),
+		slog.Int("port", a.port),
+	).Info("stopping HTTP server", slog.Int("port", a.port))
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.log.Error("failed to stop HTTP server", slog.String("op", op), slogger.Err(err))
+	}
+}
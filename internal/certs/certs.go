@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Режимы проверки клиентских сертификатов
+const (
+	ClientAuthNone             = "none"
+	ClientAuthRequest          = "request"            // сертификат не обязателен, но если есть - проверяется
+	ClientAuthRequireAndVerify = "require_and_verify" // mTLS
+)
+
+var ErrUnknownClientAuth = errors.New("unknown client auth mode")
+
+// ParseClientAuth maps client auth mode from config to tls.ClientAuthType
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		// Непроверенный сертификат ничего не доказывает, поэтому VerifyClientCertIfGiven, а не RequestClientCert
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequireAndVerify:
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("%w: %q", ErrUnknownClientAuth, mode)
+}
+
+// Reloader serves certificates from disk and reloads them when files change
+// Файлы проверяются не чаще раза в interval при новых соединениях,
+// уже открытые соединения продолжают работать со старым сертификатом
+type Reloader struct {
+	log          *slog.Logger
+	certFile     string
+	keyFile      string
+	clientCAFile string // пустой, если клиентские сертификаты не проверяются
+	clientAuth   tls.ClientAuthType
+	interval     time.Duration
+
+	mu        sync.Mutex
+	config    *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+// New loads certificates, error is returned if they can't be loaded
+func New(
+	log *slog.Logger,
+	certFile string,
+	keyFile string,
+	clientCAFile string,
+	clientAuth tls.ClientAuthType,
+	interval time.Duration,
+) (*Reloader, error) {
+	const op = "certs.New"
+
+	if clientAuth != tls.NoClientCert && clientCAFile == "" {
+		return nil, fmt.Errorf("%s: client CA file is required to verify client certificates", op)
+	}
+
+	r := &Reloader{
+		log:          log,
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+		clientAuth:   clientAuth,
+		interval:     interval,
+	}
+
+	modTimes, err := r.stat()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	config, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.config = config
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+
+	return r, nil
+}
+
+// TLSConfig returns server config that takes certificates from the reloader on every handshake
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current(), nil
+		},
+	}
+}
+
+// current returns config with the latest certificates
+func (r *Reloader) current() *tls.Config {
+	const op = "certs.Reload"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) < r.interval {
+		return r.config
+	}
+	r.checkedAt = time.Now()
+
+	log := r.log.With(
+		slog.String("op", op),
+		slog.String("cert", r.certFile),
+	)
+
+	modTimes, err := r.stat()
+	if err != nil {
+		log.Error("failed to stat certificates, keeping the old ones", slogger.Err(err))
+		return r.config
+	}
+	if !changed(r.modTimes, modTimes) {
+		return r.config
+	}
+
+	// Файлы могут быть записаны не полностью, тогда попробуем в следующий раз
+	config, err := r.load()
+	if err != nil {
+		log.Error("failed to reload certificates, keeping the old ones", slogger.Err(err))
+		return r.config
+	}
+
+	r.config = config
+	r.modTimes = modTimes
+	log.Info("certificates reloaded")
+
+	return r.config
+}
+
+func (r *Reloader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   r.clientAuth,
+		// gRPC работает поверх HTTP/2, без ALPN клиенты отказываются подключаться
+		// http/1.1 - для REST gateway и JWKS, gRPC клиенты его не предлагают
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", r.clientCAFile)
+		}
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
+
+func (r *Reloader) stat() ([]time.Time, error) {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+
+	modTimes := make([]time.Time, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	return modTimes, nil
+}
+
+func changed(old, new []time.Time) bool {
+	for i := range old {
+		if !old[i].Equal(new[i]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testInterval = 10 * time.Millisecond
+
+// certFiles are paths of the certificate and key in a temp dir
+type certFiles struct {
+	cert, key string
+	// Время изменения файлов сдвигается при каждой записи: точность mtime бывает в секунду
+	modTime time.Time
+}
+
+func newCertFiles(t *testing.T) *certFiles {
+	dir := t.TempDir()
+	return &certFiles{
+		cert:    filepath.Join(dir, "server.crt"),
+		key:     filepath.Join(dir, "server.key"),
+		modTime: time.Now(),
+	}
+}
+
+// writeCert writes a new self-signed certificate with the common name
+func (f *certFiles) writeCert(t *testing.T, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.write(t, f.cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	f.write(t, f.key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+}
+
+func (f *certFiles) write(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f.modTime = f.modTime.Add(time.Second)
+	if err := os.Chtimes(path, f.modTime, f.modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// leaf returns common name of the certificate served to a new connection
+func leaf(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	config, err := r.TLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatalf("GetConfigForClient: %v", err)
+	}
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return cert.Subject.CommonName
+}
+
+func newTestReloader(t *testing.T, files *certFiles) *Reloader {
+	t.Helper()
+
+	r, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), files.cert, files.key, "", 0, testInterval)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return r
+}
+
+func TestReload(t *testing.T) {
+	files := newCertFiles(t)
+	files.writeCert(t, "first")
+	r := newTestReloader(t, files)
+
+	if got := leaf(t, r); got != "first" {
+		t.Fatalf("leaf = %s, want first", got)
+	}
+
+	files.writeCert(t, "second")
+	// До reload_interval файлы не перечитываются
+	if got := leaf(t, r); got != "first" {
+		t.Errorf("leaf before reload_interval = %s, want first", got)
+	}
+
+	time.Sleep(2 * testInterval)
+	if got := leaf(t, r); got != "second" {
+		t.Errorf("leaf after reload_interval = %s, want second", got)
+	}
+}
+
+func TestReloadBrokenFile(t *testing.T) {
+	files := newCertFiles(t)
+	files.writeCert(t, "first")
+	r := newTestReloader(t, files)
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T)
+	}{
+		{"garbage certificate", func(t *testing.T) { files.write(t, files.cert, []byte("not a certificate")) }},
+		{"empty key", func(t *testing.T) { files.write(t, files.key, nil) }},
+		{"deleted key", func(t *testing.T) {
+			if err := os.Remove(files.key); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files.writeCert(t, tt.name)
+			time.Sleep(2 * testInterval)
+			if got := leaf(t, r); got != tt.name {
+				t.Fatalf("leaf = %s, want %s", got, tt.name)
+			}
+
+			tt.corrupt(t)
+			time.Sleep(2 * testInterval)
+			if got := leaf(t, r); got != tt.name {
+				t.Errorf("leaf with broken file = %s, want previous %s", got, tt.name)
+			}
+		})
+	}
+
+	// Файлы дописаны - подхватываются при следующей проверке
+	files.writeCert(t, "fixed")
+	time.Sleep(2 * testInterval)
+	if got := leaf(t, r); got != "fixed" {
+		t.Errorf("leaf after fix = %s, want fixed", got)
+	}
+}
+
+func TestNewBrokenFile(t *testing.T) {
+	files := newCertFiles(t)
+	files.writeCert(t, "first")
+	files.write(t, files.key, []byte("not a key"))
+
+	if _, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), files.cert, files.key, "", 0, testInterval); err == nil {
+		t.Error("New with broken key: err = nil")
+	}
+}
@@ -10,14 +10,212 @@ import (
 
 type Config struct {
 	Env string `yaml:"env" env-default:"local"`
+	// Хранилище выбирается по схеме: postgres://, sqlite://путь или memory://
 	StoragePath string `yaml:"storage_path" env-required:"true"`
+	// YAML с приложениями, ролями и пользователями для memory://
+	StorageSeed string `yaml:"storage_seed"`
+	Postgres PostgresConfig `yaml:"postgres"`
+	AppCache AppCacheConfig `yaml:"app_cache"`
+	Password PasswordConfig `yaml:"password"`
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	LoginLimit LoginLimitConfig `yaml:"login_limit"`
+	Registration RegistrationConfig `yaml:"registration"`
+	Mail MailConfig `yaml:"mail"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	EmailChange EmailChangeConfig `yaml:"email_change"`
 	TokenTTL time.Duration `yaml:"token_ttl" env-required:"true"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// Как часто удалять из хранилища истёкшие токены и записи denylist
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"10m"`
+	// Как часто проверять хранилище для grpc.health.v1
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" env-default:"5s"`
 	GRPC GRPCConfig `yaml:"grpc"`
+	JWT JWTConfig `yaml:"jwt"`
+	HTTP HTTPConfig `yaml:"http"`
+	Keys KeysConfig `yaml:"keys"`
 }
 
 type GRPCConfig struct {
 	Port int `yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
+	// Server reflection для grpcurl, в prod лучше выключать
+	Reflection bool `yaml:"reflection"`
+	TLS TLSConfig `yaml:"tls"`
+	// CN или subject клиентских сертификатов сервисов, которым доступны ServiceMethods
+	ServiceIdentities []string `yaml:"service_identities"`
+	// Методы ("/auth.Auth/RevokeUserTokens"), доступные только сервисам по mTLS
+	ServiceMethods []string `yaml:"service_methods"`
+	// IP или подсети прокси, которым можно верить в x-forwarded-for. REST gateway доверенный всегда
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type TLSConfig struct {
+	Enabled bool `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile string `yaml:"key_file"`
+	// CA для проверки клиентских сертификатов
+	ClientCAFile string `yaml:"client_ca_file"`
+	// none, request, require_and_verify
+	ClientAuth string `yaml:"client_auth" env-default:"none"`
+	// Как часто проверять, не обновились ли файлы сертификатов
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"30s"`
+}
+
+// PostgresConfig - пул соединений для postgres://
+type PostgresConfig struct {
+	MaxConns int32 `yaml:"max_conns" env-default:"10"`
+	MinConns int32 `yaml:"min_conns" env-default:"0"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime" env-default:"1h"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time" env-default:"30m"`
+	// statement_timeout на сервере, 0s - без ограничения. Умолчания в defaults
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// Запросы дольше пишутся в лог с уровнем Warn, 0s - не писать
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+}
+
+// AppCacheConfig - кэш приложений перед хранилищем
+type AppCacheConfig struct {
+	// 0s - без кэша. Умолчания в defaults
+	TTL time.Duration `yaml:"ttl"`
+	// Сколько приложений держать, 0 - без ограничения
+	MaxSize int `yaml:"max_size"`
+}
+
+// PasswordConfig - параметры новых хэшей паролей. Старые хэши пересчитываются при входе
+type PasswordConfig struct {
+	// argon2id или bcrypt
+	Algorithm string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int `yaml:"bcrypt_cost" env-default:"12"`
+	// Память в KiB
+	Argon2Memory uint32 `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Time uint32 `yaml:"argon2_time" env-default:"3"`
+	Argon2Threads uint8 `yaml:"argon2_threads" env-default:"2"`
+	// Секрет сервера, подмешивается в каждый пароль. Лучше задавать через env или файл
+	// json:"-" - конфиг целиком пишется в лог при старте
+	Pepper string `yaml:"pepper" env:"SSO_PASSWORD_PEPPER" json:"-"`
+	PepperFile string `yaml:"pepper_file"`
+}
+
+// PasswordPolicyConfig - требования к новым паролям при регистрации и смене пароля
+type PasswordPolicyConfig struct {
+	// Длина в символах, max_length: 0 - без ограничения (умолчание в defaults)
+	MinLength int `yaml:"min_length" env-default:"8"`
+	MaxLength int `yaml:"max_length"`
+	RequireUpper bool `yaml:"require_upper"`
+	RequireLower bool `yaml:"require_lower"`
+	RequireDigit bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+	// Запрещать пароли, содержащие локальную часть email. Умолчание (true) в defaults
+	RejectEmail bool `yaml:"reject_email"`
+	// Список распространённых и утёкших паролей, по одному в строке
+	BreachedFile string `yaml:"breached_file"`
+}
+
+// LoginLimitConfig - защита от перебора паролей
+type LoginLimitConfig struct {
+	// Умолчания enabled и lockout_after в defaults
+	Enabled bool `yaml:"enabled"`
+	// memory - счётчики в процессе, storage - в хранилище, общие для всех реплик
+	Storage string `yaml:"storage" env-default:"storage"`
+	Email LoginLimitRules `yaml:"email"`
+	IP LoginLimitRules `yaml:"ip"`
+	// Пауза после backoff_after неудачных попыток, дальше удваивается до max_delay
+	BaseDelay time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay time.Duration `yaml:"max_delay" env-default:"5m"`
+	// Неудачные попытки старше забываются
+	Window time.Duration `yaml:"window" env-default:"1h"`
+}
+
+type LoginLimitRules struct {
+	// 0 - пауза с первой неудачной попытки
+	BackoffAfter int `yaml:"backoff_after"`
+	// 0 - не блокировать
+	LockoutAfter int `yaml:"lockout_after"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env-default:"15m"`
+}
+
+type RegistrationConfig struct {
+	// Не сообщать, что email уже занят: Register отвечает одинаково, владельцу email уходит уведомление.
+	// user_id в ответе тогда всегда 0
+	HideExisting bool `yaml:"hide_existing"`
+}
+
+// MailConfig - отправка писем пользователям
+type MailConfig struct {
+	// log - письма пишутся в лог, smtp - отправляются, spool - .eml файлы в spool_dir
+	Sender string `yaml:"sender" env-default:"log"`
+	From string `yaml:"from" env-default:"SSO <no-reply@localhost>"`
+	SMTP SMTPConfig `yaml:"smtp"`
+	SpoolDir string `yaml:"spool_dir"`
+	// Сколько писем одновременно отправляется в фоне, остальные отбрасываются
+	MaxPending int `yaml:"max_pending" env-default:"100"`
+}
+
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int `yaml:"port" env-default:"587"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password" env:"SSO_SMTP_PASSWORD" json:"-"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// EmailVerificationConfig - ссылки подтверждения email
+type EmailVerificationConfig struct {
+	// Ключ подписи ссылок (от 16 байт), общий для всех реплик. Обязателен, кроме env local:
+	// там пустой - случайный при запуске, и ссылки перестают действовать после перезапуска
+	Secret string `yaml:"secret" env:"SSO_EMAIL_VERIFICATION_SECRET" json:"-"`
+	TTL time.Duration `yaml:"ttl" env-default:"24h"`
+	// К URL дописывается токен
+	URL string `yaml:"url" env-default:"http://localhost:8080/verify-email?token="`
+}
+
+// PasswordResetConfig - ссылки сброса пароля. Токены одноразовые и хранятся в виде хэша
+type PasswordResetConfig struct {
+	TTL time.Duration `yaml:"ttl" env-default:"30m"`
+	// К URL дописывается токен
+	URL string `yaml:"url" env-default:"http://localhost:8080/reset-password?token="`
+	// Лимит запросов по email и IP, как login_limit, но каждый запрос считается попыткой. Умолчания в defaults
+	Limit LoginLimitConfig `yaml:"limit"`
+}
+
+// EmailChangeConfig - ссылки подтверждения нового email, подписываются ключом email_verification.secret
+type EmailChangeConfig struct {
+	TTL time.Duration `yaml:"ttl" env-default:"24h"`
+	// К URL дописывается токен
+	URL string `yaml:"url" env-default:"http://localhost:8080/confirm-email-change?token="`
+}
+
+type JWTConfig struct {
+	Issuer string `yaml:"issuer" env-default:"sso"`
+	// Писать в токен userID, appID и ext для старых потребителей
+	LegacyClaims bool `yaml:"legacy_claims"`
+	// Лимит на размер roles и scope в токене (байт), 0 - без ограничения. Умолчание в defaults
+	MaxAccessClaimsSize int `yaml:"max_access_claims_size"`
+}
+
+type HTTPConfig struct {
+	Port int `yaml:"port" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+	// REST/JSON API (/v1/...) и /openapi.json на том же порту. Умолчание (true) в defaults
+	Gateway bool `yaml:"gateway"`
+	// /debug/vars (expvar) со счётчиками кэша приложений, для сбора метрик из внутренней сети
+	DebugVars bool `yaml:"debug_vars"`
+	// TLS порта http.port. Обязателен для gateway при grpc.tls.enabled: иначе gRPC API доступен без TLS
+	TLS TLSConfig `yaml:"tls"`
+}
+
+// KeysConfig - ключи для RS256/EdDSA. Приложения с HS256 подписываются своим секретом
+type KeysConfig struct {
+	RotationPeriod time.Duration `yaml:"rotation_period" env-default:"720h"`
+	// Сколько старый ключ публикуется после ротации, не меньше token_ttl
+	Overlap time.Duration `yaml:"overlap" env-default:"24h"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1m"`
+	// true - у каждого приложения свои ключи, false - общие
+	PerApp bool `yaml:"per_app"`
+	// Ключ шифрования приватных ключей в signing_keys: 32 байта в base64, общий для всех реплик
+	// Пустой - ключи хранятся открытым PKCS #8
+	EncryptionKey string `yaml:"encryption_key" env:"SSO_KEYS_ENCRYPTION_KEY" json:"-"`
 }
 
 func MustLoad() (cfg *Config) {
@@ -30,15 +228,63 @@ func MustLoad() (cfg *Config) {
 		panic("config file does not exist: " + path)
 	}
 
-	cfg = new(Config)
-
-	if err := cleanenv.ReadConfig(path, cfg); err != nil {
+	cfg, err := load(path)
+	if err != nil {
 		panic("failed to read config: " + err.Error())
 	}
 
 	return cfg
 }
 
+func load(path string) (*Config, error) {
+	cfg := defaults()
+
+	if err := cleanenv.ReadConfig(path, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// defaults returns config with default values of fields where zero is a valid setting.
+// cleanenv подставляет env-default и вместо явно заданного нуля, поэтому такие поля
+// заполняются до чтения файла: yaml перезаписывает только заданные в нём ключи
+func defaults() *Config {
+	return &Config{
+		Postgres: PostgresConfig{
+			StatementTimeout:   5 * time.Second,
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		AppCache: AppCacheConfig{
+			TTL:     time.Minute,
+			MaxSize: 1000,
+		},
+		LoginLimit: LoginLimitConfig{
+			Enabled: true,
+			Email:   LoginLimitRules{BackoffAfter: 3, LockoutAfter: 10},
+			IP:      LoginLimitRules{BackoffAfter: 3, LockoutAfter: 10},
+		},
+		PasswordReset: PasswordResetConfig{
+			Limit: LoginLimitConfig{
+				Enabled:   true,
+				Email:     LoginLimitRules{BackoffAfter: 1, LockoutAfter: 5},
+				IP:        LoginLimitRules{BackoffAfter: 10, LockoutAfter: 50},
+				BaseDelay: time.Minute,
+			},
+		},
+		PasswordPolicy: PasswordPolicyConfig{
+			MaxLength:   128,
+			RejectEmail: true,
+		},
+		JWT: JWTConfig{
+			MaxAccessClaimsSize: 1024,
+		},
+		HTTP: HTTPConfig{
+			Gateway: true,
+		},
+	}
+}
+
 // flag > env > default
 // default value is empty string
 func fetchConfigPath() (res string) {
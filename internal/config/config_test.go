@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const requiredYAML = "storage_path: \"memory://\"\ntoken_ttl: 1h\n"
+
+func loadYAML(t *testing.T, data string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(requiredYAML+data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return cfg
+}
+
+// Без ключа в файле - умолчание, явный 0 или false сохраняется
+func TestZeroValues(t *testing.T) {
+	def := loadYAML(t, "")
+	zero := loadYAML(t, `
+postgres:
+  statement_timeout: 0s
+  slow_query_threshold: 0s
+app_cache:
+  ttl: 0s
+  max_size: 0
+login_limit:
+  enabled: false
+  email:
+    backoff_after: 0
+    lockout_after: 0
+  ip:
+    backoff_after: 0
+    lockout_after: 0
+password_reset:
+  limit:
+    enabled: false
+    email:
+      backoff_after: 0
+      lockout_after: 0
+password_policy:
+  max_length: 0
+  reject_email: false
+jwt:
+  max_access_claims_size: 0
+http:
+  gateway: false
+`)
+
+	tests := []struct {
+		name      string
+		def, zero any
+		wantDef   any
+		wantZero  any
+	}{
+		{"postgres.statement_timeout", def.Postgres.StatementTimeout, zero.Postgres.StatementTimeout, 5 * time.Second, time.Duration(0)},
+		{"postgres.slow_query_threshold", def.Postgres.SlowQueryThreshold, zero.Postgres.SlowQueryThreshold, 200 * time.Millisecond, time.Duration(0)},
+		{"app_cache.ttl", def.AppCache.TTL, zero.AppCache.TTL, time.Minute, time.Duration(0)},
+		{"app_cache.max_size", def.AppCache.MaxSize, zero.AppCache.MaxSize, 1000, 0},
+		{"password_policy.max_length", def.PasswordPolicy.MaxLength, zero.PasswordPolicy.MaxLength, 128, 0},
+		{"password_policy.reject_email", def.PasswordPolicy.RejectEmail, zero.PasswordPolicy.RejectEmail, true, false},
+		{"login_limit.enabled", def.LoginLimit.Enabled, zero.LoginLimit.Enabled, true, false},
+		{"login_limit.email.backoff_after", def.LoginLimit.Email.BackoffAfter, zero.LoginLimit.Email.BackoffAfter, 3, 0},
+		{"login_limit.ip.backoff_after", def.LoginLimit.IP.BackoffAfter, zero.LoginLimit.IP.BackoffAfter, 3, 0},
+		{"login_limit.email.lockout_after", def.LoginLimit.Email.LockoutAfter, zero.LoginLimit.Email.LockoutAfter, 10, 0},
+		{"login_limit.ip.lockout_after", def.LoginLimit.IP.LockoutAfter, zero.LoginLimit.IP.LockoutAfter, 10, 0},
+		{"password_reset.limit.enabled", def.PasswordReset.Limit.Enabled, zero.PasswordReset.Limit.Enabled, true, false},
+		{"password_reset.limit.email.backoff_after", def.PasswordReset.Limit.Email.BackoffAfter, zero.PasswordReset.Limit.Email.BackoffAfter, 1, 0},
+		{"password_reset.limit.email.lockout_after", def.PasswordReset.Limit.Email.LockoutAfter, zero.PasswordReset.Limit.Email.LockoutAfter, 5, 0},
+		{"jwt.max_access_claims_size", def.JWT.MaxAccessClaimsSize, zero.JWT.MaxAccessClaimsSize, 1024, 0},
+		{"http.gateway", def.HTTP.Gateway, zero.HTTP.Gateway, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.def != tt.wantDef {
+				t.Errorf("default = %v, want %v", tt.def, tt.wantDef)
+			}
+			if tt.zero != tt.wantZero {
+				t.Errorf("explicit zero = %v, want %v", tt.zero, tt.wantZero)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Package appcache caches apps in front of any storage.
+// Приложения меняются редко, а читаются при каждом Login и проверке токена
+package appcache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type AppProvider interface {
+	App(ctx context.Context, appID uint32) (models.App, error)
+}
+
+// Stats - счётчики для метрик
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// Cache is AppProvider that keeps apps for ttl.
+// At most maxSize apps are kept, least recently used are evicted first.
+// Errors (including ErrAppNotFound) are not cached
+type Cache struct {
+	provider AppProvider
+	ttl      time.Duration
+	maxSize  int
+
+	mu      sync.Mutex
+	entries map[uint32]*list.Element
+	lru     *list.List // в начале - недавно прочитанные
+	// Увеличивается при Purge: загрузка, начатая до него, не попадает в кэш
+	generation uint64
+
+	group  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type entry struct {
+	appID     uint32
+	app       models.App
+	expiresAt time.Time
+}
+
+// New wraps provider. maxSize <= 0 means no limit
+func New(provider AppProvider, ttl time.Duration, maxSize int) *Cache {
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		entries:  make(map[uint32]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// App returns app from the cache or loads it from the provider
+// Одновременные промахи по одному приложению дают один запрос к хранилищу
+func (c *Cache) App(ctx context.Context, appID uint32) (models.App, error) {
+	const op = "appcache.App"
+
+	if app, ok := c.get(appID); ok {
+		c.hits.Add(1)
+		return app, nil
+	}
+	c.misses.Add(1)
+
+	c.mu.Lock()
+	generation := c.generation
+	c.mu.Unlock()
+
+	// ctx первого запроса общий для всех ожидающих: его отмена отменит и их,
+	// это приемлемо, они повторят запрос
+	v, err, _ := c.group.Do(strconv.FormatUint(uint64(appID), 10), func() (interface{}, error) {
+		app, err := c.provider.App(ctx, appID)
+		if err != nil {
+			return models.App{}, err
+		}
+		c.put(appID, app, generation)
+		return app, nil
+	})
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return v.(models.App), nil
+}
+
+// Purge removes all apps from the cache
+// Приложения меняются только в хранилище, в обход сервиса: кэш сбрасывается по ttl или Purge (SIGHUP)
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[uint32]*list.Element)
+	c.lru.Init()
+}
+
+// Stats returns counters since the cache was created
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+func (c *Cache) get(appID uint32) (models.App, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[appID]
+	if !ok {
+		return models.App{}, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, appID)
+		return models.App{}, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e.app, true
+}
+
+func (c *Cache) put(appID uint32, app models.App, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	e := &entry{appID: appID, app: app, expiresAt: time.Now().Add(c.ttl)}
+	if el, ok := c.entries[appID]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[appID] = c.lru.PushFront(e)
+	for c.maxSize > 0 && c.lru.Len() > c.maxSize {
+		c.evictOldest()
+	}
+}
+
+func (c *Cache) evictOldest() {
+	el := c.lru.Back()
+	if el == nil {
+		return
+	}
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*entry).appID)
+}
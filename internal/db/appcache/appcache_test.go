@@ -0,0 +1,213 @@
+package appcache
+
+import (
+	"context"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errNotFound = errors.New("app not found")
+
+// provider counts loads; release blocks them until closed, if set
+type provider struct {
+	loads   atomic.Int32
+	release chan struct{}
+
+	mu   sync.Mutex
+	apps map[uint32]models.App
+}
+
+func newProvider(apps ...models.App) *provider {
+	p := &provider{apps: make(map[uint32]models.App)}
+	for _, app := range apps {
+		p.apps[app.ID] = app
+	}
+	return p
+}
+
+func (p *provider) App(ctx context.Context, appID uint32) (models.App, error) {
+	p.loads.Add(1)
+	if p.release != nil {
+		<-p.release
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	app, ok := p.apps[appID]
+	if !ok {
+		return models.App{}, errNotFound
+	}
+	return app, nil
+}
+
+func (p *provider) set(app models.App) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.apps[app.ID] = app
+}
+
+func TestCache_HitAndMiss(t *testing.T) {
+	p := newProvider(models.App{ID: 1, Secret: "secret"})
+	c := New(p, time.Minute, 10)
+
+	for i := 0; i < 3; i++ {
+		app, err := c.App(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("App: %v", err)
+		}
+		if app.Secret != "secret" {
+			t.Errorf("Secret = %q, want secret", app.Secret)
+		}
+	}
+
+	if loads := p.loads.Load(); loads != 1 {
+		t.Errorf("provider called %d times, want 1", loads)
+	}
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("Stats = %+v, want 2 hits, 1 miss, size 1", stats)
+	}
+}
+
+func TestCache_ErrorsAreNotCached(t *testing.T) {
+	p := newProvider()
+	c := New(p, time.Minute, 10)
+
+	if _, err := c.App(context.Background(), 1); !errors.Is(err, errNotFound) {
+		t.Fatalf("App error = %v, want %v", err, errNotFound)
+	}
+
+	p.set(models.App{ID: 1})
+	if _, err := c.App(context.Background(), 1); err != nil {
+		t.Errorf("App after the app is created: %v", err)
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	p := newProvider(models.App{ID: 1})
+	c := New(p, 10*time.Millisecond, 10)
+
+	c.App(context.Background(), 1)
+	time.Sleep(20 * time.Millisecond)
+	c.App(context.Background(), 1)
+
+	if loads := p.loads.Load(); loads != 2 {
+		t.Errorf("provider called %d times, want 2 after ttl", loads)
+	}
+}
+
+func TestCache_MaxSize(t *testing.T) {
+	p := newProvider(models.App{ID: 1}, models.App{ID: 2}, models.App{ID: 3})
+	c := New(p, time.Minute, 2)
+	ctx := context.Background()
+
+	c.App(ctx, 1)
+	c.App(ctx, 2)
+	c.App(ctx, 1) // 2 становится самым старым
+	c.App(ctx, 3)
+
+	if size := c.Stats().Size; size != 2 {
+		t.Fatalf("Size = %d, want 2", size)
+	}
+
+	p.loads.Store(0)
+	c.App(ctx, 1)
+	c.App(ctx, 3)
+	if loads := p.loads.Load(); loads != 0 {
+		t.Errorf("recently used apps were evicted")
+	}
+	c.App(ctx, 2)
+	if loads := p.loads.Load(); loads != 1 {
+		t.Errorf("least recently used app was not evicted")
+	}
+}
+
+func TestCache_Purge(t *testing.T) {
+	p := newProvider(models.App{ID: 1, Secret: "old"})
+	c := New(p, time.Minute, 10)
+	ctx := context.Background()
+
+	c.App(ctx, 1)
+	p.set(models.App{ID: 1, Secret: "new"})
+	c.Purge()
+
+	app, err := c.App(ctx, 1)
+	if err != nil {
+		t.Fatalf("App: %v", err)
+	}
+	if app.Secret != "new" {
+		t.Errorf("Secret = %q after Purge, want new", app.Secret)
+	}
+}
+
+func TestCache_PurgeDuringLoad(t *testing.T) {
+	p := newProvider(models.App{ID: 1, Secret: "old"})
+	p.release = make(chan struct{})
+	c := New(p, time.Minute, 10)
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.App(ctx, 1)
+	}()
+
+	// Загрузка началась и прочитает старые данные уже после Purge
+	for p.loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Purge()
+	close(p.release)
+	<-done
+
+	p.set(models.App{ID: 1, Secret: "new"})
+	app, err := c.App(ctx, 1)
+	if err != nil {
+		t.Fatalf("App: %v", err)
+	}
+	if app.Secret != "new" {
+		t.Errorf("Secret = %q, stale load was cached after Purge", app.Secret)
+	}
+}
+
+func TestCache_Singleflight(t *testing.T) {
+	p := newProvider(models.App{ID: 1})
+	p.release = make(chan struct{})
+	c := New(p, time.Minute, 10)
+
+	const callers = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.App(context.Background(), 1)
+			errs <- err
+		}()
+	}
+
+	// Ждём, пока все промахнутся, и отпускаем единственную загрузку
+	for c.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	// Между промахом и group.Do есть несколько инструкций
+	time.Sleep(10 * time.Millisecond)
+	close(p.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("App: %v", err)
+		}
+	}
+	if loads := p.loads.Load(); loads != 1 {
+		t.Errorf("provider called %d times for concurrent misses, want 1", loads)
+	}
+}
@@ -3,7 +3,10 @@ package db
 import "errors"
 
 var (
-	ErrUserExists   = errors.New("user already exists")
-	ErrUserNotFound = errors.New("user not found")
-	ErrAppNotFound  = errors.New("app not found")
+	ErrUserExists    = errors.New("user already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrAppNotFound   = errors.New("app not found")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenUsed     = errors.New("token already used")
+	ErrRoleNotFound  = errors.New("role not found")
 )
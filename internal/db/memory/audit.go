@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"grpc_service/internal/domain/models"
+)
+
+// SaveAuditEvent appends the event to the audit log.
+func (db *DB) SaveAuditEvent(
+	ctx context.Context,
+	event models.AuditEvent,
+) error {
+	defer db.lock(ctx)()
+
+	event.ID = int64(len(db.audit)) + 1
+	keep(db, &db.audit)
+	db.audit = append(db.audit, event)
+
+	return nil
+}
+
+// AuditEvents returns events of the user in the order they were saved.
+func (db *DB) AuditEvents(
+	ctx context.Context,
+	userID uint32,
+) ([]models.AuditEvent, error) {
+	defer db.rlock(ctx)()
+
+	var events []models.AuditEvent
+	for _, event := range db.audit {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
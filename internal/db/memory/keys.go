@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// SaveSigningKey saves the key pair.
+func (db *DB) SaveSigningKey(
+	ctx context.Context,
+	key models.SigningKey,
+) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.signingKeys[key.ID]; !ok {
+		keep(db, &db.signingOrder)
+		db.signingOrder = append(db.signingOrder, key.ID)
+	}
+	put(db, db.signingKeys, key.ID, copyKey(key))
+
+	return nil
+}
+
+// SigningKeys returns all keys that are not expired yet.
+func (db *DB) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	defer db.rlock(ctx)()
+
+	now := time.Now()
+
+	var keys []models.SigningKey
+	for _, kid := range db.signingOrder {
+		key := db.signingKeys[kid]
+		if !key.ExpiresAt.IsZero() && !key.ExpiresAt.After(now) {
+			continue
+		}
+		keys = append(keys, copyKey(key))
+	}
+
+	return keys, nil
+}
+
+// RetireSigningKey sets time after which the key is not published anymore.
+func (db *DB) RetireSigningKey(
+	ctx context.Context,
+	keyID string,
+	expiresAt time.Time,
+) error {
+	defer db.lock(ctx)()
+
+	key, ok := db.signingKeys[keyID]
+	if ok && key.ExpiresAt.IsZero() {
+		key.ExpiresAt = expiresAt
+		put(db, db.signingKeys, keyID, key)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSigningKeys deletes keys that are not published anymore.
+func (db *DB) DeleteExpiredSigningKeys(ctx context.Context) error {
+	defer db.lock(ctx)()
+
+	now := time.Now()
+
+	// Новый срез: старый может понадобиться для отката транзакции
+	order := make([]string, 0, len(db.signingOrder))
+	for _, kid := range db.signingOrder {
+		key := db.signingKeys[kid]
+		if !key.ExpiresAt.IsZero() && !key.ExpiresAt.After(now) {
+			drop(db, db.signingKeys, kid)
+			continue
+		}
+		order = append(order, kid)
+	}
+	keep(db, &db.signingOrder)
+	db.signingOrder = order
+
+	return nil
+}
+
+func copyKey(key models.SigningKey) models.SigningKey {
+	key.PrivateKey = clone(key.PrivateKey)
+	key.PublicKey = clone(key.PublicKey)
+	return key
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// LoginAttempts returns failed login attempts by key.
+// Если записи нет, возвращаются нулевые попытки без ошибки
+func (db *DB) LoginAttempts(
+	ctx context.Context,
+	key string,
+) (models.LoginAttempts, error) {
+	defer db.rlock(ctx)()
+
+	attempts, ok := db.logins[key]
+	if !ok {
+		return models.LoginAttempts{Key: key}, nil
+	}
+
+	return attempts, nil
+}
+
+// AddLoginFailure counts failed attempt at the given time.
+// Если запись истекла, счётчик и блокировка начинаются заново
+func (db *DB) AddLoginFailure(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (models.LoginAttempts, error) {
+	defer db.lock(ctx)()
+
+	attempts, ok := db.logins[key]
+	if !ok || !attempts.ExpiresAt.After(at) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailure = at
+	if expiresAt := at.Add(window); expiresAt.After(attempts.ExpiresAt) {
+		attempts.ExpiresAt = expiresAt
+	}
+	put(db, db.logins, key, attempts)
+
+	return attempts, nil
+}
+
+// LockLogin locks the key until the given time and resets its failures.
+// Нет записи - ничего не делает
+func (db *DB) LockLogin(
+	ctx context.Context,
+	key string,
+	until time.Time,
+) error {
+	defer db.lock(ctx)()
+
+	attempts, ok := db.logins[key]
+	if !ok {
+		return nil
+	}
+	attempts.Failures = 0
+	attempts.LockedUntil = until
+	if until.After(attempts.ExpiresAt) {
+		attempts.ExpiresAt = until
+	}
+	put(db, db.logins, key, attempts)
+
+	return nil
+}
+
+// ResetLoginAttempts forgets failures and lock of the key.
+func (db *DB) ResetLoginAttempts(
+	ctx context.Context,
+	key string,
+) error {
+	defer db.lock(ctx)()
+
+	drop(db, db.logins, key)
+
+	return nil
+}
+
+// DeleteExpiredLoginAttempts deletes attempts that are not counted anyway.
+func (db *DB) DeleteExpiredLoginAttempts(ctx context.Context) error {
+	defer db.lock(ctx)()
+
+	now := time.Now()
+	for key, attempts := range db.logins {
+		if !attempts.ExpiresAt.After(now) {
+			drop(db, db.logins, key)
+		}
+	}
+
+	return nil
+}
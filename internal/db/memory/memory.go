@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// DB keeps everything in memory: for local runs and tests without Postgres
+// Данные теряются при остановке. Семантика ошибок та же, что у pg
+type DB struct {
+	mu sync.RWMutex
+	state
+	// Не nil внутри WithTx, доступ только под mu
+	undo *undoLog
+}
+
+// state - все данные хранилища
+type state struct {
+	users        map[uint32]models.User
+	userIDs      map[string]uint32 // email -> id, email уникален
+	lastUserID   uint32
+	apps         map[uint32]models.App
+	roles        map[string]models.Role
+	lastRoleID   uint32
+	userRoles    map[userRoleKey]struct{}
+	refresh      map[int64]models.RefreshToken
+	refreshIDs   map[string]int64 // hash -> id
+	lastRefresh  int64
+	access       map[string]models.AccessToken // jti -> token
+	revoked      map[string]time.Time          // jti -> expires_at
+	signingKeys  map[string]models.SigningKey
+	signingOrder []string // kid в порядке создания
+	logins       map[string]models.LoginAttempts
+	resets       map[string]models.PasswordResetToken // hash -> token
+	audit        []models.AuditEvent
+}
+
+type userRoleKey struct {
+	userID uint32
+	appID  uint32
+	role   string
+}
+
+// New creates empty storage with the admin role, like the migrations do
+func New() *DB {
+	db := &DB{
+		state: state{
+			users:       make(map[uint32]models.User),
+			userIDs:     make(map[string]uint32),
+			apps:        make(map[uint32]models.App),
+			roles:       make(map[string]models.Role),
+			userRoles:   make(map[userRoleKey]struct{}),
+			refresh:     make(map[int64]models.RefreshToken),
+			refreshIDs:  make(map[string]int64),
+			access:      make(map[string]models.AccessToken),
+			revoked:     make(map[string]time.Time),
+			signingKeys: make(map[string]models.SigningKey),
+			logins:      make(map[string]models.LoginAttempts),
+			resets:      make(map[string]models.PasswordResetToken),
+		},
+	}
+
+	db.saveRole(models.RoleAdmin, []string{models.PermissionAll})
+
+	return db
+}
+
+func (db *DB) Stop() error {
+	return nil
+}
+
+// Ping always succeeds
+func (db *DB) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (db *DB) SaveUser(
+	ctx context.Context,
+	email string,
+	passHash []byte,
+) (uint32, error) {
+	const op = "db.memory.SaveUser"
+
+	defer db.lock(ctx)()
+
+	if _, ok := db.userIDs[email]; ok {
+		return 0, fmt.Errorf("%s: %w", op, database.ErrUserExists)
+	}
+
+	keep(db, &db.lastUserID)
+	db.lastUserID++
+	user := models.User{
+		ID:       db.lastUserID,
+		Email:    email,
+		PassHash: clone(passHash),
+	}
+	put(db, db.users, user.ID, user)
+	put(db, db.userIDs, email, user.ID)
+
+	return user.ID, nil
+}
+
+// User returns user by email.
+func (db *DB) User(
+	ctx context.Context,
+	email string,
+) (models.User, error) {
+	const op = "db.memory.User"
+
+	defer db.rlock(ctx)()
+
+	id, ok := db.userIDs[email]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return copyUser(db.users[id]), nil
+}
+
+// UserByID returns user by id.
+func (db *DB) UserByID(
+	ctx context.Context,
+	userID uint32,
+) (models.User, error) {
+	const op = "db.memory.UserByID"
+
+	defer db.rlock(ctx)()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return copyUser(user), nil
+}
+
+// UpdatePassHash replaces password hash of the user.
+func (db *DB) UpdatePassHash(
+	ctx context.Context,
+	userID uint32,
+	passHash []byte,
+) error {
+	const op = "db.memory.UpdatePassHash"
+
+	defer db.lock(ctx)()
+
+	user, ok := db.users[userID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+	user.PassHash = clone(passHash)
+	put(db, db.users, userID, user)
+
+	return nil
+}
+
+// ReplacePassHash replaces password hash of the user only if it is still oldHash.
+// Хэш уже другой или пользователя нет - ErrUserNotFound
+func (db *DB) ReplacePassHash(
+	ctx context.Context,
+	userID uint32,
+	oldHash []byte,
+	newHash []byte,
+) error {
+	const op = "db.memory.ReplacePassHash"
+
+	defer db.lock(ctx)()
+
+	user, ok := db.users[userID]
+	if !ok || !bytes.Equal(user.PassHash, oldHash) {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+	user.PassHash = clone(newHash)
+	put(db, db.users, userID, user)
+
+	return nil
+}
+
+// UpdateEmail changes email of the user, если текущий email всё ещё oldEmail.
+// Новый email не подтверждён. Email занят - ErrUserExists, пользователя нет или email уже другой - ErrUserNotFound
+func (db *DB) UpdateEmail(
+	ctx context.Context,
+	userID uint32,
+	oldEmail string,
+	newEmail string,
+) error {
+	const op = "db.memory.UpdateEmail"
+
+	defer db.lock(ctx)()
+
+	user, ok := db.users[userID]
+	if !ok || user.Email != oldEmail {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+	if _, ok := db.userIDs[newEmail]; ok {
+		return fmt.Errorf("%s: %w", op, database.ErrUserExists)
+	}
+
+	drop(db, db.userIDs, oldEmail)
+	put(db, db.userIDs, newEmail, userID)
+	user.Email = newEmail
+	user.EmailVerified = false
+	put(db, db.users, userID, user)
+
+	return nil
+}
+
+// MarkEmailVerified marks email of the user as verified.
+// Если email пользователя уже другой или уже подтверждён, возвращает ErrUserNotFound
+func (db *DB) MarkEmailVerified(
+	ctx context.Context,
+	userID uint32,
+	email string,
+) error {
+	const op = "db.memory.MarkEmailVerified"
+
+	defer db.lock(ctx)()
+
+	user, ok := db.users[userID]
+	if !ok || user.Email != email || user.EmailVerified {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+	user.EmailVerified = true
+	put(db, db.users, userID, user)
+
+	return nil
+}
+
+// SaveApp adds or replaces the app. Приложения в памяти появляются только из seed или тестов
+func (db *DB) SaveApp(ctx context.Context, app models.App) error {
+	defer db.lock(ctx)()
+
+	if app.SigningAlg == "" {
+		app.SigningAlg = "HS256" // как DEFAULT в миграции
+	}
+	put(db, db.apps, app.ID, app)
+
+	return nil
+}
+
+// App returns app by id.
+func (db *DB) App(
+	ctx context.Context,
+	appID uint32,
+) (models.App, error) {
+	const op = "db.memory.App"
+
+	defer db.rlock(ctx)()
+
+	app, ok := db.apps[appID]
+	if !ok {
+		return models.App{}, fmt.Errorf("%s: %w", op, database.ErrAppNotFound)
+	}
+
+	return app, nil
+}
+
+// Срезы копируются, чтобы вызывающий код не мог поменять данные хранилища без блокировки
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func copyUser(user models.User) models.User {
+	user.PassHash = clone(user.PassHash)
+	return user
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"grpc_service/internal/db/storagetest"
+	"grpc_service/internal/domain/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
+
+// Откат возвращает изменённые, добавленные и удалённые ключи, счётчики и срезы
+func TestTxRollbackUndo(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+
+	userID, err := db.SaveUser(ctx, "user@example.com", []byte("hash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []models.SigningKey{
+		{ID: "expired", Algorithm: "EdDSA", ExpiresAt: time.Now().Add(-time.Hour)},
+		{ID: "active", Algorithm: "EdDSA"},
+	}
+	for _, key := range keys {
+		if err := db.SaveSigningKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveAuditEvent(ctx, models.AuditEvent{UserID: userID}); err != nil {
+		t.Fatal(err)
+	}
+	lastUserID, auditLen := db.lastUserID, len(db.audit)
+
+	errRollback := errors.New("rollback")
+	err = db.WithTx(ctx, func(ctx context.Context) error {
+		if err := db.UpdateEmail(ctx, userID, "user@example.com", "new@example.com"); err != nil {
+			return err
+		}
+		if err := db.UpdatePassHash(ctx, userID, []byte("new hash")); err != nil {
+			return err
+		}
+		if _, err := db.SaveUser(ctx, "other@example.com", []byte("hash")); err != nil {
+			return err
+		}
+		if err := db.DeleteExpiredSigningKeys(ctx); err != nil {
+			return err
+		}
+		if err := db.SaveSigningKey(ctx, models.SigningKey{ID: "new", Algorithm: "EdDSA"}); err != nil {
+			return err
+		}
+		if err := db.SaveAuditEvent(ctx, models.AuditEvent{UserID: userID}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx error = %v, want error of fn", err)
+	}
+
+	user, err := db.User(ctx, "user@example.com")
+	if err != nil || !bytes.Equal(user.PassHash, []byte("hash")) {
+		t.Errorf("user after rollback = %+v, %v, want old email and hash", user, err)
+	}
+	if _, ok := db.userIDs["new@example.com"]; ok {
+		t.Error("new email is not rolled back")
+	}
+	if _, ok := db.userIDs["other@example.com"]; ok || db.lastUserID != lastUserID {
+		t.Errorf("new user is not rolled back, lastUserID = %d, want %d", db.lastUserID, lastUserID)
+	}
+	if _, ok := db.signingKeys["expired"]; !ok {
+		t.Error("deleted key is not restored")
+	}
+	if _, ok := db.signingKeys["new"]; ok {
+		t.Error("new key is not rolled back")
+	}
+	if !slices.Equal(db.signingOrder, []string{"expired", "active"}) {
+		t.Errorf("signingOrder = %v, want [expired active]", db.signingOrder)
+	}
+	if len(db.audit) != auditLen {
+		t.Errorf("%d audit events, want %d", len(db.audit), auditLen)
+	}
+	if db.undo != nil {
+		t.Error("undo log is left after WithTx")
+	}
+
+	// Запись после отката не попадает в undo log и не откатывается
+	if _, err := db.SaveUser(ctx, "other@example.com", []byte("hash")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithTx(ctx, func(context.Context) error { return errRollback }); !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx error = %v", err)
+	}
+	if _, err := db.User(ctx, "other@example.com"); err != nil {
+		t.Errorf("user saved outside the transaction: %v", err)
+	}
+}
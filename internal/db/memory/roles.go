@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"sort"
+)
+
+// SaveRole adds the role or replaces its permissions
+func (db *DB) SaveRole(ctx context.Context, name string, permissions []string) error {
+	defer db.lock(ctx)()
+
+	db.saveRole(name, permissions)
+	return nil
+}
+
+func (db *DB) saveRole(name string, permissions []string) {
+	role, ok := db.roles[name]
+	if !ok {
+		keep(db, &db.lastRoleID)
+		db.lastRoleID++
+		role = models.Role{ID: db.lastRoleID, Name: name}
+	}
+
+	role.Permissions = append([]string(nil), permissions...)
+	sort.Strings(role.Permissions)
+	put(db, db.roles, name, role)
+}
+
+// UserRoles returns roles of the user in the app, including global roles.
+// appID = 0 returns roles in all apps.
+func (db *DB) UserRoles(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) ([]models.UserRole, error) {
+	const op = "db.memory.UserRoles"
+
+	defer db.rlock(ctx)()
+
+	if _, ok := db.users[userID]; !ok {
+		return nil, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	var roles []models.UserRole
+	for key := range db.userRoles {
+		if key.userID != userID || !inApp(key.appID, appID) {
+			continue
+		}
+		role := db.roles[key.role]
+		role.Permissions = append([]string(nil), role.Permissions...)
+		roles = append(roles, models.UserRole{
+			UserID: userID,
+			AppID:  key.appID,
+			Role:   role,
+		})
+	}
+
+	// Тот же порядок, что и в pg
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].AppID != roles[j].AppID {
+			return roles[i].AppID < roles[j].AppID
+		}
+		return roles[i].Role.Name < roles[j].Role.Name
+	})
+
+	return roles, nil
+}
+
+// HasPermission checks if any role of the user in the app grants the permission.
+func (db *DB) HasPermission(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	permission string,
+) (bool, error) {
+	const op = "db.memory.HasPermission"
+
+	defer db.rlock(ctx)()
+
+	if _, ok := db.users[userID]; !ok {
+		return false, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	for key := range db.userRoles {
+		if key.userID != userID || (key.appID != 0 && key.appID != appID) {
+			continue
+		}
+		for _, p := range db.roles[key.role].Permissions {
+			if p == permission || p == models.PermissionAll {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// AssignRole gives the role to the user in the app. Assigning the same role twice is not an error.
+func (db *DB) AssignRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.memory.AssignRole"
+
+	defer db.lock(ctx)()
+
+	if _, ok := db.roles[role]; !ok {
+		return fmt.Errorf("%s: %w", op, database.ErrRoleNotFound)
+	}
+	if _, ok := db.users[userID]; !ok {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	put(db, db.userRoles, userRoleKey{userID: userID, appID: appID, role: role}, struct{}{})
+
+	return nil
+}
+
+// RevokeRole takes the role from the user in the app.
+func (db *DB) RevokeRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.memory.RevokeRole"
+
+	defer db.lock(ctx)()
+
+	if _, ok := db.roles[role]; !ok {
+		return fmt.Errorf("%s: %w", op, database.ErrRoleNotFound)
+	}
+
+	drop(db, db.userRoles, userRoleKey{userID: userID, appID: appID, role: role})
+
+	return nil
+}
+
+// inApp reports whether the role given in roleApp applies to the requested app
+// appID = 0 - все приложения, roleApp = 0 - глобальная роль
+func inApp(roleApp uint32, appID uint32) bool {
+	return appID == 0 || roleApp == 0 || roleApp == appID
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// seed - файл с начальными данными, пример в config/seed.yaml
+type seed struct {
+	Apps  []seedApp  `yaml:"apps"`
+	Roles []seedRole `yaml:"roles"`
+	Users []seedUser `yaml:"users"`
+}
+
+type seedApp struct {
+	ID         uint32 `yaml:"id"`
+	Name       string `yaml:"name"`
+	Secret     string `yaml:"secret"`
+	SigningAlg string `yaml:"signing_alg"`
+	TokenRoles bool   `yaml:"token_roles"`
+	TokenScope bool   `yaml:"token_scope"`
+	// Не пускать пользователей с неподтверждённым email
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+}
+
+type seedRole struct {
+	Name        string   `yaml:"name"`
+	Permissions []string `yaml:"permissions"`
+}
+
+type seedUser struct {
+	Email         string `yaml:"email"`
+	Password      string `yaml:"password"`
+	EmailVerified bool   `yaml:"email_verified"`
+	Roles         []struct {
+		Role  string `yaml:"role"`
+		AppID uint32 `yaml:"app_id"` // 0 - во всех приложениях
+	} `yaml:"roles"`
+}
+
+// Seed loads apps, roles and users from the YAML file
+// Пароли в файле открытым текстом, поэтому seed только для разработки и тестов
+func (db *DB) Seed(ctx context.Context, path string) error {
+	const op = "db.memory.Seed"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var s seed
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, app := range s.Apps {
+		if app.ID == 0 {
+			return fmt.Errorf("%s: app %q: id is required", op, app.Name)
+		}
+		err := db.SaveApp(ctx, models.App{
+			ID:         app.ID,
+			Name:       app.Name,
+			Secret:     app.Secret,
+			SigningAlg: app.SigningAlg,
+			TokenRoles: app.TokenRoles,
+			TokenScope: app.TokenScope,
+
+			RequireVerifiedEmail: app.RequireVerifiedEmail,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	for _, role := range s.Roles {
+		if err := db.SaveRole(ctx, role.Name, role.Permissions); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	for _, user := range s.Users {
+		passHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("%s: user %q: %w", op, user.Email, err)
+		}
+
+		userID, err := db.SaveUser(ctx, user.Email, passHash)
+		if err != nil {
+			return fmt.Errorf("%s: user %q: %w", op, user.Email, err)
+		}
+
+		if user.EmailVerified {
+			if err := db.MarkEmailVerified(ctx, userID, user.Email); err != nil {
+				return fmt.Errorf("%s: user %q: %w", op, user.Email, err)
+			}
+		}
+
+		for _, role := range user.Roles {
+			if err := db.AssignRole(ctx, userID, role.AppID, role.Role); err != nil {
+				return fmt.Errorf("%s: user %q: %w", op, user.Email, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// SaveRefreshToken saves hash of the refresh token.
+func (db *DB) SaveRefreshToken(
+	ctx context.Context,
+	token models.RefreshToken,
+) error {
+	defer db.lock(ctx)()
+
+	keep(db, &db.lastRefresh)
+	db.lastRefresh++
+	token.ID = db.lastRefresh
+	token.Hash = clone(token.Hash)
+	token.Used = false
+	token.Revoked = false
+
+	put(db, db.refresh, token.ID, token)
+	put(db, db.refreshIDs, string(token.Hash), token.ID)
+
+	return nil
+}
+
+// RefreshToken returns refresh token by its hash.
+func (db *DB) RefreshToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.RefreshToken, error) {
+	const op = "db.memory.RefreshToken"
+
+	defer db.rlock(ctx)()
+
+	id, ok := db.refreshIDs[string(tokenHash)]
+	if !ok {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+	}
+
+	token := db.refresh[id]
+	token.Hash = clone(token.Hash)
+
+	return token, nil
+}
+
+// UseRefreshToken marks refresh token as used.
+// If token was already used or revoked, returns ErrTokenUsed.
+func (db *DB) UseRefreshToken(
+	ctx context.Context,
+	tokenID int64,
+) error {
+	const op = "db.memory.UseRefreshToken"
+
+	defer db.lock(ctx)()
+
+	token, ok := db.refresh[tokenID]
+	if !ok || token.Used || token.Revoked {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+
+	token.Used = true
+	put(db, db.refresh, tokenID, token)
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens of the family.
+func (db *DB) RevokeRefreshTokenFamily(
+	ctx context.Context,
+	familyID string,
+) error {
+	defer db.lock(ctx)()
+
+	for id, token := range db.refresh {
+		if token.FamilyID == familyID {
+			token.Revoked = true
+			put(db, db.refresh, id, token)
+		}
+	}
+
+	return nil
+}
+
+// SaveAccessToken saves jti of the issued access token.
+func (db *DB) SaveAccessToken(
+	ctx context.Context,
+	token models.AccessToken,
+) error {
+	defer db.lock(ctx)()
+
+	put(db, db.access, token.ID, token)
+
+	return nil
+}
+
+// RevokeToken adds jti to the denylist until the token expires.
+func (db *DB) RevokeToken(
+	ctx context.Context,
+	tokenID string,
+	expiresAt time.Time,
+) error {
+	defer db.lock(ctx)()
+
+	if _, ok := db.revoked[tokenID]; !ok {
+		put(db, db.revoked, tokenID, expiresAt)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens adds all live access tokens of the user to the denylist
+// and revokes his refresh tokens. appID = 0 means all apps.
+func (db *DB) RevokeUserTokens(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) error {
+	defer db.lock(ctx)()
+
+	now := time.Now()
+	for jti, token := range db.access {
+		if token.UserID != userID || (appID != 0 && token.AppID != appID) || !token.ExpiresAt.After(now) {
+			continue
+		}
+		if _, ok := db.revoked[jti]; !ok {
+			put(db, db.revoked, jti, token.ExpiresAt)
+		}
+	}
+
+	for id, token := range db.refresh {
+		if token.UserID == userID && (appID == 0 || token.AppID == appID) {
+			token.Revoked = true
+			put(db, db.refresh, id, token)
+		}
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks if jti is in the denylist.
+func (db *DB) IsTokenRevoked(
+	ctx context.Context,
+	tokenID string,
+) (bool, error) {
+	defer db.rlock(ctx)()
+
+	expiresAt, ok := db.revoked[tokenID]
+	return ok && expiresAt.After(time.Now()), nil
+}
+
+// SavePasswordResetToken saves hash of the password reset token.
+func (db *DB) SavePasswordResetToken(
+	ctx context.Context,
+	token models.PasswordResetToken,
+) error {
+	defer db.lock(ctx)()
+
+	put(db, db.resets, string(token.Hash), token)
+
+	return nil
+}
+
+// PasswordResetToken returns password reset token by its hash.
+func (db *DB) PasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.PasswordResetToken, error) {
+	const op = "db.memory.PasswordResetToken"
+
+	defer db.rlock(ctx)()
+
+	token, ok := db.resets[string(tokenHash)]
+	if !ok {
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+	}
+
+	return token, nil
+}
+
+// UsePasswordResetToken deletes the token.
+// If token was already used, returns ErrTokenUsed.
+func (db *DB) UsePasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) error {
+	const op = "db.memory.UsePasswordResetToken"
+
+	defer db.lock(ctx)()
+
+	if _, ok := db.resets[string(tokenHash)]; !ok {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+	drop(db, db.resets, string(tokenHash))
+
+	return nil
+}
+
+// DeletePasswordResetTokens deletes all password reset tokens of the user.
+func (db *DB) DeletePasswordResetTokens(
+	ctx context.Context,
+	userID uint32,
+) error {
+	defer db.lock(ctx)()
+
+	for hash, token := range db.resets {
+		if token.UserID == userID {
+			drop(db, db.resets, hash)
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpiredTokens deletes tokens and denylist entries that are expired anyway.
+func (db *DB) DeleteExpiredTokens(ctx context.Context) error {
+	defer db.lock(ctx)()
+
+	now := time.Now()
+	for jti, expiresAt := range db.revoked {
+		if !expiresAt.After(now) {
+			drop(db, db.revoked, jti)
+		}
+	}
+	for jti, token := range db.access {
+		if !token.ExpiresAt.After(now) {
+			drop(db, db.access, jti)
+		}
+	}
+	for id, token := range db.refresh {
+		if !token.ExpiresAt.After(now) {
+			drop(db, db.refresh, id)
+			drop(db, db.refreshIDs, string(token.Hash))
+		}
+	}
+	for hash, token := range db.resets {
+		if !token.ExpiresAt.After(now) {
+			drop(db, db.resets, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+)
+
+type txKey struct {
+	db *DB
+}
+
+// WithTx runs fn holding the storage lock, so other calls wait until it finishes.
+// If fn returns an error or panics, all its changes are rolled back.
+// Storage methods must be called with ctx passed to fn, otherwise they deadlock
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Вложенная транзакция - часть внешней
+	if db.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Изменения записываются в undo log, откат восстанавливает только тронутые ключи
+	db.undo = &undoLog{}
+	committed := false
+	defer func() {
+		if !committed {
+			db.undo.rollback()
+		}
+		db.undo = nil
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{db: db}, true)); err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+func (db *DB) inTx(ctx context.Context) bool {
+	inTx, _ := ctx.Value(txKey{db: db}).(bool)
+	return inTx
+}
+
+// lock locks storage for writing unless ctx is in a transaction, which already holds the lock
+// Использование: defer db.lock(ctx)()
+func (db *DB) lock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// rlock is lock for reading
+func (db *DB) rlock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
+
+// undoLog - функции, возвращающие прежние значения, в порядке изменений
+type undoLog []func()
+
+func (u *undoLog) rollback() {
+	for i := len(*u) - 1; i >= 0; i-- {
+		(*u)[i]()
+	}
+}
+
+// put sets m[key] = value. In a transaction the previous value is saved to the undo log
+// Вне транзакции undo log нет, и запись ничего не стоит
+func put[K comparable, V any](db *DB, m map[K]V, key K, value V) {
+	remember(db, m, key)
+	m[key] = value
+}
+
+// drop deletes key from m, saving the previous value in a transaction
+func drop[K comparable, V any](db *DB, m map[K]V, key K) {
+	remember(db, m, key)
+	delete(m, key)
+}
+
+func remember[K comparable, V any](db *DB, m map[K]V, key K) {
+	if db.undo == nil {
+		return
+	}
+
+	old, ok := m[key]
+	*db.undo = append(*db.undo, func() {
+		if ok {
+			m[key] = old
+		} else {
+			delete(m, key)
+		}
+	})
+}
+
+// keep saves the value of a counter or a slice header before it is changed
+// Срезы только дописываются или заменяются новыми, поэтому хватает старого заголовка
+func keep[T any](db *DB, p *T) {
+	if db.undo == nil {
+		return
+	}
+
+	old := *p
+	*db.undo = append(*db.undo, func() {
+		*p = old
+	})
+}
@@ -0,0 +1,95 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// SaveSigningKey saves a new signing key.
+func (db *DB) SaveSigningKey(
+	ctx context.Context,
+	key models.SigningKey,
+) error {
+	const op = "db.pg.SaveSigningKey"
+
+	_, err := db.conn(ctx).Exec(ctx, `INSERT INTO signing_keys(kid, app_id, alg, private_key, public_key, created_at)
+		VALUES($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.AppID, key.Algorithm, key.PrivateKey, key.PublicKey, key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SigningKeys returns all keys that are not expired yet.
+func (db *DB) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "db.pg.SigningKeys"
+
+	rows, err := db.conn(ctx).Query(ctx, `SELECT kid, app_id, alg, private_key, public_key, created_at, expires_at
+		FROM signing_keys WHERE expires_at IS NULL OR expires_at > now()
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var (
+			key       models.SigningKey
+			expiresAt *time.Time
+		)
+		err := rows.Scan(
+			&key.ID,
+			&key.AppID,
+			&key.Algorithm,
+			&key.PrivateKey,
+			&key.PublicKey,
+			&key.CreatedAt,
+			&expiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if expiresAt != nil {
+			key.ExpiresAt = *expiresAt
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RetireSigningKey sets time after which the key is not published anymore.
+func (db *DB) RetireSigningKey(
+	ctx context.Context,
+	keyID string,
+	expiresAt time.Time,
+) error {
+	const op = "db.pg.RetireSigningKey"
+
+	_, err := db.conn(ctx).Exec(ctx, "UPDATE signing_keys SET expires_at = $2 WHERE kid = $1 AND expires_at IS NULL",
+		keyID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSigningKeys deletes keys that are not published anymore.
+func (db *DB) DeleteExpiredSigningKeys(ctx context.Context) error {
+	const op = "db.pg.DeleteExpiredSigningKeys"
+
+	if _, err := db.conn(ctx).Exec(ctx, "DELETE FROM signing_keys WHERE expires_at <= now()"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const loginAttemptsColumns = "key, failures, last_failure, locked_until, expires_at"
+
+// LoginAttempts returns failed login attempts by key.
+// Если записи нет, возвращаются нулевые попытки без ошибки
+func (db *DB) LoginAttempts(
+	ctx context.Context,
+	key string,
+) (models.LoginAttempts, error) {
+	const op = "db.pg.LoginAttempts"
+
+	attempts, err := scanLoginAttempts(db.conn(ctx).QueryRow(ctx,
+		`SELECT `+loginAttemptsColumns+` FROM login_attempts WHERE key = $1`, key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.LoginAttempts{Key: key}, nil
+		}
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// AddLoginFailure counts failed attempt at the given time.
+// Если запись истекла, счётчик и блокировка начинаются заново
+func (db *DB) AddLoginFailure(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (models.LoginAttempts, error) {
+	const op = "db.pg.AddLoginFailure"
+
+	// Одним запросом, чтобы параллельные попытки с разных реплик не потерялись
+	attempts, err := scanLoginAttempts(db.conn(ctx).QueryRow(ctx, `INSERT INTO login_attempts AS a
+			(key, failures, last_failure, locked_until, expires_at)
+		VALUES ($1, 1, $2, NULL, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN a.expires_at <= $2 THEN 1 ELSE a.failures + 1 END,
+			last_failure = $2,
+			locked_until = CASE WHEN a.expires_at <= $2 THEN NULL ELSE a.locked_until END,
+			expires_at = CASE WHEN a.expires_at <= $2 THEN $3 ELSE GREATEST(a.expires_at, $3) END
+		RETURNING `+loginAttemptsColumns,
+		key, at, at.Add(window)))
+	if err != nil {
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// LockLogin locks the key until the given time and resets its failures.
+// Нет записи - ничего не делает
+func (db *DB) LockLogin(
+	ctx context.Context,
+	key string,
+	until time.Time,
+) error {
+	const op = "db.pg.LockLogin"
+
+	_, err := db.conn(ctx).Exec(ctx, `UPDATE login_attempts
+		SET failures = 0, locked_until = $2, expires_at = GREATEST(expires_at, $2)
+		WHERE key = $1`, key, until)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetLoginAttempts forgets failures and lock of the key.
+func (db *DB) ResetLoginAttempts(
+	ctx context.Context,
+	key string,
+) error {
+	const op = "db.pg.ResetLoginAttempts"
+
+	if _, err := db.conn(ctx).Exec(ctx, "DELETE FROM login_attempts WHERE key = $1", key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredLoginAttempts deletes attempts that are not counted anyway.
+func (db *DB) DeleteExpiredLoginAttempts(ctx context.Context) error {
+	const op = "db.pg.DeleteExpiredLoginAttempts"
+
+	if _, err := db.conn(ctx).Exec(ctx, "DELETE FROM login_attempts WHERE expires_at <= now()"); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanLoginAttempts(row pgx.Row) (models.LoginAttempts, error) {
+	var (
+		attempts    models.LoginAttempts
+		lockedUntil *time.Time
+	)
+	if err := row.Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&attempts.LastFailure,
+		&lockedUntil,
+		&attempts.ExpiresAt,
+	); err != nil {
+		return models.LoginAttempts{}, err
+	}
+	if lockedUntil != nil {
+		attempts.LockedUntil = *lockedUntil
+	}
+
+	return attempts, nil
+}
@@ -2,39 +2,85 @@ package pg
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"grpc_service/internal/config"
 	database "grpc_service/internal/db"
 	"grpc_service/internal/domain/models"
+	"log/slog"
+	"strconv"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Коды ошибок postgres
+const (
+	codeUniqueViolation     = "23505"
+	codeForeignKeyViolation = "23503"
+)
+
+// DB - хранилище на пуле соединений pgx
+// pgx сам готовит запросы и кэширует их на каждом соединении,
+// поэтому Prepare вручную не нужен и ничего не утекает
 type DB struct {
-	data *sql.DB
+	data *pgxpool.Pool
 }
 
 func (db *DB) Stop() error {
-	return db.data.Close()
+	db.data.Close()
+	return nil
+}
+
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	const op = "db.pg.Ping"
+
+	if err := db.data.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
 }
 
 // New creates a new instance of postgres
-func New(storagePath string) (*DB, error) {
+func New(log *slog.Logger, storagePath string, cfg config.PostgresConfig) (*DB, error) {
 	const op = "db.pg.New"
 
-	db, err := sql.Open("postgres", storagePath)
+	poolConfig, err := pgxpool.ParseConfig(storagePath)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	
-	err = db.Ping()
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	poolConfig.MinConns = cfg.MinConns
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.StatementTimeout > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		poolConfig.ConnConfig.Tracer = newSlowQueryTracer(log, cfg.SlowQueryThreshold)
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return &DB{
-		data: db,
+		data: pool,
 	}, nil
 }
 
@@ -45,77 +91,166 @@ func (db *DB) SaveUser(
 ) (uint32, error) {
 	const op = "db.pg.SaveUser"
 
-	stmt, err := db.data.Prepare("INSERT INTO users(email, pass hash) VALUES(?, ?)")
+	var id uint32
+	err := db.conn(ctx).QueryRow(ctx, "INSERT INTO users(email, pass_hash) VALUES($1, $2) RETURNING id",
+		email, passHash).Scan(&id)
 	if err != nil {
+		if isPgError(err, codeUniqueViolation) {
+			return 0, fmt.Errorf("%s: %w", op, database.ErrUserExists)
+		}
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	res, err := stmt.ExecContext(ctx, email, passHash)
+	return id, nil
+}
+
+// User returns user by email.
+func (db *DB) User(
+	ctx context.Context,
+	email string,
+) (models.User, error) {
+	const op = "db.pg.User"
+
+	var user models.User
+	err := db.conn(ctx).QueryRow(ctx, "SELECT id, email, pass_hash, email_verified FROM users WHERE email = $1",
+		email).Scan(&user.ID, &user.Email, &user.PassHash, &user.EmailVerified)
 	if err != nil {
-		// TODO: обработка ошибок
-		return 0, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// ID последней созданной записи (не будет ли проблем с параллелизмом?)
-	id, err := res.LastInsertId()
+	return user, nil
+}
+
+// UserByID returns user by id.
+func (db *DB) UserByID(
+	ctx context.Context,
+	userID uint32,
+) (models.User, error) {
+	const op = "db.pg.UserByID"
+
+	var user models.User
+	err := db.conn(ctx).QueryRow(ctx, "SELECT id, email, pass_hash, email_verified FROM users WHERE id = $1",
+		userID).Scan(&user.ID, &user.Email, &user.PassHash, &user.EmailVerified)
 	if err != nil {
-		return 0, fmt.Errorf("%s: %w", op, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return uint32(id), nil
+	return user, nil
 }
 
-func (db *DB) User(
+// UpdatePassHash replaces password hash of the user.
+func (db *DB) UpdatePassHash(
 	ctx context.Context,
-	email string,
-) (User models.User, err error) {
-	const op = "db.pg.User"
-	var emptyUser = models.User{}
+	userID uint32,
+	passHash []byte,
+) error {
+	const op = "db.pg.UpdatePassHash"
 
-	stmt, err := db.data.Prepare("SELECT id, email, pass_hash FROM users")
+	tag, err := db.conn(ctx).Exec(ctx, "UPDATE users SET pass_hash = $1 WHERE id = $2", passHash, userID)
 	if err != nil {
-		return emptyUser, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
 	}
 
-	row := stmt.QueryRowContext(ctx, email)
+	return nil
+}
 
-	err = row.Scan(&User.ID, &User.Email, &User.PassHash)
+// ReplacePassHash replaces password hash of the user only if it is still oldHash.
+// Хэш уже другой или пользователя нет - ErrUserNotFound
+func (db *DB) ReplacePassHash(
+	ctx context.Context,
+	userID uint32,
+	oldHash []byte,
+	newHash []byte,
+) error {
+	const op = "db.pg.ReplacePassHash"
 
+	tag, err := db.conn(ctx).Exec(ctx, "UPDATE users SET pass_hash = $3 WHERE id = $1 AND pass_hash = $2",
+		userID, oldHash, newHash)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return emptyUser, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
-		}
-		return emptyUser, fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
 	}
 
-	return User, nil
+	return nil
 }
 
-func (db *DB) IsAdmin(
+// UpdateEmail changes email of the user, если текущий email всё ещё oldEmail.
+// Новый email не подтверждён. Email занят - ErrUserExists, пользователя нет или email уже другой - ErrUserNotFound
+func (db *DB) UpdateEmail(
 	ctx context.Context,
 	userID uint32,
-) (bool, error) {
-	const op = "db.pg.IsAdmin"
+	oldEmail string,
+	newEmail string,
+) error {
+	const op = "db.pg.UpdateEmail"
 
-	stmt, err := db.data.Prepare("SELECT is_admin FROM users WHERE id = ?")
+	tag, err := db.conn(ctx).Exec(ctx, `UPDATE users SET email = $3, email_verified = FALSE
+		WHERE id = $1 AND email = $2`, userID, oldEmail, newEmail)
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		if isPgError(err, codeUniqueViolation) {
+			return fmt.Errorf("%s: %w", op, database.ErrUserExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
 	}
 
-	row := stmt.QueryRowContext(ctx, userID)
+	return nil
+}
 
-	var isAdmin bool
+// MarkEmailVerified marks email of the user as verified.
+// Если email пользователя уже другой или уже подтверждён, возвращает ErrUserNotFound
+func (db *DB) MarkEmailVerified(
+	ctx context.Context,
+	userID uint32,
+	email string,
+) error {
+	const op = "db.pg.MarkEmailVerified"
 
-	err = row.Scan(&isAdmin)
+	tag, err := db.conn(ctx).Exec(ctx, `UPDATE users SET email_verified = TRUE
+		WHERE id = $1 AND email = $2 AND email_verified = FALSE`, userID, email)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return false, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
-		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return nil
+}
 
-		return false, fmt.Errorf("%s: %w", op, err)
+// SaveApp adds or replaces the app.
+func (db *DB) SaveApp(ctx context.Context, app models.App) error {
+	const op = "db.pg.SaveApp"
+
+	if app.SigningAlg == "" {
+		app.SigningAlg = "HS256" // как DEFAULT в миграции
+	}
+
+	_, err := db.conn(ctx).Exec(ctx, `INSERT INTO apps(id, name, secret, signing_alg, token_roles, token_scope,
+			require_verified_email)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, secret = EXCLUDED.secret,
+			signing_alg = EXCLUDED.signing_alg, token_roles = EXCLUDED.token_roles, token_scope = EXCLUDED.token_scope,
+			require_verified_email = EXCLUDED.require_verified_email`,
+		app.ID, app.Name, app.Secret, app.SigningAlg, app.TokenRoles, app.TokenScope, app.RequireVerifiedEmail)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return isAdmin, nil
+	return nil
 }
 
 // App returns app by id.
@@ -125,22 +260,23 @@ func (db *DB) App(
 ) (models.App, error) {
 	const op = "db.pg.App"
 
-	stmt, err := db.data.Prepare("SELECT id, name, secret FROM apps WHERE id = ?")
-	if err != nil {
-		return models.App{}, fmt.Errorf("%s: %w", op, err)
-	}
-
-	row := stmt.QueryRowContext(ctx, appID)
-
 	var app models.App
-	err = row.Scan(&app.ID, &app.Name, &app.Secret)
+	err := db.conn(ctx).QueryRow(ctx, `SELECT id, name, secret, signing_alg, token_roles, token_scope, require_verified_email
+		FROM apps WHERE id = $1`,
+		appID).Scan(&app.ID, &app.Name, &app.Secret, &app.SigningAlg, &app.TokenRoles, &app.TokenScope,
+		&app.RequireVerifiedEmail)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return models.App{}, fmt.Errorf("%s: %w", op, database.ErrAppNotFound)
 		}
-
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return app, nil
 }
+
+// isPgError checks if err is a postgres error with the code
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
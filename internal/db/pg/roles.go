@@ -0,0 +1,155 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// UserRoles returns roles of the user in the app, including global roles.
+// appID = 0 returns roles in all apps.
+func (db *DB) UserRoles(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) ([]models.UserRole, error) {
+	const op = "db.pg.UserRoles"
+
+	if err := db.checkUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := db.conn(ctx).Query(ctx, `SELECT ur.app_id, r.id, r.name,
+			COALESCE(array_agg(p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = $1 AND ($2 = 0 OR ur.app_id IN (0, $2))
+		GROUP BY ur.app_id, r.id, r.name
+		ORDER BY ur.app_id, r.name`, userID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var roles []models.UserRole
+	for rows.Next() {
+		role := models.UserRole{UserID: userID}
+		err := rows.Scan(&role.AppID, &role.Role.ID, &role.Role.Name, &role.Role.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission checks if any role of the user in the app grants the permission.
+func (db *DB) HasPermission(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	permission string,
+) (bool, error) {
+	const op = "db.pg.HasPermission"
+
+	if err := db.checkUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var allowed bool
+	err := db.conn(ctx).QueryRow(ctx, `SELECT EXISTS(
+		SELECT 1 FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = $1 AND ur.app_id IN (0, $2) AND p.name IN ($3, '*'))`,
+		userID, appID, permission).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed, nil
+}
+
+// AssignRole gives the role to the user in the app. Assigning the same role twice is not an error.
+func (db *DB) AssignRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.pg.AssignRole"
+
+	roleID, err := db.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.conn(ctx).Exec(ctx, `INSERT INTO user_roles (user_id, app_id, role_id) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, userID, appID, roleID)
+	if err != nil {
+		if isPgError(err, codeForeignKeyViolation) {
+			return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeRole takes the role from the user in the app.
+func (db *DB) RevokeRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.pg.RevokeRole"
+
+	roleID, err := db.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.conn(ctx).Exec(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND app_id = $2 AND role_id = $3",
+		userID, appID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (db *DB) roleID(ctx context.Context, role string) (uint32, error) {
+	var id uint32
+	err := db.conn(ctx).QueryRow(ctx, "SELECT id FROM roles WHERE name = $1", role).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, database.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// checkUser returns ErrUserNotFound if there is no such user
+func (db *DB) checkUser(ctx context.Context, userID uint32) error {
+	var exists bool
+	err := db.conn(ctx).QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return database.ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveRefreshToken saves hash of the refresh token.
+func (db *DB) SaveRefreshToken(
+	ctx context.Context,
+	token models.RefreshToken,
+) error {
+	const op = "db.pg.SaveRefreshToken"
+
+	_, err := db.conn(ctx).Exec(ctx, `INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, expires_at)
+		VALUES($1, $2, $3, $4, $5)`,
+		token.Hash, token.FamilyID, token.UserID, token.AppID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RefreshToken returns refresh token by its hash.
+func (db *DB) RefreshToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.RefreshToken, error) {
+	const op = "db.pg.RefreshToken"
+
+	var token models.RefreshToken
+	err := db.conn(ctx).QueryRow(ctx, `SELECT id, token_hash, family_id, user_id, app_id, expires_at, used, revoked
+		FROM refresh_tokens WHERE token_hash = $1`, tokenHash).Scan(
+		&token.ID,
+		&token.Hash,
+		&token.FamilyID,
+		&token.UserID,
+		&token.AppID,
+		&token.ExpiresAt,
+		&token.Used,
+		&token.Revoked,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+		}
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// UseRefreshToken marks refresh token as used.
+// If token was already used or revoked, returns ErrTokenUsed.
+func (db *DB) UseRefreshToken(
+	ctx context.Context,
+	tokenID int64,
+) error {
+	const op = "db.pg.UseRefreshToken"
+
+	// Проверка и обновление одним запросом, чтобы два параллельных Refresh
+	// не смогли использовать один токен
+	tag, err := db.conn(ctx).Exec(ctx, `UPDATE refresh_tokens SET used = TRUE
+		WHERE id = $1 AND used = FALSE AND revoked = FALSE`, tokenID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens of the family.
+func (db *DB) RevokeRefreshTokenFamily(
+	ctx context.Context,
+	familyID string,
+) error {
+	const op = "db.pg.RevokeRefreshTokenFamily"
+
+	if _, err := db.conn(ctx).Exec(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = $1", familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveAccessToken saves jti of the issued access token.
+func (db *DB) SaveAccessToken(
+	ctx context.Context,
+	token models.AccessToken,
+) error {
+	const op = "db.pg.SaveAccessToken"
+
+	_, err := db.conn(ctx).Exec(ctx, "INSERT INTO access_tokens(jti, user_id, app_id, expires_at) VALUES($1, $2, $3, $4)",
+		token.ID, token.UserID, token.AppID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeToken adds jti to the denylist until the token expires.
+func (db *DB) RevokeToken(
+	ctx context.Context,
+	tokenID string,
+	expiresAt time.Time,
+) error {
+	const op = "db.pg.RevokeToken"
+
+	_, err := db.conn(ctx).Exec(ctx, `INSERT INTO revoked_tokens(jti, expires_at) VALUES($1, $2)
+		ON CONFLICT (jti) DO NOTHING`, tokenID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens adds all live access tokens of the user to the denylist
+// and revokes his refresh tokens. appID = 0 means all apps.
+func (db *DB) RevokeUserTokens(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) error {
+	const op = "db.pg.RevokeUserTokens"
+
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		_, err := db.conn(ctx).Exec(ctx, `INSERT INTO revoked_tokens(jti, expires_at)
+			SELECT jti, expires_at FROM access_tokens
+			WHERE user_id = $1 AND ($2 = 0 OR app_id = $2) AND expires_at > now()
+			ON CONFLICT (jti) DO NOTHING`, userID, appID)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.conn(ctx).Exec(ctx, `UPDATE refresh_tokens SET revoked = TRUE
+			WHERE user_id = $1 AND ($2 = 0 OR app_id = $2)`, userID, appID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks if jti is in the denylist.
+func (db *DB) IsTokenRevoked(
+	ctx context.Context,
+	tokenID string,
+) (bool, error) {
+	const op = "db.pg.IsTokenRevoked"
+
+	var revoked bool
+	err := db.conn(ctx).QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > now())",
+		tokenID).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// SavePasswordResetToken saves hash of the password reset token.
+func (db *DB) SavePasswordResetToken(
+	ctx context.Context,
+	token models.PasswordResetToken,
+) error {
+	const op = "db.pg.SavePasswordResetToken"
+
+	_, err := db.conn(ctx).Exec(ctx, `INSERT INTO password_reset_tokens(token_hash, user_id, expires_at)
+		VALUES($1, $2, $3)`, token.Hash, token.UserID, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetToken returns password reset token by its hash.
+func (db *DB) PasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.PasswordResetToken, error) {
+	const op = "db.pg.PasswordResetToken"
+
+	var token models.PasswordResetToken
+	err := db.conn(ctx).QueryRow(ctx, `SELECT token_hash, user_id, expires_at
+		FROM password_reset_tokens WHERE token_hash = $1`, tokenHash).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+		}
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return token, nil
+}
+
+// UsePasswordResetToken deletes the token.
+// If token was already used, returns ErrTokenUsed.
+func (db *DB) UsePasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) error {
+	const op = "db.pg.UsePasswordResetToken"
+
+	// Удаление и проверка одним запросом: из двух параллельных сбросов пройдёт один
+	tag, err := db.conn(ctx).Exec(ctx, "DELETE FROM password_reset_tokens WHERE token_hash = $1", tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+
+	return nil
+}
+
+// DeletePasswordResetTokens deletes all password reset tokens of the user.
+func (db *DB) DeletePasswordResetTokens(
+	ctx context.Context,
+	userID uint32,
+) error {
+	const op = "db.pg.DeletePasswordResetTokens"
+
+	if _, err := db.conn(ctx).Exec(ctx, "DELETE FROM password_reset_tokens WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredTokens deletes tokens and denylist entries that are expired anyway.
+func (db *DB) DeleteExpiredTokens(ctx context.Context) error {
+	const op = "db.pg.DeleteExpiredTokens"
+
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at <= now()",
+		"DELETE FROM access_tokens WHERE expires_at <= now()",
+		"DELETE FROM refresh_tokens WHERE expires_at <= now()",
+		"DELETE FROM password_reset_tokens WHERE expires_at <= now()",
+	} {
+		if _, err := db.conn(ctx).Exec(ctx, query); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package pg
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type traceKey struct{}
+
+type traceData struct {
+	sql   string
+	start time.Time
+}
+
+// slowQueryTracer logs queries that took longer than threshold
+type slowQueryTracer struct {
+	log       *slog.Logger
+	threshold time.Duration
+}
+
+func newSlowQueryTracer(log *slog.Logger, threshold time.Duration) *slowQueryTracer {
+	return &slowQueryTracer{
+		log:       log,
+		threshold: threshold,
+	}
+}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceData{sql: data.SQL, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(traceKey{}).(traceData)
+	if !ok {
+		return
+	}
+
+	elapsed := time.Since(trace.start)
+	if elapsed < t.threshold {
+		return
+	}
+
+	// Логгер из контекста запроса, чтобы в записи был request_id
+	// Аргументы не пишутся: там хэши паролей и токенов
+	slogger.FromContext(ctx, t.log).Warn("slow query",
+		slog.String("op", "db.pg.slowQuery"),
+		slog.String("sql", trace.sql),
+		slog.Duration("elapsed", elapsed),
+		slog.String("command", data.CommandTag.String()),
+	)
+}
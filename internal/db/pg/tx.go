@@ -0,0 +1,85 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+
+	maxTxAttempts = 3
+	txRetryDelay  = 10 * time.Millisecond
+)
+
+type txKey struct{}
+
+// querier - общее у пула и транзакции
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// conn returns transaction from ctx or the pool
+func (db *DB) conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.data
+}
+
+// WithTx runs fn in a serializable transaction. Storage methods called with ctx passed to fn use it.
+// Serialization failures and deadlocks are retried, so fn may run several times
+// and must not have side effects outside the storage
+func (db *DB) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Вложенная транзакция - часть внешней
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		if err = db.runTx(ctx, fn); err == nil || !isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * txRetryDelay):
+		}
+	}
+
+	return err
+}
+
+func (db *DB) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	const op = "db.pg.WithTx"
+
+	tx, err := db.data.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// isRetryable checks if the transaction failed only because of concurrent transactions
+func isRetryable(err error) bool {
+	return isPgError(err, codeSerializationFailure) || isPgError(err, codeDeadlockDetected)
+}
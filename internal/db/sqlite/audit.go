@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"grpc_service/internal/domain/models"
+)
+
+// SaveAuditEvent appends the event to the audit log.
+func (db *DB) SaveAuditEvent(
+	ctx context.Context,
+	event models.AuditEvent,
+) error {
+	const op = "db.sqlite.SaveAuditEvent"
+
+	_, err := db.conn(ctx).ExecContext(ctx, "INSERT INTO audit_events(type, user_id, ip, created_at) VALUES(?, ?, ?, ?)",
+		event.Type, event.UserID, event.IP, unix(event.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// AuditEvents returns events of the user in the order they were saved.
+func (db *DB) AuditEvents(
+	ctx context.Context,
+	userID uint32,
+) ([]models.AuditEvent, error) {
+	const op = "db.sqlite.AuditEvents"
+
+	rows, err := db.conn(ctx).QueryContext(ctx, `SELECT id, type, user_id, ip, created_at
+		FROM audit_events WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var (
+			event     models.AuditEvent
+			createdAt int64
+		)
+		if err := rows.Scan(&event.ID, &event.Type, &event.UserID, &event.IP, &createdAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		event.CreatedAt = fromUnix(createdAt)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
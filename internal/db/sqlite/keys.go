@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// SaveSigningKey saves a new signing key.
+func (db *DB) SaveSigningKey(
+	ctx context.Context,
+	key models.SigningKey,
+) error {
+	const op = "db.sqlite.SaveSigningKey"
+
+	_, err := db.conn(ctx).ExecContext(ctx, `INSERT INTO signing_keys(kid, app_id, alg, private_key, public_key, created_at)
+		VALUES(?, ?, ?, ?, ?, ?)`,
+		key.ID, key.AppID, key.Algorithm, key.PrivateKey, key.PublicKey, unix(key.CreatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SigningKeys returns all keys that are not expired yet.
+func (db *DB) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "db.sqlite.SigningKeys"
+
+	// rowid - порядок вставки для ключей, созданных в одну секунду
+	rows, err := db.conn(ctx).QueryContext(ctx, `SELECT kid, app_id, alg, private_key, public_key, created_at, expires_at
+		FROM signing_keys WHERE expires_at IS NULL OR expires_at > ?
+		ORDER BY created_at, rowid`, unix(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var (
+			key       models.SigningKey
+			createdAt int64
+			expiresAt sql.NullInt64
+		)
+		err := rows.Scan(
+			&key.ID,
+			&key.AppID,
+			&key.Algorithm,
+			&key.PrivateKey,
+			&key.PublicKey,
+			&createdAt,
+			&expiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		key.CreatedAt = fromUnix(createdAt)
+		if expiresAt.Valid {
+			key.ExpiresAt = fromUnix(expiresAt.Int64)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RetireSigningKey sets time after which the key is not published anymore.
+func (db *DB) RetireSigningKey(
+	ctx context.Context,
+	keyID string,
+	expiresAt time.Time,
+) error {
+	const op = "db.sqlite.RetireSigningKey"
+
+	_, err := db.conn(ctx).ExecContext(ctx, "UPDATE signing_keys SET expires_at = ? WHERE kid = ? AND expires_at IS NULL",
+		unix(expiresAt), keyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSigningKeys deletes keys that are not published anymore.
+func (db *DB) DeleteExpiredSigningKeys(ctx context.Context) error {
+	const op = "db.sqlite.DeleteExpiredSigningKeys"
+
+	if _, err := db.conn(ctx).ExecContext(ctx, "DELETE FROM signing_keys WHERE expires_at <= ?", unix(time.Now())); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
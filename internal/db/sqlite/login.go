@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+const loginAttemptsColumns = "key, failures, last_failure, locked_until, expires_at"
+
+// LoginAttempts returns failed login attempts by key.
+// Если записи нет, возвращаются нулевые попытки без ошибки
+func (db *DB) LoginAttempts(
+	ctx context.Context,
+	key string,
+) (models.LoginAttempts, error) {
+	const op = "db.sqlite.LoginAttempts"
+
+	attempts, err := scanLoginAttempts(db.conn(ctx).QueryRowContext(ctx,
+		`SELECT `+loginAttemptsColumns+` FROM login_attempts WHERE key = ?`, key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.LoginAttempts{Key: key}, nil
+		}
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// AddLoginFailure counts failed attempt at the given time.
+// Если запись истекла, счётчик и блокировка начинаются заново
+func (db *DB) AddLoginFailure(
+	ctx context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (models.LoginAttempts, error) {
+	const op = "db.sqlite.AddLoginFailure"
+
+	attempts, err := scanLoginAttempts(db.conn(ctx).QueryRowContext(ctx, `INSERT INTO login_attempts
+			(key, failures, last_failure, locked_until, expires_at)
+		VALUES (?1, 1, ?2, NULL, ?3)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN expires_at <= ?2 THEN 1 ELSE failures + 1 END,
+			last_failure = ?2,
+			locked_until = CASE WHEN expires_at <= ?2 THEN NULL ELSE locked_until END,
+			expires_at = CASE WHEN expires_at <= ?2 THEN ?3 ELSE MAX(expires_at, ?3) END
+		RETURNING `+loginAttemptsColumns,
+		key, unix(at), unix(at.Add(window))))
+	if err != nil {
+		return models.LoginAttempts{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// LockLogin locks the key until the given time and resets its failures.
+// Нет записи - ничего не делает
+func (db *DB) LockLogin(
+	ctx context.Context,
+	key string,
+	until time.Time,
+) error {
+	const op = "db.sqlite.LockLogin"
+
+	_, err := db.conn(ctx).ExecContext(ctx, `UPDATE login_attempts
+		SET failures = 0, locked_until = ?2, expires_at = MAX(expires_at, ?2)
+		WHERE key = ?1`, key, unix(until))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetLoginAttempts forgets failures and lock of the key.
+func (db *DB) ResetLoginAttempts(
+	ctx context.Context,
+	key string,
+) error {
+	const op = "db.sqlite.ResetLoginAttempts"
+
+	if _, err := db.conn(ctx).ExecContext(ctx, "DELETE FROM login_attempts WHERE key = ?", key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredLoginAttempts deletes attempts that are not counted anyway.
+func (db *DB) DeleteExpiredLoginAttempts(ctx context.Context) error {
+	const op = "db.sqlite.DeleteExpiredLoginAttempts"
+
+	_, err := db.conn(ctx).ExecContext(ctx, "DELETE FROM login_attempts WHERE expires_at <= ?", unix(time.Now()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func scanLoginAttempts(row *sql.Row) (models.LoginAttempts, error) {
+	var (
+		attempts               models.LoginAttempts
+		lastFailure, expiresAt int64
+		lockedUntil            sql.NullInt64
+	)
+	if err := row.Scan(
+		&attempts.Key,
+		&attempts.Failures,
+		&lastFailure,
+		&lockedUntil,
+		&expiresAt,
+	); err != nil {
+		return models.LoginAttempts{}, err
+	}
+	attempts.LastFailure = fromUnix(lastFailure)
+	attempts.ExpiresAt = fromUnix(expiresAt)
+	if lockedUntil.Valid {
+		attempts.LockedUntil = fromUnix(lockedUntil.Int64)
+	}
+
+	return attempts, nil
+}
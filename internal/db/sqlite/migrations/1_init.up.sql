@@ -0,0 +1,90 @@
+-- Схема как у postgres после migrations/8_*, время хранится в unix секундах
+CREATE TABLE IF NOT EXISTS users
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE,
+    pass_hash BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS apps
+(
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    secret TEXT NOT NULL UNIQUE,
+    signing_alg TEXT NOT NULL DEFAULT 'HS256',
+    token_roles INTEGER NOT NULL DEFAULT 0,
+    token_scope INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash BLOB NOT NULL UNIQUE,
+    family_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    expires_at INTEGER NOT NULL,
+    used INTEGER NOT NULL DEFAULT 0,
+    revoked INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS index_refresh_tokens_family ON refresh_tokens (family_id);
+
+-- expires_at IS NULL - текущий ключ, после ротации ключ публикуется до expires_at
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    kid TEXT PRIMARY KEY,
+    app_id INTEGER NOT NULL DEFAULT 0,
+    alg TEXT NOT NULL,
+    private_key BLOB NOT NULL,
+    public_key BLOB NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS index_signing_keys_app ON signing_keys (app_id, alg);
+
+CREATE TABLE IF NOT EXISTS access_tokens
+(
+    jti TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_access_tokens_user ON access_tokens (user_id, app_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_revoked_tokens_expires ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS roles
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+-- app_id = 0: роль действует во всех приложениях
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL DEFAULT 0,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, app_id, role_id)
+);
+
+-- admin может всё
+INSERT OR IGNORE INTO roles (name) VALUES ('admin');
+INSERT OR IGNORE INTO permissions (name) VALUES ('*');
+INSERT OR IGNORE INTO role_permissions (role_id, permission_id)
+    SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = '*';
@@ -0,0 +1,10 @@
+-- key: "email:<email>" или "ip:<ip>", время - unix секунды
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure INTEGER NOT NULL,
+    locked_until INTEGER,
+    expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_login_attempts_expires on login_attempts (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN require_verified_email INTEGER NOT NULL DEFAULT 0;
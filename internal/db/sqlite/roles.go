@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+)
+
+// UserRoles returns roles of the user in the app, including global roles.
+// appID = 0 returns roles in all apps.
+func (db *DB) UserRoles(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) ([]models.UserRole, error) {
+	const op = "db.sqlite.UserRoles"
+
+	if err := db.checkUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// array_agg в SQLite нет: по строке на право, роли собираются ниже
+	rows, err := db.conn(ctx).QueryContext(ctx, `SELECT ur.app_id, r.id, r.name, p.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = ? AND (? = 0 OR ur.app_id IN (0, ?))
+		ORDER BY ur.app_id, r.name, p.name`, userID, appID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var roles []models.UserRole
+	for rows.Next() {
+		var (
+			roleAppID  uint32
+			role       models.Role
+			permission sql.NullString
+		)
+		if err := rows.Scan(&roleAppID, &role.ID, &role.Name, &permission); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		last := len(roles) - 1
+		if last < 0 || roles[last].AppID != roleAppID || roles[last].Role.ID != role.ID {
+			role.Permissions = []string{}
+			roles = append(roles, models.UserRole{UserID: userID, AppID: roleAppID, Role: role})
+			last++
+		}
+		if permission.Valid {
+			roles[last].Role.Permissions = append(roles[last].Role.Permissions, permission.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission checks if any role of the user in the app grants the permission.
+func (db *DB) HasPermission(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	permission string,
+) (bool, error) {
+	const op = "db.sqlite.HasPermission"
+
+	if err := db.checkUser(ctx, userID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var allowed bool
+	err := db.conn(ctx).QueryRowContext(ctx, `SELECT EXISTS(
+		SELECT 1 FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE ur.user_id = ? AND ur.app_id IN (0, ?) AND p.name IN (?, '*'))`,
+		userID, appID, permission).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed, nil
+}
+
+// AssignRole gives the role to the user in the app. Assigning the same role twice is not an error.
+func (db *DB) AssignRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.sqlite.AssignRole"
+
+	roleID, err := db.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Проверка явная: ошибка внешнего ключа в SQLite не говорит, какой ключ нарушен
+	if err := db.checkUser(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.conn(ctx).ExecContext(ctx, "INSERT OR IGNORE INTO user_roles (user_id, app_id, role_id) VALUES (?, ?, ?)",
+		userID, appID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeRole takes the role from the user in the app.
+func (db *DB) RevokeRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "db.sqlite.RevokeRole"
+
+	roleID, err := db.roleID(ctx, role)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = db.conn(ctx).ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = ? AND app_id = ? AND role_id = ?",
+		userID, appID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (db *DB) roleID(ctx context.Context, role string) (uint32, error) {
+	var id uint32
+	err := db.conn(ctx).QueryRowContext(ctx, "SELECT id FROM roles WHERE name = ?", role).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, database.ErrRoleNotFound
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// checkUser returns ErrUserNotFound if there is no such user
+func (db *DB) checkUser(ctx context.Context, userID uint32) error {
+	var exists bool
+	err := db.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return database.ErrUserNotFound
+	}
+	return nil
+}
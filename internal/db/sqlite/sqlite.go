@@ -0,0 +1,352 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"net/url"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Миграции SQLite свои (типы и синтаксис отличаются от postgres) и применяются при запуске
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type DB struct {
+	data *sql.DB
+}
+
+func (db *DB) Stop() error {
+	return db.data.Close()
+}
+
+// Ping checks that the database is reachable
+func (db *DB) Ping(ctx context.Context) error {
+	const op = "db.sqlite.Ping"
+
+	if err := db.data.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// New opens SQLite database file and applies migrations
+func New(path string) (*DB, error) {
+	const op = "db.sqlite.New"
+
+	// Внешние ключи в SQLite по умолчанию выключены,
+	// busy_timeout - чтобы параллельные записи ждали, а не падали с "database is locked"
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := migrateUp(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &DB{
+		data: db,
+	}, nil
+}
+
+func migrateUp(db *sql.DB) error {
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+
+	driver, err := migratesqlite.WithInstance(db, &migratesqlite.Config{})
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	return nil
+}
+
+func (db *DB) SaveUser(
+	ctx context.Context,
+	email string,
+	passHash []byte,
+) (uint32, error) {
+	const op = "db.sqlite.SaveUser"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, "INSERT INTO users(email, pass_hash) VALUES(?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, email, passHash)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return 0, fmt.Errorf("%s: %w", op, database.ErrUserExists)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// В SQLite LastInsertId относится к соединению, поэтому параллельные вставки не мешают
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uint32(id), nil
+}
+
+// User returns user by email.
+func (db *DB) User(
+	ctx context.Context,
+	email string,
+) (models.User, error) {
+	const op = "db.sqlite.User"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, "SELECT id, email, pass_hash, email_verified FROM users WHERE email = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var user models.User
+	err = stmt.QueryRowContext(ctx, email).Scan(&user.ID, &user.Email, &user.PassHash, &user.EmailVerified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// UserByID returns user by id.
+func (db *DB) UserByID(
+	ctx context.Context,
+	userID uint32,
+) (models.User, error) {
+	const op = "db.sqlite.UserByID"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, "SELECT id, email, pass_hash, email_verified FROM users WHERE id = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var user models.User
+	err = stmt.QueryRowContext(ctx, userID).Scan(&user.ID, &user.Email, &user.PassHash, &user.EmailVerified)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// UpdatePassHash replaces password hash of the user.
+func (db *DB) UpdatePassHash(
+	ctx context.Context,
+	userID uint32,
+	passHash []byte,
+) error {
+	const op = "db.sqlite.UpdatePassHash"
+
+	res, err := db.conn(ctx).ExecContext(ctx, "UPDATE users SET pass_hash = ? WHERE id = ?", passHash, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// ReplacePassHash replaces password hash of the user only if it is still oldHash.
+// Хэш уже другой или пользователя нет - ErrUserNotFound
+func (db *DB) ReplacePassHash(
+	ctx context.Context,
+	userID uint32,
+	oldHash []byte,
+	newHash []byte,
+) error {
+	const op = "db.sqlite.ReplacePassHash"
+
+	res, err := db.conn(ctx).ExecContext(ctx, "UPDATE users SET pass_hash = ? WHERE id = ? AND pass_hash = ?",
+		newHash, userID, oldHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// UpdateEmail changes email of the user, если текущий email всё ещё oldEmail.
+// Новый email не подтверждён. Email занят - ErrUserExists, пользователя нет или email уже другой - ErrUserNotFound
+func (db *DB) UpdateEmail(
+	ctx context.Context,
+	userID uint32,
+	oldEmail string,
+	newEmail string,
+) error {
+	const op = "db.sqlite.UpdateEmail"
+
+	res, err := db.conn(ctx).ExecContext(ctx, `UPDATE users SET email = ?, email_verified = 0
+		WHERE id = ? AND email = ?`, newEmail, userID, oldEmail)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", op, database.ErrUserExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// MarkEmailVerified marks email of the user as verified.
+// Если email пользователя уже другой или уже подтверждён, возвращает ErrUserNotFound
+func (db *DB) MarkEmailVerified(
+	ctx context.Context,
+	userID uint32,
+	email string,
+) error {
+	const op = "db.sqlite.MarkEmailVerified"
+
+	res, err := db.conn(ctx).ExecContext(ctx, `UPDATE users SET email_verified = 1
+		WHERE id = ? AND email = ? AND email_verified = 0`, userID, email)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrUserNotFound)
+	}
+
+	return nil
+}
+
+// SaveApp adds or replaces the app.
+func (db *DB) SaveApp(ctx context.Context, app models.App) error {
+	const op = "db.sqlite.SaveApp"
+
+	if app.SigningAlg == "" {
+		app.SigningAlg = "HS256" // как DEFAULT в миграции
+	}
+
+	_, err := db.conn(ctx).ExecContext(ctx, `INSERT INTO apps(id, name, secret, signing_alg, token_roles, token_scope,
+			require_verified_email)
+		VALUES(?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, secret = excluded.secret,
+			signing_alg = excluded.signing_alg, token_roles = excluded.token_roles, token_scope = excluded.token_scope,
+			require_verified_email = excluded.require_verified_email`,
+		app.ID, app.Name, app.Secret, app.SigningAlg, app.TokenRoles, app.TokenScope, app.RequireVerifiedEmail)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// App returns app by id.
+func (db *DB) App(
+	ctx context.Context,
+	appID uint32,
+) (models.App, error) {
+	const op = "db.sqlite.App"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, `SELECT id, name, secret, signing_alg, token_roles, token_scope, require_verified_email
+		FROM apps WHERE id = ?`)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var app models.App
+	err = stmt.QueryRowContext(ctx, appID).Scan(
+		&app.ID,
+		&app.Name,
+		&app.Secret,
+		&app.SigningAlg,
+		&app.TokenRoles,
+		&app.TokenScope,
+		&app.RequireVerifiedEmail,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.App{}, fmt.Errorf("%s: %w", op, database.ErrAppNotFound)
+		}
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// Время хранится в unix секундах: строки времени в SQLite сравниваются как текст
+// и ломаются на разных часовых поясах
+
+func unix(t time.Time) int64 {
+	return t.Unix()
+}
+
+func fromUnix(sec int64) time.Time {
+	return time.Unix(sec, 0)
+}
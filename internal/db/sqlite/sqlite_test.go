@@ -0,0 +1,18 @@
+package sqlite
+
+import (
+	"grpc_service/internal/db/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Storage {
+		db, err := New(filepath.Join(t.TempDir(), "sso.db"))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		t.Cleanup(func() { db.Stop() })
+		return db
+	})
+}
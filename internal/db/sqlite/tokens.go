@@ -0,0 +1,297 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"time"
+)
+
+// SaveRefreshToken saves hash of the refresh token.
+func (db *DB) SaveRefreshToken(
+	ctx context.Context,
+	token models.RefreshToken,
+) error {
+	const op = "db.sqlite.SaveRefreshToken"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, `INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, expires_at)
+		VALUES(?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, token.Hash, token.FamilyID, token.UserID, token.AppID, unix(token.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RefreshToken returns refresh token by its hash.
+func (db *DB) RefreshToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.RefreshToken, error) {
+	const op = "db.sqlite.RefreshToken"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, `SELECT id, token_hash, family_id, user_id, app_id, expires_at, used, revoked
+		FROM refresh_tokens WHERE token_hash = ?`)
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	var (
+		token     models.RefreshToken
+		expiresAt int64
+	)
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(
+		&token.ID,
+		&token.Hash,
+		&token.FamilyID,
+		&token.UserID,
+		&token.AppID,
+		&expiresAt,
+		&token.Used,
+		&token.Revoked,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+		}
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token.ExpiresAt = fromUnix(expiresAt)
+
+	return token, nil
+}
+
+// UseRefreshToken marks refresh token as used.
+// If token was already used or revoked, returns ErrTokenUsed.
+func (db *DB) UseRefreshToken(
+	ctx context.Context,
+	tokenID int64,
+) error {
+	const op = "db.sqlite.UseRefreshToken"
+
+	stmt, err := db.conn(ctx).PrepareContext(ctx, "UPDATE refresh_tokens SET used = 1 WHERE id = ? AND used = 0 AND revoked = 0")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, tokenID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens of the family.
+func (db *DB) RevokeRefreshTokenFamily(
+	ctx context.Context,
+	familyID string,
+) error {
+	const op = "db.sqlite.RevokeRefreshTokenFamily"
+
+	if _, err := db.conn(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET revoked = 1 WHERE family_id = ?", familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveAccessToken saves jti of the issued access token.
+func (db *DB) SaveAccessToken(
+	ctx context.Context,
+	token models.AccessToken,
+) error {
+	const op = "db.sqlite.SaveAccessToken"
+
+	_, err := db.conn(ctx).ExecContext(ctx, "INSERT INTO access_tokens(jti, user_id, app_id, expires_at) VALUES(?, ?, ?, ?)",
+		token.ID, token.UserID, token.AppID, unix(token.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeToken adds jti to the denylist until the token expires.
+func (db *DB) RevokeToken(
+	ctx context.Context,
+	tokenID string,
+	expiresAt time.Time,
+) error {
+	const op = "db.sqlite.RevokeToken"
+
+	_, err := db.conn(ctx).ExecContext(ctx, "INSERT OR IGNORE INTO revoked_tokens(jti, expires_at) VALUES(?, ?)",
+		tokenID, unix(expiresAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens adds all live access tokens of the user to the denylist
+// and revokes his refresh tokens. appID = 0 means all apps.
+func (db *DB) RevokeUserTokens(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) error {
+	const op = "db.sqlite.RevokeUserTokens"
+
+	err := db.WithTx(ctx, func(ctx context.Context) error {
+		_, err := db.conn(ctx).ExecContext(ctx, `INSERT OR IGNORE INTO revoked_tokens(jti, expires_at)
+			SELECT jti, expires_at FROM access_tokens
+			WHERE user_id = ? AND (? = 0 OR app_id = ?) AND expires_at > ?`,
+			userID, appID, appID, unix(time.Now()))
+		if err != nil {
+			return err
+		}
+
+		_, err = db.conn(ctx).ExecContext(ctx, `UPDATE refresh_tokens SET revoked = 1
+			WHERE user_id = ? AND (? = 0 OR app_id = ?)`, userID, appID, appID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// IsTokenRevoked checks if jti is in the denylist.
+func (db *DB) IsTokenRevoked(
+	ctx context.Context,
+	tokenID string,
+) (bool, error) {
+	const op = "db.sqlite.IsTokenRevoked"
+
+	var revoked bool
+	err := db.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ? AND expires_at > ?)",
+		tokenID, unix(time.Now())).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revoked, nil
+}
+
+// SavePasswordResetToken saves hash of the password reset token.
+func (db *DB) SavePasswordResetToken(
+	ctx context.Context,
+	token models.PasswordResetToken,
+) error {
+	const op = "db.sqlite.SavePasswordResetToken"
+
+	_, err := db.conn(ctx).ExecContext(ctx, `INSERT INTO password_reset_tokens(token_hash, user_id, expires_at)
+		VALUES(?, ?, ?)`, token.Hash, token.UserID, unix(token.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetToken returns password reset token by its hash.
+func (db *DB) PasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) (models.PasswordResetToken, error) {
+	const op = "db.sqlite.PasswordResetToken"
+
+	var (
+		token     models.PasswordResetToken
+		expiresAt int64
+	)
+	err := db.conn(ctx).QueryRowContext(ctx, `SELECT token_hash, user_id, expires_at
+		FROM password_reset_tokens WHERE token_hash = ?`, tokenHash).Scan(
+		&token.Hash,
+		&token.UserID,
+		&expiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, database.ErrTokenNotFound)
+		}
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token.ExpiresAt = fromUnix(expiresAt)
+
+	return token, nil
+}
+
+// UsePasswordResetToken deletes the token.
+// If token was already used, returns ErrTokenUsed.
+func (db *DB) UsePasswordResetToken(
+	ctx context.Context,
+	tokenHash []byte,
+) error {
+	const op = "db.sqlite.UsePasswordResetToken"
+
+	// Удаление и проверка одним запросом: из двух параллельных сбросов пройдёт один
+	res, err := db.conn(ctx).ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, database.ErrTokenUsed)
+	}
+
+	return nil
+}
+
+// DeletePasswordResetTokens deletes all password reset tokens of the user.
+func (db *DB) DeletePasswordResetTokens(
+	ctx context.Context,
+	userID uint32,
+) error {
+	const op = "db.sqlite.DeletePasswordResetTokens"
+
+	if _, err := db.conn(ctx).ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredTokens deletes tokens and denylist entries that are expired anyway.
+func (db *DB) DeleteExpiredTokens(ctx context.Context) error {
+	const op = "db.sqlite.DeleteExpiredTokens"
+
+	now := unix(time.Now())
+	for _, query := range []string{
+		"DELETE FROM revoked_tokens WHERE expires_at <= ?",
+		"DELETE FROM access_tokens WHERE expires_at <= ?",
+		"DELETE FROM refresh_tokens WHERE expires_at <= ?",
+		"DELETE FROM password_reset_tokens WHERE expires_at <= ?",
+	} {
+		if _, err := db.conn(ctx).ExecContext(ctx, query, now); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,1161 @@
+// Package storagetest is a conformance suite for storage backends.
+// Каждый backend запускает Run в своих тестах, так поведение всех хранилищ одинаково
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	database "grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/services/auth"
+	"grpc_service/internal/services/cleanup"
+	"grpc_service/internal/services/health"
+	"grpc_service/internal/services/keys"
+	"grpc_service/internal/services/limiter"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Storage - всё, что сервисы ждут от хранилища, и SaveApp для подготовки данных
+type Storage interface {
+	auth.UserSaver
+	auth.UserProvider
+	auth.AppProvider
+	auth.RoleSaver
+	auth.TokenStorage
+	auth.Transactor
+	keys.KeyStorage
+	limiter.Storage
+	cleanup.Storage
+	health.Pinger
+	auth.AuditLog
+	SaveApp(ctx context.Context, app models.App) error
+	AuditEvents(ctx context.Context, userID uint32) ([]models.AuditEvent, error)
+}
+
+// NewStorage returns empty storage. Cleanup, if needed, is registered with t.Cleanup
+type NewStorage func(t *testing.T) Storage
+
+const appID = 1
+
+// Run runs the suite against storage returned by newStorage
+// Каждый подтест получает своё пустое хранилище
+func Run(t *testing.T, newStorage NewStorage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Storage)
+	}{
+		{"Ping", testPing},
+		{"SaveUser", testSaveUser},
+		{"UserNotFound", testUserNotFound},
+		{"DuplicateUser", testDuplicateUser},
+		{"UpdatePassHash", testUpdatePassHash},
+		{"ReplacePassHash", testReplacePassHash},
+		{"MarkEmailVerified", testMarkEmailVerified},
+		{"UpdateEmail", testUpdateEmail},
+		{"App", testApps},
+		{"Admin", testAdmin},
+		{"Roles", testRoles},
+		{"RefreshTokens", testRefreshTokens},
+		{"RevokeTokens", testRevokeTokens},
+		{"DeleteExpiredTokens", testDeleteExpiredTokens},
+		{"PasswordResetTokens", testPasswordResetTokens},
+		{"AuditEvents", testAuditEvents},
+		{"SigningKeys", testSigningKeys},
+		{"LoginAttempts", testLoginAttempts},
+		{"LoginAttemptsExpire", testLoginAttemptsExpire},
+		{"ConcurrentSaveUser", testConcurrentSaveUser},
+		{"ConcurrentDuplicateUser", testConcurrentDuplicateUser},
+		{"ConcurrentUpdateEmail", testConcurrentUpdateEmail},
+		{"ConcurrentUseRefreshToken", testConcurrentUseRefreshToken},
+		{"ConcurrentUsePasswordResetToken", testConcurrentUsePasswordResetToken},
+		{"ConcurrentLoginFailure", testConcurrentLoginFailure},
+		{"TxCommit", testTxCommit},
+		{"TxRollback", testTxRollback},
+		{"ConcurrentTx", testConcurrentTx},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage(t)
+			if err := s.SaveApp(context.Background(), models.App{ID: appID, Name: "test", Secret: "test-secret"}); err != nil {
+				t.Fatalf("SaveApp: %v", err)
+			}
+			tt.test(t, s)
+		})
+	}
+}
+
+func saveUser(t *testing.T, s Storage, email string) uint32 {
+	t.Helper()
+
+	id, err := s.SaveUser(context.Background(), email, []byte("hash of "+email))
+	if err != nil {
+		t.Fatalf("SaveUser(%s): %v", email, err)
+	}
+	if id == 0 {
+		t.Fatalf("SaveUser(%s) returned id 0", email)
+	}
+	return id
+}
+
+func testPing(t *testing.T, s Storage) {
+	if err := s.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
+
+func testSaveUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	first := saveUser(t, s, "first@example.com")
+	second := saveUser(t, s, "second@example.com")
+	if first == second {
+		t.Fatalf("both users got id %d", first)
+	}
+
+	user, err := s.User(ctx, "second@example.com")
+	if err != nil {
+		t.Fatalf("User: %v", err)
+	}
+	if user.ID != second || user.Email != "second@example.com" || string(user.PassHash) != "hash of second@example.com" {
+		t.Errorf("User = %+v, want id %d and saved email and hash", user, second)
+	}
+
+	user, err = s.UserByID(ctx, first)
+	if err != nil {
+		t.Fatalf("UserByID: %v", err)
+	}
+	if user.ID != first || user.Email != "first@example.com" {
+		t.Errorf("UserByID = %+v, want id %d, first@example.com", user, first)
+	}
+}
+
+func testUserNotFound(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	saveUser(t, s, "user@example.com")
+
+	if _, err := s.User(ctx, "other@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("User error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if _, err := s.UserByID(ctx, 100500); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("UserByID error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if _, err := s.UserRoles(ctx, 100500, appID); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("UserRoles error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if _, err := s.HasPermission(ctx, 100500, appID, "posts:read"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("HasPermission error = %v, want %v", err, database.ErrUserNotFound)
+	}
+}
+
+func testDuplicateUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "user@example.com")
+
+	if _, err := s.SaveUser(ctx, "user@example.com", []byte("other hash")); !errors.Is(err, database.ErrUserExists) {
+		t.Fatalf("SaveUser error = %v, want %v", err, database.ErrUserExists)
+	}
+
+	user, err := s.User(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("User: %v", err)
+	}
+	if user.ID != id || string(user.PassHash) != "hash of user@example.com" {
+		t.Errorf("User = %+v, duplicate must not change the saved user", user)
+	}
+}
+
+func testUpdatePassHash(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "user@example.com")
+	other := saveUser(t, s, "other@example.com")
+
+	if err := s.UpdatePassHash(ctx, id, []byte("new hash")); err != nil {
+		t.Fatalf("UpdatePassHash: %v", err)
+	}
+
+	user, err := s.User(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("User: %v", err)
+	}
+	if string(user.PassHash) != "new hash" {
+		t.Errorf("PassHash = %q, want new hash", user.PassHash)
+	}
+
+	user, err = s.UserByID(ctx, other)
+	if err != nil {
+		t.Fatalf("UserByID: %v", err)
+	}
+	if string(user.PassHash) != "hash of other@example.com" {
+		t.Errorf("PassHash of other user = %q, must not change", user.PassHash)
+	}
+
+	if err := s.UpdatePassHash(ctx, 100500, []byte("hash")); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("UpdatePassHash error = %v, want %v", err, database.ErrUserNotFound)
+	}
+}
+
+func testReplacePassHash(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "user@example.com")
+
+	if err := s.ReplacePassHash(ctx, id, []byte("hash of user@example.com"), []byte("rehashed")); err != nil {
+		t.Fatalf("ReplacePassHash: %v", err)
+	}
+	// Старый хэш уже заменён: повтор, как и rehash после сброса пароля, ничего не меняет
+	err := s.ReplacePassHash(ctx, id, []byte("hash of user@example.com"), []byte("stale"))
+	if !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("ReplacePassHash of replaced hash: err = %v, want %v", err, database.ErrUserNotFound)
+	}
+
+	user, err := s.UserByID(ctx, id)
+	if err != nil {
+		t.Fatalf("UserByID: %v", err)
+	}
+	if string(user.PassHash) != "rehashed" {
+		t.Errorf("PassHash = %q, want rehashed", user.PassHash)
+	}
+
+	if err := s.ReplacePassHash(ctx, 100500, []byte("hash"), []byte("new")); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("ReplacePassHash of unknown user: err = %v, want %v", err, database.ErrUserNotFound)
+	}
+}
+
+func testMarkEmailVerified(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "user@example.com")
+	other := saveUser(t, s, "other@example.com")
+
+	if user, err := s.UserByID(ctx, id); err != nil || user.EmailVerified {
+		t.Fatalf("new user = %+v, %v, want unverified", user, err)
+	}
+
+	// Email не совпадает - ссылка была выдана на старый адрес
+	if err := s.MarkEmailVerified(ctx, id, "other@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("MarkEmailVerified with other email error = %v, want %v", err, database.ErrUserNotFound)
+	}
+
+	if err := s.MarkEmailVerified(ctx, id, "user@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+	if user, err := s.User(ctx, "user@example.com"); err != nil || !user.EmailVerified {
+		t.Errorf("User = %+v, %v, want verified", user, err)
+	}
+	if user, err := s.UserByID(ctx, other); err != nil || user.EmailVerified {
+		t.Errorf("other user = %+v, %v, must stay unverified", user, err)
+	}
+
+	// Повторно подтвердить нельзя, так ссылка одноразовая
+	if err := s.MarkEmailVerified(ctx, id, "user@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("second MarkEmailVerified error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if err := s.MarkEmailVerified(ctx, 100500, "user@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("MarkEmailVerified of unknown user error = %v, want %v", err, database.ErrUserNotFound)
+	}
+}
+
+func testUpdateEmail(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "user@example.com")
+	saveUser(t, s, "other@example.com")
+	if err := s.MarkEmailVerified(ctx, id, "user@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+
+	if err := s.UpdateEmail(ctx, id, "user@example.com", "other@example.com"); !errors.Is(err, database.ErrUserExists) {
+		t.Errorf("UpdateEmail to taken email error = %v, want %v", err, database.ErrUserExists)
+	}
+	if err := s.UpdateEmail(ctx, id, "wrong@example.com", "new@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("UpdateEmail with wrong old email error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if err := s.UpdateEmail(ctx, 100500, "user@example.com", "new@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("UpdateEmail of unknown user error = %v, want %v", err, database.ErrUserNotFound)
+	}
+
+	if err := s.UpdateEmail(ctx, id, "user@example.com", "new@example.com"); err != nil {
+		t.Fatalf("UpdateEmail: %v", err)
+	}
+
+	user, err := s.User(ctx, "new@example.com")
+	if err != nil {
+		t.Fatalf("User: %v", err)
+	}
+	if user.ID != id || user.EmailVerified || string(user.PassHash) != "hash of user@example.com" {
+		t.Errorf("User = %+v, want id %d, unverified, same hash", user, id)
+	}
+	if _, err := s.User(ctx, "user@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("User by old email error = %v, want %v", err, database.ErrUserNotFound)
+	}
+
+	// Старый email освободился
+	saveUser(t, s, "user@example.com")
+}
+
+func testApps(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	app, err := s.App(ctx, appID)
+	if err != nil {
+		t.Fatalf("App: %v", err)
+	}
+	if app.Name != "test" || app.Secret != "test-secret" || app.SigningAlg != "HS256" {
+		t.Errorf("App = %+v, want test app with default HS256", app)
+	}
+
+	want := models.App{
+		ID: 2, Name: "other", Secret: "other-secret", SigningAlg: "EdDSA", TokenRoles: true, TokenScope: true,
+		RequireVerifiedEmail: true,
+	}
+	if err := s.SaveApp(ctx, want); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+	if app, err := s.App(ctx, 2); err != nil || app != want {
+		t.Errorf("App = %+v, %v, want %+v", app, err, want)
+	}
+
+	if _, err := s.App(ctx, 100500); !errors.Is(err, database.ErrAppNotFound) {
+		t.Errorf("App error = %v, want %v", err, database.ErrAppNotFound)
+	}
+}
+
+func testAdmin(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	admin := saveUser(t, s, "admin@example.com")
+	user := saveUser(t, s, "user@example.com")
+
+	// Глобальная роль действует во всех приложениях
+	if err := s.AssignRole(ctx, admin, 0, models.RoleAdmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	// Повторное назначение не ошибка
+	if err := s.AssignRole(ctx, admin, 0, models.RoleAdmin); err != nil {
+		t.Fatalf("AssignRole twice: %v", err)
+	}
+
+	for _, app := range []uint32{0, appID, 2} {
+		ok, err := s.HasPermission(ctx, admin, app, "anything")
+		if err != nil {
+			t.Fatalf("HasPermission: %v", err)
+		}
+		if !ok {
+			t.Errorf("admin has no permission in app %d", app)
+		}
+	}
+
+	ok, err := s.HasPermission(ctx, user, appID, "anything")
+	if err != nil {
+		t.Fatalf("HasPermission: %v", err)
+	}
+	if ok {
+		t.Errorf("user without roles has permission")
+	}
+
+	roles, err := s.UserRoles(ctx, admin, appID)
+	if err != nil {
+		t.Fatalf("UserRoles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].AppID != 0 || roles[0].Role.Name != models.RoleAdmin ||
+		len(roles[0].Role.Permissions) != 1 || roles[0].Role.Permissions[0] != models.PermissionAll {
+		t.Errorf("UserRoles = %+v, want one global admin role with %q", roles, models.PermissionAll)
+	}
+
+	if err := s.RevokeRole(ctx, admin, 0, models.RoleAdmin); err != nil {
+		t.Fatalf("RevokeRole: %v", err)
+	}
+	if ok, err := s.HasPermission(ctx, admin, appID, "anything"); err != nil || ok {
+		t.Errorf("HasPermission after RevokeRole = %v, %v, want false", ok, err)
+	}
+}
+
+func testRoles(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+
+	if err := s.AssignRole(ctx, user, appID, "no-such-role"); !errors.Is(err, database.ErrRoleNotFound) {
+		t.Errorf("AssignRole error = %v, want %v", err, database.ErrRoleNotFound)
+	}
+	if err := s.AssignRole(ctx, 100500, appID, models.RoleAdmin); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("AssignRole error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if err := s.RevokeRole(ctx, user, appID, "no-such-role"); !errors.Is(err, database.ErrRoleNotFound) {
+		t.Errorf("RevokeRole error = %v, want %v", err, database.ErrRoleNotFound)
+	}
+
+	// Роль в одном приложении не действует в другом
+	if err := s.AssignRole(ctx, user, appID, models.RoleAdmin); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	if ok, err := s.HasPermission(ctx, user, appID, "anything"); err != nil || !ok {
+		t.Errorf("HasPermission in own app = %v, %v, want true", ok, err)
+	}
+	if ok, err := s.HasPermission(ctx, user, 2, "anything"); err != nil || ok {
+		t.Errorf("HasPermission in other app = %v, %v, want false", ok, err)
+	}
+
+	roles, err := s.UserRoles(ctx, user, 2)
+	if err != nil {
+		t.Fatalf("UserRoles: %v", err)
+	}
+	if len(roles) != 0 {
+		t.Errorf("UserRoles in other app = %+v, want none", roles)
+	}
+
+	roles, err = s.UserRoles(ctx, user, 0)
+	if err != nil {
+		t.Fatalf("UserRoles: %v", err)
+	}
+	if len(roles) != 1 || roles[0].AppID != appID || roles[0].UserID != user {
+		t.Errorf("UserRoles in all apps = %+v, want role in app %d", roles, appID)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	expiresAt := time.Now().Add(time.Hour)
+
+	token := models.RefreshToken{Hash: []byte("hash-1"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: expiresAt}
+	if err := s.SaveRefreshToken(ctx, token); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+
+	got, err := s.RefreshToken(ctx, []byte("hash-1"))
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if got.UserID != user || got.AppID != appID || got.FamilyID != "family" || got.Used || got.Revoked {
+		t.Errorf("RefreshToken = %+v, want saved token", got)
+	}
+	if got.ExpiresAt.Unix() != expiresAt.Unix() {
+		t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, expiresAt)
+	}
+
+	if _, err := s.RefreshToken(ctx, []byte("unknown")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("RefreshToken error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+
+	if err := s.UseRefreshToken(ctx, got.ID); err != nil {
+		t.Fatalf("UseRefreshToken: %v", err)
+	}
+	if err := s.UseRefreshToken(ctx, got.ID); !errors.Is(err, database.ErrTokenUsed) {
+		t.Errorf("second UseRefreshToken error = %v, want %v", err, database.ErrTokenUsed)
+	}
+
+	// Отозванный токен нельзя использовать
+	next := models.RefreshToken{Hash: []byte("hash-2"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: expiresAt}
+	if err := s.SaveRefreshToken(ctx, next); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	if err := s.RevokeRefreshTokenFamily(ctx, "family"); err != nil {
+		t.Fatalf("RevokeRefreshTokenFamily: %v", err)
+	}
+	got, err = s.RefreshToken(ctx, []byte("hash-2"))
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if !got.Revoked {
+		t.Errorf("token is not revoked with its family")
+	}
+	if err := s.UseRefreshToken(ctx, got.ID); !errors.Is(err, database.ErrTokenUsed) {
+		t.Errorf("UseRefreshToken of revoked token error = %v, want %v", err, database.ErrTokenUsed)
+	}
+}
+
+func testRevokeTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	other := saveUser(t, s, "other@example.com")
+	expiresAt := time.Now().Add(time.Hour)
+
+	if err := s.RevokeToken(ctx, "jti-1", expiresAt); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	// Повторный отзыв не ошибка
+	if err := s.RevokeToken(ctx, "jti-1", expiresAt); err != nil {
+		t.Fatalf("RevokeToken twice: %v", err)
+	}
+	if revoked, err := s.IsTokenRevoked(ctx, "jti-1"); err != nil || !revoked {
+		t.Errorf("IsTokenRevoked = %v, %v, want true", revoked, err)
+	}
+	if revoked, err := s.IsTokenRevoked(ctx, "jti-unknown"); err != nil || revoked {
+		t.Errorf("IsTokenRevoked of unknown token = %v, %v, want false", revoked, err)
+	}
+
+	for _, token := range []models.AccessToken{
+		{ID: "user-token", UserID: user, AppID: appID, ExpiresAt: expiresAt},
+		{ID: "other-token", UserID: other, AppID: appID, ExpiresAt: expiresAt},
+	} {
+		if err := s.SaveAccessToken(ctx, token); err != nil {
+			t.Fatalf("SaveAccessToken: %v", err)
+		}
+	}
+	refresh := models.RefreshToken{Hash: []byte("hash"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: expiresAt}
+	if err := s.SaveRefreshToken(ctx, refresh); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+
+	if err := s.RevokeUserTokens(ctx, user, 0); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+
+	if revoked, err := s.IsTokenRevoked(ctx, "user-token"); err != nil || !revoked {
+		t.Errorf("IsTokenRevoked of user token = %v, %v, want true", revoked, err)
+	}
+	if revoked, err := s.IsTokenRevoked(ctx, "other-token"); err != nil || revoked {
+		t.Errorf("IsTokenRevoked of other user token = %v, %v, want false", revoked, err)
+	}
+	got, err := s.RefreshToken(ctx, []byte("hash"))
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+	if !got.Revoked {
+		t.Errorf("refresh token is not revoked by RevokeUserTokens")
+	}
+}
+
+func testDeleteExpiredTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	past := time.Now().Add(-time.Hour)
+
+	if err := s.RevokeToken(ctx, "expired", past); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	// Истёкший токен и так не пройдёт проверку, в denylist он не нужен
+	if revoked, err := s.IsTokenRevoked(ctx, "expired"); err != nil || revoked {
+		t.Errorf("IsTokenRevoked of expired entry = %v, %v, want false", revoked, err)
+	}
+
+	refresh := models.RefreshToken{Hash: []byte("expired"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: past}
+	if err := s.SaveRefreshToken(ctx, refresh); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	live := models.RefreshToken{Hash: []byte("live"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.SaveRefreshToken(ctx, live); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	reset := models.PasswordResetToken{Hash: []byte("expired reset"), UserID: user, ExpiresAt: past}
+	if err := s.SavePasswordResetToken(ctx, reset); err != nil {
+		t.Fatalf("SavePasswordResetToken: %v", err)
+	}
+
+	if err := s.DeleteExpiredTokens(ctx); err != nil {
+		t.Fatalf("DeleteExpiredTokens: %v", err)
+	}
+
+	if _, err := s.RefreshToken(ctx, []byte("expired")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("RefreshToken of expired token error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+	if _, err := s.RefreshToken(ctx, []byte("live")); err != nil {
+		t.Errorf("RefreshToken of live token: %v", err)
+	}
+	if _, err := s.PasswordResetToken(ctx, []byte("expired reset")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("PasswordResetToken of expired token error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+}
+
+func testPasswordResetTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	other := saveUser(t, s, "other@example.com")
+	// SQLite хранит время с точностью до секунды
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	for _, token := range []models.PasswordResetToken{
+		{Hash: []byte("first"), UserID: user, ExpiresAt: expiresAt},
+		{Hash: []byte("second"), UserID: user, ExpiresAt: expiresAt},
+		{Hash: []byte("other"), UserID: other, ExpiresAt: expiresAt},
+	} {
+		if err := s.SavePasswordResetToken(ctx, token); err != nil {
+			t.Fatalf("SavePasswordResetToken: %v", err)
+		}
+	}
+
+	token, err := s.PasswordResetToken(ctx, []byte("first"))
+	if err != nil {
+		t.Fatalf("PasswordResetToken: %v", err)
+	}
+	if token.UserID != user || string(token.Hash) != "first" || !token.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("PasswordResetToken = %+v, want user %d, expires at %s", token, user, expiresAt)
+	}
+	if _, err := s.PasswordResetToken(ctx, []byte("unknown")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("PasswordResetToken of unknown token error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+
+	if err := s.UsePasswordResetToken(ctx, []byte("first")); err != nil {
+		t.Fatalf("UsePasswordResetToken: %v", err)
+	}
+	if err := s.UsePasswordResetToken(ctx, []byte("first")); !errors.Is(err, database.ErrTokenUsed) {
+		t.Errorf("second UsePasswordResetToken error = %v, want %v", err, database.ErrTokenUsed)
+	}
+	if _, err := s.PasswordResetToken(ctx, []byte("first")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("PasswordResetToken of used token error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+
+	if err := s.DeletePasswordResetTokens(ctx, user); err != nil {
+		t.Fatalf("DeletePasswordResetTokens: %v", err)
+	}
+	if _, err := s.PasswordResetToken(ctx, []byte("second")); !errors.Is(err, database.ErrTokenNotFound) {
+		t.Errorf("PasswordResetToken of deleted token error = %v, want %v", err, database.ErrTokenNotFound)
+	}
+	if _, err := s.PasswordResetToken(ctx, []byte("other")); err != nil {
+		t.Errorf("PasswordResetToken of other user: %v", err)
+	}
+}
+
+func testAuditEvents(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	other := saveUser(t, s, "other@example.com")
+	createdAt := time.Now().Truncate(time.Second)
+
+	for _, event := range []models.AuditEvent{
+		{Type: models.AuditPasswordReset, UserID: user, IP: "192.0.2.1", CreatedAt: createdAt},
+		{Type: models.AuditPasswordReset, UserID: other, CreatedAt: createdAt},
+		{Type: "other", UserID: user, CreatedAt: createdAt.Add(time.Second)},
+	} {
+		if err := s.SaveAuditEvent(ctx, event); err != nil {
+			t.Fatalf("SaveAuditEvent: %v", err)
+		}
+	}
+
+	events, err := s.AuditEvents(ctx, user)
+	if err != nil {
+		t.Fatalf("AuditEvents: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("AuditEvents = %+v, want 2 events", events)
+	}
+	first := events[0]
+	if first.ID == 0 || first.Type != models.AuditPasswordReset || first.IP != "192.0.2.1" || !first.CreatedAt.Equal(createdAt) {
+		t.Errorf("first event = %+v, want password_reset from 192.0.2.1 at %s", first, createdAt)
+	}
+	if events[1].Type != "other" || events[1].ID <= first.ID {
+		t.Errorf("second event = %+v, want other after %d", events[1], first.ID)
+	}
+}
+
+func testLoginAttempts(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	const key = "email:user@example.com"
+	// SQLite хранит время с точностью до секунды
+	now := time.Now().Truncate(time.Second)
+
+	attempts, err := s.LoginAttempts(ctx, key)
+	if err != nil {
+		t.Fatalf("LoginAttempts: %v", err)
+	}
+	if attempts.Key != key || attempts.Failures != 0 || !attempts.LockedUntil.IsZero() {
+		t.Errorf("LoginAttempts of new key = %+v, want zero", attempts)
+	}
+
+	for i := 1; i <= 3; i++ {
+		attempts, err = s.AddLoginFailure(ctx, key, now.Add(time.Duration(i)*time.Second), time.Hour)
+		if err != nil {
+			t.Fatalf("AddLoginFailure: %v", err)
+		}
+		if attempts.Failures != i {
+			t.Errorf("Failures = %d, want %d", attempts.Failures, i)
+		}
+	}
+	if want := now.Add(3 * time.Second); !attempts.LastFailure.Equal(want) {
+		t.Errorf("LastFailure = %v, want %v", attempts.LastFailure, want)
+	}
+	if want := now.Add(3*time.Second + time.Hour); !attempts.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", attempts.ExpiresAt, want)
+	}
+
+	// Блокировка дольше окна продлевает запись
+	until := now.Add(2 * time.Hour)
+	if err := s.LockLogin(ctx, key, until); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+	attempts, err = s.LoginAttempts(ctx, key)
+	if err != nil {
+		t.Fatalf("LoginAttempts: %v", err)
+	}
+	if attempts.Failures != 0 || !attempts.LockedUntil.Equal(until) || !attempts.ExpiresAt.Equal(until) {
+		t.Errorf("LoginAttempts after lock = %+v, want 0 failures locked until %v", attempts, until)
+	}
+
+	if _, err := s.AddLoginFailure(ctx, "ip:192.0.2.1", now, time.Hour); err != nil {
+		t.Fatalf("AddLoginFailure: %v", err)
+	}
+	if err := s.ResetLoginAttempts(ctx, key); err != nil {
+		t.Fatalf("ResetLoginAttempts: %v", err)
+	}
+	if attempts, err := s.LoginAttempts(ctx, key); err != nil || attempts.Failures != 0 || !attempts.LockedUntil.IsZero() {
+		t.Errorf("LoginAttempts after reset = %+v, %v, want zero", attempts, err)
+	}
+	if attempts, err := s.LoginAttempts(ctx, "ip:192.0.2.1"); err != nil || attempts.Failures != 1 {
+		t.Errorf("LoginAttempts of other key = %+v, %v, want 1 failure", attempts, err)
+	}
+
+	// Блокировка без записи ничего не создаёт
+	if err := s.LockLogin(ctx, "email:other@example.com", until); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+	if attempts, err := s.LoginAttempts(ctx, "email:other@example.com"); err != nil || !attempts.LockedUntil.IsZero() {
+		t.Errorf("LoginAttempts of missing key = %+v, %v, want zero", attempts, err)
+	}
+}
+
+func testLoginAttemptsExpire(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	past := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+
+	if _, err := s.AddLoginFailure(ctx, "email:old@example.com", past, time.Hour); err != nil {
+		t.Fatalf("AddLoginFailure: %v", err)
+	}
+	if err := s.LockLogin(ctx, "email:old@example.com", past.Add(time.Minute)); err != nil {
+		t.Fatalf("LockLogin: %v", err)
+	}
+
+	// Истёкшая запись начинается заново, вместе с блокировкой
+	now := time.Now().Truncate(time.Second)
+	attempts, err := s.AddLoginFailure(ctx, "email:old@example.com", now, time.Hour)
+	if err != nil {
+		t.Fatalf("AddLoginFailure: %v", err)
+	}
+	if attempts.Failures != 1 || !attempts.LockedUntil.IsZero() || !attempts.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("AddLoginFailure after expiry = %+v, want fresh attempts", attempts)
+	}
+
+	if _, err := s.AddLoginFailure(ctx, "email:expired@example.com", past, time.Hour); err != nil {
+		t.Fatalf("AddLoginFailure: %v", err)
+	}
+	if err := s.DeleteExpiredLoginAttempts(ctx); err != nil {
+		t.Fatalf("DeleteExpiredLoginAttempts: %v", err)
+	}
+
+	if attempts, err := s.LoginAttempts(ctx, "email:expired@example.com"); err != nil || attempts.Failures != 0 {
+		t.Errorf("LoginAttempts of expired key = %+v, %v, want deleted", attempts, err)
+	}
+	if attempts, err := s.LoginAttempts(ctx, "email:old@example.com"); err != nil || attempts.Failures != 1 {
+		t.Errorf("LoginAttempts of live key = %+v, %v, want 1 failure", attempts, err)
+	}
+}
+
+func testSigningKeys(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	now := time.Now()
+	for i, id := range []string{"key-1", "key-2"} {
+		key := models.SigningKey{
+			ID:         id,
+			AppID:      0,
+			Algorithm:  "EdDSA",
+			PrivateKey: []byte("private " + id),
+			PublicKey:  []byte("public " + id),
+			CreatedAt:  now.Add(time.Duration(i-2) * time.Minute),
+		}
+		if err := s.SaveSigningKey(ctx, key); err != nil {
+			t.Fatalf("SaveSigningKey: %v", err)
+		}
+	}
+
+	keys, err := s.SigningKeys(ctx)
+	if err != nil {
+		t.Fatalf("SigningKeys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "key-1" || keys[1].ID != "key-2" {
+		t.Fatalf("SigningKeys = %v, want key-1, key-2 ordered by creation", keyIDs(keys))
+	}
+	if string(keys[1].PublicKey) != "public key-2" || !keys[1].ExpiresAt.IsZero() {
+		t.Errorf("SigningKeys[1] = %+v, want saved active key", keys[1])
+	}
+
+	expiresAt := now.Add(time.Hour)
+	if err := s.RetireSigningKey(ctx, "key-2", expiresAt); err != nil {
+		t.Fatalf("RetireSigningKey: %v", err)
+	}
+	if err := s.RetireSigningKey(ctx, "key-1", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RetireSigningKey: %v", err)
+	}
+
+	keys, err = s.SigningKeys(ctx)
+	if err != nil {
+		t.Fatalf("SigningKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].ID != "key-2" || keys[0].ExpiresAt.Unix() != expiresAt.Unix() {
+		t.Fatalf("SigningKeys = %+v, want only key-2 retired at %v", keys, expiresAt)
+	}
+
+	if err := s.DeleteExpiredSigningKeys(ctx); err != nil {
+		t.Fatalf("DeleteExpiredSigningKeys: %v", err)
+	}
+	keys, err = s.SigningKeys(ctx)
+	if err != nil {
+		t.Fatalf("SigningKeys: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("SigningKeys = %v, DeleteExpiredSigningKeys must keep published key", keyIDs(keys))
+	}
+}
+
+func keyIDs(keys []models.SigningKey) []string {
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key.ID)
+	}
+	return ids
+}
+
+const workers = 16
+
+func testConcurrentSaveUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	var (
+		wg   sync.WaitGroup
+		ids  = make([]uint32, workers)
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = s.SaveUser(ctx, fmt.Sprintf("user-%d@example.com", i), []byte("hash"))
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint32]int)
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("SaveUser %d: %v", i, errs[i])
+		}
+		if prev, ok := seen[ids[i]]; ok {
+			t.Fatalf("users %d and %d got the same id %d", prev, i, ids[i])
+		}
+		seen[ids[i]] = i
+
+		// id должен указывать на того, кто его получил
+		user, err := s.UserByID(ctx, ids[i])
+		if err != nil {
+			t.Fatalf("UserByID: %v", err)
+		}
+		if want := fmt.Sprintf("user-%d@example.com", i); user.Email != want {
+			t.Errorf("UserByID(%d).Email = %s, want %s", ids[i], user.Email, want)
+		}
+	}
+}
+
+func testConcurrentDuplicateUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.SaveUser(ctx, "user@example.com", []byte("hash"))
+		}(i)
+	}
+	wg.Wait()
+
+	saved := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, database.ErrUserExists):
+			t.Errorf("SaveUser error = %v, want nil or %v", err, database.ErrUserExists)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("user saved %d times, want once", saved)
+	}
+}
+
+func testConcurrentUpdateEmail(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	// Два пользователя одновременно забирают один email
+	ids := []uint32{saveUser(t, s, "first@example.com"), saveUser(t, s, "second@example.com")}
+	olds := []string{"first@example.com", "second@example.com"}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(ids))
+	)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.UpdateEmail(ctx, ids[i], olds[i], "new@example.com")
+		}(i)
+	}
+	wg.Wait()
+
+	updated := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			updated++
+		case !errors.Is(err, database.ErrUserExists):
+			t.Errorf("UpdateEmail error = %v, want nil or %v", err, database.ErrUserExists)
+		}
+	}
+	if updated != 1 {
+		t.Errorf("email taken %d times, want once", updated)
+	}
+}
+
+func testConcurrentUseRefreshToken(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	token := models.RefreshToken{Hash: []byte("hash"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.SaveRefreshToken(ctx, token); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	saved, err := s.RefreshToken(ctx, token.Hash)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// Refresh одного токена из нескольких запросов сразу: пройти должен только один
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.UseRefreshToken(ctx, saved.ID)
+		}(i)
+	}
+	wg.Wait()
+
+	used := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			used++
+		case !errors.Is(err, database.ErrTokenUsed):
+			t.Errorf("UseRefreshToken error = %v, want nil or %v", err, database.ErrTokenUsed)
+		}
+	}
+	if used != 1 {
+		t.Errorf("token used %d times, want once", used)
+	}
+}
+
+func testConcurrentUsePasswordResetToken(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	token := models.PasswordResetToken{Hash: []byte("hash"), UserID: user, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.SavePasswordResetToken(ctx, token); err != nil {
+		t.Fatalf("SavePasswordResetToken: %v", err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.UsePasswordResetToken(ctx, []byte("hash"))
+		}(i)
+	}
+	wg.Wait()
+
+	used := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			used++
+		case !errors.Is(err, database.ErrTokenUsed):
+			t.Errorf("UsePasswordResetToken error = %v, want nil or %v", err, database.ErrTokenUsed)
+		}
+	}
+	if used != 1 {
+		t.Errorf("token used %d times, want once", used)
+	}
+}
+
+func testConcurrentLoginFailure(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	// Попытки с разных реплик не должны теряться
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.AddLoginFailure(ctx, "email:user@example.com", time.Now(), time.Hour)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("AddLoginFailure: %v", err)
+		}
+	}
+
+	attempts, err := s.LoginAttempts(ctx, "email:user@example.com")
+	if err != nil {
+		t.Fatalf("LoginAttempts: %v", err)
+	}
+	if attempts.Failures != workers {
+		t.Errorf("Failures = %d, want %d", attempts.Failures, workers)
+	}
+}
+
+func testTxCommit(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	var id uint32
+	err := s.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = s.SaveUser(ctx, "user@example.com", []byte("hash"))
+		if err != nil {
+			return err
+		}
+		// Внутри транзакции видно то, что в ней записано
+		if _, err := s.UserByID(ctx, id); err != nil {
+			return err
+		}
+		// Вложенная транзакция - часть внешней
+		return s.WithTx(ctx, func(ctx context.Context) error {
+			return s.AssignRole(ctx, id, appID, models.RoleAdmin)
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := s.User(ctx, "user@example.com"); err != nil {
+		t.Errorf("User after commit: %v", err)
+	}
+	if ok, err := s.HasPermission(ctx, id, appID, "anything"); err != nil || !ok {
+		t.Errorf("HasPermission after commit = %v, %v, want true", ok, err)
+	}
+}
+
+func testTxRollback(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+
+	errRollback := errors.New("rollback")
+	err := s.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := s.SaveUser(ctx, "new@example.com", []byte("hash")); err != nil {
+			return err
+		}
+		if err := s.AssignRole(ctx, user, appID, models.RoleAdmin); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx error = %v, want error of fn", err)
+	}
+
+	if _, err := s.User(ctx, "new@example.com"); !errors.Is(err, database.ErrUserNotFound) {
+		t.Errorf("User after rollback error = %v, want %v", err, database.ErrUserNotFound)
+	}
+	if ok, err := s.HasPermission(ctx, user, appID, "anything"); err != nil || ok {
+		t.Errorf("HasPermission after rollback = %v, %v, want false", ok, err)
+	}
+
+	// После отката хранилище работает как обычно
+	saveUser(t, s, "new@example.com")
+}
+
+func testConcurrentTx(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	user := saveUser(t, s, "user@example.com")
+	expiresAt := time.Now().Add(time.Hour)
+	token := models.RefreshToken{Hash: []byte("hash"), FamilyID: "family", UserID: user, AppID: appID, ExpiresAt: expiresAt}
+	if err := s.SaveRefreshToken(ctx, token); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+	saved, err := s.RefreshToken(ctx, token.Hash)
+	if err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	// Как в Refresh: старый токен используется и новый сохраняется атомарно
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.WithTx(ctx, func(ctx context.Context) error {
+				if err := s.UseRefreshToken(ctx, saved.ID); err != nil {
+					return err
+				}
+				return s.SaveRefreshToken(ctx, models.RefreshToken{
+					Hash:      []byte(fmt.Sprintf("next-%d", i)),
+					FamilyID:  "family",
+					UserID:    user,
+					AppID:     appID,
+					ExpiresAt: expiresAt,
+				})
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	rotated := -1
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			if rotated >= 0 {
+				t.Fatalf("token rotated twice: by %d and %d", rotated, i)
+			}
+			rotated = i
+		case !errors.Is(err, database.ErrTokenUsed):
+			t.Errorf("WithTx error = %v, want nil or %v", err, database.ErrTokenUsed)
+		}
+	}
+	if rotated < 0 {
+		t.Fatalf("token is not rotated")
+	}
+
+	// Новые токены остались только от успешной транзакции
+	for i := 0; i < workers; i++ {
+		_, err := s.RefreshToken(ctx, []byte(fmt.Sprintf("next-%d", i)))
+		if i == rotated && err != nil {
+			t.Errorf("RefreshToken of committed token: %v", err)
+		}
+		if i != rotated && !errors.Is(err, database.ErrTokenNotFound) {
+			t.Errorf("RefreshToken of rolled back token %d error = %v, want %v", i, err, database.ErrTokenNotFound)
+		}
+	}
+}
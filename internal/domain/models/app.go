@@ -1,7 +1,13 @@
 package models
 
 type App struct {
-	ID     uint32
-	Name   string
-	Secret string //для подписи токенов
+	ID         uint32
+	Name       string
+	Secret     string //для подписи токенов при HS256
+	SigningAlg string // HS256, RS256 или EdDSA
+	// Какие claims с правами пользователя добавлять в токен
+	TokenRoles bool // roles - роли пользователя в приложении
+	TokenScope bool // scope - права пользователя в приложении
+	// Не пускать пользователей с неподтверждённым email
+	RequireVerifiedEmail bool
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Типы событий аудита
+const (
+	AuditPasswordReset  = "password_reset"
+	AuditPasswordChange = "password_change"
+	AuditEmailChange    = "email_change"
+)
+
+// AuditEvent - запись о важном действии с аккаунтом
+type AuditEvent struct {
+	ID        int64
+	Type      string
+	UserID    uint32
+	IP        string // пустой - неизвестен
+	CreatedAt time.Time
+}
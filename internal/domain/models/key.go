@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// SigningKey is an asymmetric key pair to sign tokens
+type SigningKey struct {
+	ID         string // kid
+	AppID      uint32 // 0 - общий ключ для всех приложений
+	Algorithm  string
+	PrivateKey []byte // PKCS #8, DER
+	PublicKey  []byte // PKIX, DER
+	CreatedAt  time.Time
+	// Время, после которого ключ больше не публикуется в JWKS
+	// Пустое у активного ключа, выставляется при ротации
+	ExpiresAt time.Time
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginAttempts - неудачные попытки входа по одному ключу (email или IP)
+type LoginAttempts struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time // zero - не заблокирован
+	// После этого времени запись не учитывается и может быть удалена
+	ExpiresAt time.Time
+}
@@ -0,0 +1,20 @@
+package models
+
+// Роль с правами на всё
+const (
+	RoleAdmin     = "admin"
+	PermissionAll = "*"
+)
+
+type Role struct {
+	ID          uint32
+	Name        string
+	Permissions []string
+}
+
+// UserRole - роль, выданная пользователю в приложении
+type UserRole struct {
+	UserID uint32
+	AppID  uint32 // 0 - во всех приложениях
+	Role   Role
+}
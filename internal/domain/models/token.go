@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// RefreshToken хранится на сервере только в виде хэша
+// PasswordResetToken - одноразовый токен сброса пароля, хранится только SHA-256 хэш
+type PasswordResetToken struct {
+	Hash      []byte
+	UserID    uint32
+	ExpiresAt time.Time
+}
+
+type RefreshToken struct {
+	ID        int64
+	Hash      []byte
+	FamilyID  string // общий для всех токенов, полученных из одного Login
+	UserID    uint32
+	AppID     uint32
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
+
+// InactiveReason объясняет, почему токен не прошёл проверку
+type InactiveReason int
+
+const (
+	ReasonNone InactiveReason = iota
+	ReasonMalformed
+	ReasonExpired
+	ReasonBadSignature
+	ReasonRevoked
+	ReasonUnknownApp
+	ReasonNotValidYet
+)
+
+// TokenInfo is a result of token introspection
+type TokenInfo struct {
+	Active    bool
+	UserID    uint32
+	Email     string
+	AppID     uint32
+	ExpiresAt time.Time
+	Roles     []string
+	Scope     []string
+	Reason    InactiveReason
+}
+
+// AccessToken - запись о выданном токене, нужна для отзыва всех токенов пользователя
+type AccessToken struct {
+	ID        string // jti
+	UserID    uint32
+	AppID     uint32
+	ExpiresAt time.Time
+}
+
+// Principal - проверенный вызывающий, достаётся из access token
+type Principal struct {
+	UserID    uint32
+	Email     string
+	AppID     uint32
+	TokenID   string
+	ExpiresAt time.Time
+	Roles     []string
+	Scope     []string
+	Token     string // сам access token, нужен для Logout
+}
@@ -1,7 +1,8 @@
 package models
 
 type User struct {
-	ID       uint32
-	Email    string
-	PassHash []byte
+	ID            uint32
+	Email         string
+	PassHash      []byte
+	EmailVerified bool
 }
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"fmt"
+	"grpc_service/internal/grpc/interceptors"
+	ssov1 "grpc_service/protos/gen/go/sso"
+)
+
+// Policies - кто может вызывать методы Auth
+// Методы, которых нет в таблице, требуют действующий токен
+var Policies = interceptors.Policies{
+	method("Register"): interceptors.PolicyPublic,
+	method("Login"):    interceptors.PolicyPublic,
+	method("Refresh"):  interceptors.PolicyPublic,
+	method("GetJWKS"):  interceptors.PolicyPublic,
+
+	method("SendVerification"): interceptors.PolicyPublic,
+	method("VerifyEmail"):      interceptors.PolicyPublic,
+
+	method("RequestPasswordReset"): interceptors.PolicyPublic,
+	method("ResetPassword"):        interceptors.PolicyPublic,
+	method("ConfirmEmailChange"):   interceptors.PolicyPublic,
+
+	// RFC 7662 2.1: интроспекция только для аутентифицированных клиентов (или сервисов из grpc.service_methods)
+	method("Introspect"): interceptors.PolicyAuthenticated,
+
+	// Себя может проверить любой пользователь, других - только администратор (см. authorizeUser)
+	method("Logout"):        interceptors.PolicyAuthenticated,
+	method("IsAdmin"):       interceptors.PolicyAuthenticated,
+	method("ListUserRoles"): interceptors.PolicyAuthenticated,
+	method("HasPermission"): interceptors.PolicyAuthenticated,
+
+	// Только свой аккаунт, нужен текущий пароль
+	method("ChangePassword"): interceptors.PolicyAuthenticated,
+	method("ChangeEmail"):    interceptors.PolicyAuthenticated,
+
+	method("RevokeUserTokens"): interceptors.PolicyAdmin,
+	method("AssignRole"):       interceptors.PolicyAdmin,
+	method("RevokeRole"):       interceptors.PolicyAdmin,
+	method("UnlockAccount"):    interceptors.PolicyAdmin,
+}
+
+// userMethods act on the user of the token and can't be given to services
+var userMethods = map[string]bool{
+	method("Logout"):         true,
+	method("ChangePassword"): true,
+	method("ChangeEmail"):    true,
+}
+
+// CheckServiceMethods returns error if grpc.service_methods has a method that needs user token
+func CheckServiceMethods(methods []string) error {
+	for _, m := range methods {
+		if userMethods[m] {
+			return fmt.Errorf("service method %s needs user token", m)
+		}
+	}
+	return nil
+}
+
+func method(name string) string {
+	return "/" + ssov1.Auth_ServiceDesc.ServiceName + "/" + name
+}
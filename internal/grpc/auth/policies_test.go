@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"grpc_service/internal/grpc/interceptors"
+	ssov1 "grpc_service/protos/gen/go/sso"
+	"testing"
+)
+
+// Каждый метод Auth должен быть в таблице явно: новый метод без записи стал бы PolicyAuthenticated молча
+func TestPolicies(t *testing.T) {
+	want := map[string]interceptors.Policy{
+		"Register":             interceptors.PolicyPublic,
+		"Login":                interceptors.PolicyPublic,
+		"Refresh":              interceptors.PolicyPublic,
+		"Introspect":           interceptors.PolicyAuthenticated,
+		"GetJWKS":              interceptors.PolicyPublic,
+		"SendVerification":     interceptors.PolicyPublic,
+		"VerifyEmail":          interceptors.PolicyPublic,
+		"RequestPasswordReset": interceptors.PolicyPublic,
+		"ResetPassword":        interceptors.PolicyPublic,
+		"ConfirmEmailChange":   interceptors.PolicyPublic,
+		"Logout":               interceptors.PolicyAuthenticated,
+		"IsAdmin":              interceptors.PolicyAuthenticated,
+		"ListUserRoles":        interceptors.PolicyAuthenticated,
+		"HasPermission":        interceptors.PolicyAuthenticated,
+		"ChangePassword":       interceptors.PolicyAuthenticated,
+		"ChangeEmail":          interceptors.PolicyAuthenticated,
+		"RevokeUserTokens":     interceptors.PolicyAdmin,
+		"AssignRole":           interceptors.PolicyAdmin,
+		"RevokeRole":           interceptors.PolicyAdmin,
+		"UnlockAccount":        interceptors.PolicyAdmin,
+	}
+
+	for _, m := range ssov1.Auth_ServiceDesc.Methods {
+		policy, ok := Policies[method(m.MethodName)]
+		if !ok {
+			t.Errorf("%s has no policy", m.MethodName)
+			continue
+		}
+		if wantPolicy, ok := want[m.MethodName]; !ok || policy != wantPolicy {
+			t.Errorf("%s policy = %d, want %d", m.MethodName, policy, wantPolicy)
+		}
+	}
+
+	if len(Policies) != len(ssov1.Auth_ServiceDesc.Methods) {
+		t.Errorf("%d policies for %d methods, table has unknown methods", len(Policies), len(ssov1.Auth_ServiceDesc.Methods))
+	}
+}
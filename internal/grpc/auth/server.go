@@ -4,17 +4,28 @@ import (
 	"context"
 	"errors"
 	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/grpc/interceptors"
+	"grpc_service/internal/passpolicy"
 	"grpc_service/internal/services/auth"
+	"grpc_service/internal/services/limiter"
 	ssov1 "grpc_service/protos/gen/go/sso"
 	"net/mail"
+	"net/netip"
+	"strings"
+	"time"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 var (
-	internalError = status.Error(codes.Internal, "internal error")
+	internalError        = status.Error(codes.Internal, "internal error")
+	unauthenticatedError = status.Error(codes.Unauthenticated, "unauthenticated")
+	permissionError      = status.Error(codes.PermissionDenied, "permission denied")
 )
 
 type Auth interface {
@@ -23,7 +34,13 @@ type Auth interface {
 		email string,
 		password string,
 		appID uint32,
-	) (token string, err error)
+		ip string,
+	) (tokens models.TokenPair, err error)
+
+	Refresh(
+		ctx context.Context,
+		refreshToken string,
+	) (tokens models.TokenPair, err error)
 
 	RegisterNewUser(
 		ctx context.Context,
@@ -31,7 +48,52 @@ type Auth interface {
 		password string,
 	) (userID uint32, err error)
 
-	IsAdmin(ctx context.Context, userID uint32) (bool, error)
+	Introspect(
+		ctx context.Context,
+		token string,
+	) (info models.TokenInfo, err error)
+
+	JWKS(ctx context.Context) ([]models.JWK, error)
+
+	Logout(
+		ctx context.Context,
+		userID uint32,
+		accessToken string,
+		refreshToken string,
+	) error
+
+	RevokeUserTokens(
+		ctx context.Context,
+		userID uint32,
+		appID uint32,
+	) error
+
+	IsAdmin(ctx context.Context, userID uint32, appID uint32) (bool, error)
+
+	AssignRole(ctx context.Context, userID uint32, appID uint32, role string) error
+	RevokeRole(ctx context.Context, userID uint32, appID uint32, role string) error
+	ListUserRoles(ctx context.Context, userID uint32, appID uint32) ([]models.UserRole, error)
+	HasPermission(ctx context.Context, userID uint32, appID uint32, permission string) (bool, error)
+
+	UnlockAccount(ctx context.Context, email string, ip string) error
+
+	SendVerification(ctx context.Context, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+
+	RequestPasswordReset(ctx context.Context, email string, ip string) error
+	ResetPassword(ctx context.Context, token string, password string, ip string) error
+
+	ChangePassword(
+		ctx context.Context,
+		userID uint32,
+		appID uint32,
+		oldPassword string,
+		newPassword string,
+		revokeOtherSessions bool,
+		ip string,
+	) (tokens models.TokenPair, err error)
+	ChangeEmail(ctx context.Context, userID uint32, newEmail string, password string, ip string) error
+	ConfirmEmailChange(ctx context.Context, token string, ip string) error
 }
 
 type serverAPI struct {
@@ -39,10 +101,12 @@ type serverAPI struct {
 	// отладка была возможна в случае отсутствия реализации какого-то из методов
 	ssov1.UnimplementedAuthServer
 	auth Auth
+	// Прокси, которым можно верить в x-forwarded-for
+	trustedProxies []netip.Prefix
 }
 
-func Register(gRPC *grpc.Server, auth Auth) {
-	ssov1.RegisterAuthServer(gRPC, &serverAPI{auth: auth})
+func Register(gRPC *grpc.Server, auth Auth, trustedProxies []netip.Prefix) {
+	ssov1.RegisterAuthServer(gRPC, &serverAPI{auth: auth, trustedProxies: trustedProxies})
 }
 
 // Handlers ————————————————————————————————————————
@@ -54,18 +118,50 @@ func (s *serverAPI) Login(
 		return nil, err
 	}
 
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetAppId())
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), req.GetAppId(), ip)
 	if err != nil {
 		// TODO: обработка в зависимости от ошибки
 		// Неправильный пароль
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid credentials")
 		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, status.Error(codes.FailedPrecondition, "email not verified")
+		}
+		var limitErr *limiter.Error
+		if errors.As(err, &limitErr) {
+			return nil, limitError(limitErr, "too many login attempts")
+		}
 		return nil, internalError
 	}
 
 	return &ssov1.LoginResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) Refresh(
+	ctx context.Context,
+	req *ssov1.RefreshRequest,
+) (*ssov1.RefreshResponse, error) {
+	if err := validateRefreshReq(req); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.RefreshResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
@@ -84,6 +180,10 @@ func (s *serverAPI) Register(
 		if errors.Is(err, db.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		var policyErr *passpolicy.Error
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyError(policyErr, "password")
+		}
 		return nil, internalError
 	}
 
@@ -92,18 +192,135 @@ func (s *serverAPI) Register(
 	}, nil
 }
 
+func (s *serverAPI) Introspect(
+	ctx context.Context,
+	req *ssov1.IntrospectRequest,
+) (*ssov1.IntrospectResponse, error) {
+	if err := validateIntrospectReq(req); err != nil {
+		return nil, err
+	}
+
+	info, err := s.auth.Introspect(ctx, req.GetToken())
+	if err != nil {
+		return nil, internalError
+	}
+
+	if !info.Active {
+		return &ssov1.IntrospectResponse{
+			Active: false,
+			Reason: inactiveReasons[info.Reason],
+		}, nil
+	}
+
+	return &ssov1.IntrospectResponse{
+		Active: true,
+		UserId: info.UserID,
+		Email:  info.Email,
+		AppId:  info.AppID,
+		Exp:    info.ExpiresAt.Unix(),
+		Roles:  info.Roles,
+		Scope:  strings.Join(info.Scope, " "),
+	}, nil
+}
+
+var inactiveReasons = map[models.InactiveReason]ssov1.InactiveReason{
+	models.ReasonMalformed:    ssov1.InactiveReason_INACTIVE_REASON_MALFORMED,
+	models.ReasonExpired:      ssov1.InactiveReason_INACTIVE_REASON_EXPIRED,
+	models.ReasonBadSignature: ssov1.InactiveReason_INACTIVE_REASON_BAD_SIGNATURE,
+	models.ReasonRevoked:      ssov1.InactiveReason_INACTIVE_REASON_REVOKED,
+	models.ReasonUnknownApp:   ssov1.InactiveReason_INACTIVE_REASON_UNKNOWN_APP,
+	models.ReasonNotValidYet:  ssov1.InactiveReason_INACTIVE_REASON_NOT_VALID_YET,
+}
+
+func (s *serverAPI) GetJWKS(
+	ctx context.Context,
+	req *ssov1.GetJWKSRequest,
+) (*ssov1.GetJWKSResponse, error) {
+	jwks, err := s.auth.JWKS(ctx)
+	if err != nil {
+		return nil, internalError
+	}
+
+	keys := make([]*ssov1.JWK, 0, len(jwks))
+	for _, jwk := range jwks {
+		keys = append(keys, &ssov1.JWK{
+			Kid: jwk.KeyID,
+			Kty: jwk.KeyType,
+			Alg: jwk.Algorithm,
+			Use: jwk.Use,
+			N:   jwk.N,
+			E:   jwk.E,
+			Crv: jwk.Curve,
+			X:   jwk.X,
+		})
+	}
+
+	return &ssov1.GetJWKSResponse{
+		Keys: keys,
+	}, nil
+}
+
+func (s *serverAPI) Logout(
+	ctx context.Context,
+	req *ssov1.LogoutRequest,
+) (*ssov1.LogoutResponse, error) {
+	principal, ok := interceptors.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, unauthenticatedError
+	}
+
+	// По умолчанию отзывается токен, с которым пришёл запрос
+	token := req.GetToken()
+	if token == "" {
+		token = principal.Token
+	}
+
+	if err := s.auth.Logout(ctx, principal.UserID, token, req.GetRefreshToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if errors.Is(err, auth.ErrNotTokenOwner) {
+			return nil, permissionError
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) RevokeUserTokens(
+	ctx context.Context,
+	req *ssov1.RevokeUserTokensRequest,
+) (*ssov1.RevokeUserTokensResponse, error) {
+	if err := validateRevokeUserTokensReq(req); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeApp(ctx, req.GetAppId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeUserTokens(ctx, req.GetUserId(), req.GetAppId()); err != nil {
+		return nil, internalError
+	}
+
+	return &ssov1.RevokeUserTokensResponse{}, nil
+}
+
 func (s *serverAPI) IsAdmin(
 	ctx context.Context,
 	req *ssov1.IsAdminRequest,
 ) (*ssov1.IsAdminResponse, error) {
 
 	if err := validateIsAdminReq(req); err != nil {
-		return nil, internalError
+		return nil, err
 	}
-	isAdmin, err := s.auth.IsAdmin(ctx, req.GetUserId())
+	if err := s.authorizeUser(ctx, req.GetUserId(), req.GetAppId()); err != nil {
+		return nil, err
+	}
+	isAdmin, err := s.auth.IsAdmin(ctx, req.GetUserId(), req.GetAppId())
 	if err != nil {
 		if errors.Is(err, db.ErrUserNotFound) {
-			return nil, status.Error(codes.AlreadyExists, "user not found")
+			return nil, status.Error(codes.NotFound, "user not found")
 		}
 		return nil, internalError
 	}
@@ -113,6 +330,390 @@ func (s *serverAPI) IsAdmin(
 	}, nil
 }
 
+func (s *serverAPI) AssignRole(
+	ctx context.Context,
+	req *ssov1.AssignRoleRequest,
+) (*ssov1.AssignRoleResponse, error) {
+	if err := validateRoleReq(req.GetUserId(), req.GetRole()); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeApp(ctx, req.GetAppId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.AssignRole(ctx, req.GetUserId(), req.GetAppId(), req.GetRole()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.AssignRoleResponse{}, nil
+}
+
+func (s *serverAPI) RevokeRole(
+	ctx context.Context,
+	req *ssov1.RevokeRoleRequest,
+) (*ssov1.RevokeRoleResponse, error) {
+	if err := validateRoleReq(req.GetUserId(), req.GetRole()); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeApp(ctx, req.GetAppId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.RevokeRole(ctx, req.GetUserId(), req.GetAppId(), req.GetRole()); err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.RevokeRoleResponse{}, nil
+}
+
+func (s *serverAPI) ListUserRoles(
+	ctx context.Context,
+	req *ssov1.ListUserRolesRequest,
+) (*ssov1.ListUserRolesResponse, error) {
+	if err := validateUserID(req.GetUserId()); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeUser(ctx, req.GetUserId(), req.GetAppId()); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.ListUserRoles(ctx, req.GetUserId(), req.GetAppId())
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	resp := &ssov1.ListUserRolesResponse{
+		Roles: make([]*ssov1.UserRole, 0, len(roles)),
+	}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, &ssov1.UserRole{
+			Role:        role.Role.Name,
+			AppId:       role.AppID,
+			Permissions: role.Role.Permissions,
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *serverAPI) HasPermission(
+	ctx context.Context,
+	req *ssov1.HasPermissionRequest,
+) (*ssov1.HasPermissionResponse, error) {
+	if err := validateUserID(req.GetUserId()); err != nil {
+		return nil, err
+	}
+	if err := s.authorizeUser(ctx, req.GetUserId(), req.GetAppId()); err != nil {
+		return nil, err
+	}
+	if req.GetPermission() == "" {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	allowed, err := s.auth.HasPermission(ctx, req.GetUserId(), req.GetAppId(), req.GetPermission())
+	if err != nil {
+		return nil, roleError(err)
+	}
+
+	return &ssov1.HasPermissionResponse{
+		Allowed: allowed,
+	}, nil
+}
+
+func (s *serverAPI) UnlockAccount(
+	ctx context.Context,
+	req *ssov1.UnlockAccountRequest,
+) (*ssov1.UnlockAccountResponse, error) {
+	if err := validateUnlockAccountReq(req); err != nil {
+		return nil, err
+	}
+	// Блокировка касается входа во все приложения, поэтому нужен глобальный администратор
+	if err := s.authorizeApp(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.UnlockAccount(ctx, req.GetEmail(), req.GetIp()); err != nil {
+		return nil, internalError
+	}
+
+	return &ssov1.UnlockAccountResponse{}, nil
+}
+
+func (s *serverAPI) SendVerification(
+	ctx context.Context,
+	req *ssov1.SendVerificationRequest,
+) (*ssov1.SendVerificationResponse, error) {
+	if err := validateEmail(req.GetEmail()); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.SendVerification(ctx, req.GetEmail()); err != nil {
+		return nil, internalError
+	}
+
+	return &ssov1.SendVerificationResponse{}, nil
+}
+
+func (s *serverAPI) VerifyEmail(
+	ctx context.Context,
+	req *ssov1.VerifyEmailRequest,
+) (*ssov1.VerifyEmailResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidVerificationToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired verification token")
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(
+	ctx context.Context,
+	req *ssov1.RequestPasswordResetRequest,
+) (*ssov1.RequestPasswordResetResponse, error) {
+	if err := validateEmail(req.GetEmail()); err != nil {
+		return nil, err
+	}
+
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail(), ip); err != nil {
+		var limitErr *limiter.Error
+		if errors.As(err, &limitErr) {
+			return nil, limitError(limitErr, "too many password reset requests")
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ResetPassword(
+	ctx context.Context,
+	req *ssov1.ResetPasswordRequest,
+) (*ssov1.ResetPasswordResponse, error) {
+	if err := validateResetPasswordReq(req); err != nil {
+		return nil, err
+	}
+
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	if err := s.auth.ResetPassword(ctx, req.GetToken(), req.GetNewPassword(), ip); err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired password reset token")
+		}
+		var policyErr *passpolicy.Error
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyError(policyErr, "new_password")
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.ResetPasswordResponse{}, nil
+}
+
+func (s *serverAPI) ChangePassword(
+	ctx context.Context,
+	req *ssov1.ChangePasswordRequest,
+) (*ssov1.ChangePasswordResponse, error) {
+	principal, ok := interceptors.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, unauthenticatedError
+	}
+	if err := validateChangePasswordReq(req); err != nil {
+		return nil, err
+	}
+
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	tokens, err := s.auth.ChangePassword(
+		ctx, principal.UserID, principal.AppID,
+		req.GetOldPassword(), req.GetNewPassword(), req.GetRevokeOtherSessions(), ip,
+	)
+	if err != nil {
+		return nil, accountError(err, "new_password")
+	}
+
+	return &ssov1.ChangePasswordResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+func (s *serverAPI) ChangeEmail(
+	ctx context.Context,
+	req *ssov1.ChangeEmailRequest,
+) (*ssov1.ChangeEmailResponse, error) {
+	principal, ok := interceptors.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, unauthenticatedError
+	}
+	if err := validateChangeEmailReq(req); err != nil {
+		return nil, err
+	}
+
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	if err := s.auth.ChangeEmail(ctx, principal.UserID, req.GetNewEmail(), req.GetPassword(), ip); err != nil {
+		return nil, accountError(err, "password")
+	}
+
+	return &ssov1.ChangeEmailResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmEmailChange(
+	ctx context.Context,
+	req *ssov1.ConfirmEmailChangeRequest,
+) (*ssov1.ConfirmEmailChangeResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	ip := interceptors.ClientIP(ctx, s.trustedProxies)
+
+	if err := s.auth.ConfirmEmailChange(ctx, req.GetToken(), ip); err != nil {
+		if errors.Is(err, auth.ErrInvalidEmailChangeToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired email change token")
+		}
+		if errors.Is(err, db.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		}
+		return nil, internalError
+	}
+
+	return &ssov1.ConfirmEmailChangeResponse{}, nil
+}
+
+// authorizeUser allows to read data of the user in appID for the user himself,
+// for a service from grpc.service_methods or for an admin:
+// admin of the app only for the app his token is issued for,
+// global admin - for any app and for all apps (appID = 0)
+func (s *serverAPI) authorizeUser(ctx context.Context, userID uint32, appID uint32) error {
+	if _, ok := interceptors.ServiceFromContext(ctx); ok {
+		return nil
+	}
+	principal, ok := interceptors.PrincipalFromContext(ctx)
+	if !ok {
+		return unauthenticatedError
+	}
+	if principal.UserID == userID {
+		return nil
+	}
+
+	// Администратор приложения из токена или глобальный; для чужого приложения - только глобальный
+	adminApp := uint32(0)
+	if appID != 0 && appID == principal.AppID {
+		adminApp = appID
+	}
+
+	isAdmin, err := s.auth.IsAdmin(ctx, principal.UserID, adminApp)
+	if err != nil {
+		return internalError
+	}
+	if !isAdmin {
+		return permissionError
+	}
+	return nil
+}
+
+// authorizeApp checks that admin can manage the app
+// Admin of the app can manage only the app his token is issued for,
+// global admin - any app and global roles (appID = 0).
+// Сервис из grpc.service_methods проверен интерцептором по сертификату и может всё
+func (s *serverAPI) authorizeApp(ctx context.Context, appID uint32) error {
+	if _, ok := interceptors.ServiceFromContext(ctx); ok {
+		return nil
+	}
+	principal, ok := interceptors.PrincipalFromContext(ctx)
+	if !ok {
+		return unauthenticatedError
+	}
+	if appID != 0 && appID == principal.AppID {
+		return nil
+	}
+
+	isAdmin, err := s.auth.IsAdmin(ctx, principal.UserID, 0)
+	if err != nil {
+		return internalError
+	}
+	if !isAdmin {
+		return permissionError
+	}
+	return nil
+}
+
+// roleError maps errors of role handlers to gRPC status
+func roleError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	case errors.Is(err, db.ErrAppNotFound):
+		return status.Error(codes.NotFound, "app not found")
+	case errors.Is(err, db.ErrRoleNotFound):
+		return status.Error(codes.NotFound, "role not found")
+	}
+	return internalError
+}
+
+// accountError maps errors of ChangePassword and ChangeEmail to gRPC status
+// passwordField - поле запроса, которое проверяется политикой паролей
+func accountError(err error, passwordField string) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return status.Error(codes.InvalidArgument, "invalid credentials")
+	case errors.Is(err, auth.ErrEmailUnchanged):
+		return status.Error(codes.InvalidArgument, "new email is the same as current")
+	case errors.Is(err, db.ErrUserExists):
+		return status.Error(codes.AlreadyExists, "user already exists")
+	case errors.Is(err, db.ErrUserNotFound):
+		return status.Error(codes.NotFound, "user not found")
+	}
+	var limitErr *limiter.Error
+	if errors.As(err, &limitErr) {
+		return limitError(limitErr, "too many login attempts")
+	}
+	var policyErr *passpolicy.Error
+	if errors.As(err, &policyErr) {
+		return passwordPolicyError(policyErr, passwordField)
+	}
+	return internalError
+}
+
+// passwordPolicyError returns InvalidArgument with every failed rule in errdetails.BadRequest
+// Description начинается с имени правила: "min_length: ...", field - поле запроса с паролем
+func passwordPolicyError(err *passpolicy.Error, field string) error {
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Rule + ": " + v.Description,
+		})
+	}
+
+	st, detailsErr := status.New(codes.InvalidArgument, "password does not satisfy policy").
+		WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, "password does not satisfy policy")
+	}
+	return st.Err()
+}
+
+// limitError returns ResourceExhausted with errdetails.RetryInfo
+// Причина (пауза или блокировка) не раскрывается
+func limitError(err *limiter.Error, message string) error {
+	st, detailsErr := status.New(codes.ResourceExhausted, message).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(err.RetryAfter.Round(time.Second))})
+	if detailsErr != nil {
+		return status.Error(codes.ResourceExhausted, message)
+	}
+	return st.Err()
+}
+
 //——————————————————————————————————————————————————
 
 // validateHandlers ————————————————————————————————
@@ -137,6 +738,27 @@ func validateRegisterReq(req *ssov1.RegisterRequest) error {
 	return nil
 }
 
+func validateRefreshReq(req *ssov1.RefreshRequest) error {
+	if req.GetRefreshToken() == "" {
+		return status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+	return nil
+}
+
+func validateIntrospectReq(req *ssov1.IntrospectRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+	return nil
+}
+
+func validateRevokeUserTokensReq(req *ssov1.RevokeUserTokensRequest) error {
+	if err := validateUserID(req.GetUserId()); err != nil {
+		return err
+	}
+	return nil
+}
+
 func validateIsAdminReq(req *ssov1.IsAdminRequest) error {
 	if err := validateUserID(req.GetUserId()); err != nil {
 		return err
@@ -144,11 +766,66 @@ func validateIsAdminReq(req *ssov1.IsAdminRequest) error {
 	return nil
 }
 
+func validateUnlockAccountReq(req *ssov1.UnlockAccountRequest) error {
+	if err := validateEmail(req.GetEmail()); err != nil {
+		return err
+	}
+	if ip := req.GetIp(); ip != "" {
+		if _, err := netip.ParseAddr(ip); err != nil {
+			return status.Error(codes.InvalidArgument, "ip is invalid")
+		}
+	}
+	return nil
+}
+
+func validateResetPasswordReq(req *ssov1.ResetPasswordRequest) error {
+	if req.GetToken() == "" {
+		return status.Error(codes.InvalidArgument, "token is required")
+	}
+	if err := validatePassword(req.GetNewPassword()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateChangePasswordReq(req *ssov1.ChangePasswordRequest) error {
+	if req.GetOldPassword() == "" {
+		return status.Error(codes.InvalidArgument, "old_password is required")
+	}
+	if err := validatePassword(req.GetNewPassword()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateChangeEmailReq(req *ssov1.ChangeEmailRequest) error {
+	if err := validateEmail(req.GetNewEmail()); err != nil {
+		return err
+	}
+	if err := validatePassword(req.GetPassword()); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateRoleReq(userID uint32, role string) error {
+	if err := validateUserID(userID); err != nil {
+		return err
+	}
+	if role == "" {
+		return status.Error(codes.InvalidArgument, "role is required")
+	}
+	return nil
+}
+
 //——————————————————————————————————————————————————
 
 // validateAttributes ——————————————————————————————
+// validateEmail accepts only bare address: "Name <user@example.com>" проходит ParseAddress,
+// но письмо на такой "email" уйдёт не туда, куда ожидает пользователь
 func validateEmail(email string) error {
-	if _, err := mail.ParseAddress(email); err != nil {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
 		return status.Error(codes.InvalidArgument, "email is invalid")
 	}
 	return nil
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/grpc/interceptors"
+	"grpc_service/internal/passpolicy"
+	"grpc_service/internal/services/limiter"
+	ssov1 "grpc_service/protos/gen/go/sso"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// stubAuth records RevokeUserTokens calls, ResetPassword и RequestPasswordReset return resetErr, остальные методы не вызываются
+// admins - пользователь и приложение его роли admin, 0 - глобальный администратор
+type stubAuth struct {
+	Auth
+	revoked  []uint32
+	resetErr error
+	admins   map[uint32]uint32
+}
+
+func (a *stubAuth) ResetPassword(context.Context, string, string, string) error {
+	return a.resetErr
+}
+
+func (a *stubAuth) RequestPasswordReset(context.Context, string, string) error {
+	return a.resetErr
+}
+
+func (a *stubAuth) RevokeUserTokens(_ context.Context, userID uint32, _ uint32) error {
+	a.revoked = append(a.revoked, userID)
+	return nil
+}
+
+func (a *stubAuth) IsAdmin(_ context.Context, userID uint32, appID uint32) (bool, error) {
+	adminApp, ok := a.admins[userID]
+	return ok && (adminApp == 0 || adminApp == appID), nil
+}
+
+func (a *stubAuth) ListUserRoles(context.Context, uint32, uint32) ([]models.UserRole, error) {
+	return nil, nil
+}
+
+func (a *stubAuth) HasPermission(context.Context, uint32, uint32, string) (bool, error) {
+	return false, nil
+}
+
+func (a *stubAuth) Authenticate(context.Context, string) (models.Principal, error) {
+	return models.Principal{}, nil
+}
+
+// withClientCert returns context of a connection with verified client certificate
+func withClientCert(commonName string) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		},
+	})
+}
+
+func TestServiceMethod(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	authService := &stubAuth{}
+	server := &serverAPI{auth: authService}
+
+	policies := interceptors.Policies{}
+	for m, policy := range Policies {
+		policies[m] = policy
+	}
+	policies[method("RevokeUserTokens")] = interceptors.PolicyService
+	interceptor := interceptors.NewAuth(log, authService, policies, []string{"billing"})
+
+	info := &grpc.UnaryServerInfo{FullMethod: method("RevokeUserTokens")}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return server.RevokeUserTokens(ctx, req.(*ssov1.RevokeUserTokensRequest))
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"known service", withClientCert("billing"), codes.OK},
+		{"unknown service", withClientCert("other"), codes.PermissionDenied},
+		{"no certificate", context.Background(), codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService.revoked = nil
+
+			req := &ssov1.RevokeUserTokensRequest{UserId: 7, AppId: 1}
+			_, err := interceptor.Unary()(tt.ctx, req, info, handler)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %s, want %s (err %v)", code, tt.code, err)
+			}
+
+			wantRevoked := 0
+			if tt.code == codes.OK {
+				wantRevoked = 1
+			}
+			if len(authService.revoked) != wantRevoked {
+				t.Errorf("RevokeUserTokens called %d times, want %d", len(authService.revoked), wantRevoked)
+			}
+		})
+	}
+}
+
+// Администратор приложения видит роли других пользователей только в приложении своего токена
+func TestAuthorizeUserCrossApp(t *testing.T) {
+	const (
+		userID      = 5
+		otherUserID = 6
+		appAdmin    = 10
+		globalAdmin = 20
+	)
+	server := &serverAPI{auth: &stubAuth{admins: map[uint32]uint32{appAdmin: 1, globalAdmin: 0}}}
+
+	asUser := func(userID uint32) context.Context {
+		return interceptors.ContextWithPrincipal(context.Background(), models.Principal{UserID: userID, AppID: 1})
+	}
+	asService := interceptors.ContextWithService(context.Background(), interceptors.ClientIdentity{CommonName: "billing"})
+
+	calls := map[string]func(ctx context.Context, appID uint32) error{
+		"IsAdmin": func(ctx context.Context, appID uint32) error {
+			_, err := server.IsAdmin(ctx, &ssov1.IsAdminRequest{UserId: userID, AppId: appID})
+			return err
+		},
+		"ListUserRoles": func(ctx context.Context, appID uint32) error {
+			_, err := server.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{UserId: userID, AppId: appID})
+			return err
+		},
+		"HasPermission": func(ctx context.Context, appID uint32) error {
+			_, err := server.HasPermission(ctx, &ssov1.HasPermissionRequest{UserId: userID, AppId: appID, Permission: "posts.read"})
+			return err
+		},
+	}
+
+	tests := []struct {
+		name  string
+		ctx   context.Context
+		appID uint32
+		code  codes.Code
+	}{
+		{"app admin in token app", asUser(appAdmin), 1, codes.OK},
+		{"app admin in other app", asUser(appAdmin), 2, codes.PermissionDenied},
+		{"app admin in all apps", asUser(appAdmin), 0, codes.PermissionDenied},
+		{"global admin in other app", asUser(globalAdmin), 2, codes.OK},
+		{"global admin in all apps", asUser(globalAdmin), 0, codes.OK},
+		{"user himself in other app", asUser(userID), 2, codes.OK},
+		{"other user", asUser(otherUserID), 1, codes.PermissionDenied},
+		{"service", asService, 2, codes.OK},
+		{"no principal", context.Background(), 1, codes.Unauthenticated},
+	}
+
+	for name, call := range calls {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				if code := status.Code(call(tt.ctx, tt.appID)); code != tt.code {
+					t.Errorf("code = %s, want %s", code, tt.code)
+				}
+			})
+		}
+	}
+}
+
+func TestCheckServiceMethods(t *testing.T) {
+	if err := CheckServiceMethods([]string{method("RevokeUserTokens"), method("UnlockAccount")}); err != nil {
+		t.Errorf("CheckServiceMethods of admin methods: %v", err)
+	}
+	if err := CheckServiceMethods([]string{method("ChangePassword")}); err == nil {
+		t.Error("CheckServiceMethods with ChangePassword: err = nil")
+	}
+}
+
+func TestRequestPasswordResetLimited(t *testing.T) {
+	server := &serverAPI{auth: &stubAuth{resetErr: &limiter.Error{RetryAfter: 90 * time.Second}}}
+
+	_, err := server.RequestPasswordReset(context.Background(), &ssov1.RequestPasswordResetRequest{Email: "user@example.com"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted {
+		t.Fatalf("code = %s, want %s", st.Code(), codes.ResourceExhausted)
+	}
+
+	var retryDelay time.Duration
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			retryDelay = retryInfo.GetRetryDelay().AsDuration()
+		}
+	}
+	if retryDelay != 90*time.Second {
+		t.Errorf("retry delay = %s, want 1m30s", retryDelay)
+	}
+}
+
+func TestPasswordPolicyErrorField(t *testing.T) {
+	policyErr := &passpolicy.Error{Violations: []passpolicy.Violation{{Rule: "min_length", Description: "too short"}}}
+	server := &serverAPI{auth: &stubAuth{resetErr: policyErr}}
+
+	_, err := server.ResetPassword(context.Background(), &ssov1.ResetPasswordRequest{Token: "token", NewPassword: "short"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %s, want %s", st.Code(), codes.InvalidArgument)
+	}
+
+	var fields []string
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+		}
+	}
+	if len(fields) != 1 || fields[0] != "new_password" {
+		t.Errorf("violation fields = %v, want [new_password]", fields)
+	}
+}
@@ -0,0 +1,84 @@
+package interceptors
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AccessLog writes one line per RPC: method, peer, status code and latency
+type AccessLog struct {
+	log *slog.Logger
+}
+
+func NewAccessLog(log *slog.Logger) *AccessLog {
+	return &AccessLog{
+		log: log,
+	}
+}
+
+func (a *AccessLog) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		a.write(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func (a *AccessLog) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		a.write(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+func (a *AccessLog) write(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+
+	peerAddr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+
+	slogger.FromContext(ctx, a.log).Log(ctx, codeLevel(code), "rpc finished",
+		slog.String("method", method),
+		slog.String("peer", peerAddr),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	)
+}
+
+// codeLevel - ошибки сервера пишутся как Error, ошибки клиента - как Info
+func codeLevel(code codes.Code) slog.Level {
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return slog.LevelError
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
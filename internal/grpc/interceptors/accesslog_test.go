@@ -0,0 +1,74 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		code  string
+		level string
+	}{
+		{"ok", nil, "OK", "INFO"},
+		{"client error", status.Error(codes.NotFound, "not found"), "NotFound", "INFO"},
+		{"server error", status.Error(codes.Internal, "internal error"), "Internal", "ERROR"},
+		{"unavailable", status.Error(codes.Unavailable, "unavailable"), "Unavailable", "WARN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log := slog.New(slog.NewJSONHandler(&logs, nil))
+
+			// Как в grpcapp: RequestID первым, чтобы access log писал request_id
+			requestID, accessLog := NewRequestID(log).Unary(), NewAccessLog(log).Unary()
+			chain := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				return requestID(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return accessLog(ctx, req, info, handler)
+				})
+			}
+
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				time.Sleep(time.Millisecond)
+				return nil, tt.err
+			}
+			if _, err := callWithStream(t, chain, withRequestID("req-42"), handler); err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			var line struct {
+				Level     string  `json:"level"`
+				Msg       string  `json:"msg"`
+				Method    string  `json:"method"`
+				Code      string  `json:"code"`
+				Latency   float64 `json:"latency"`
+				RequestID string  `json:"request_id"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("log line %q: %v", logs.String(), err)
+			}
+
+			if line.Msg != "rpc finished" || line.Method != "/test.Test/Method" || line.Code != tt.code || line.Level != tt.level {
+				t.Errorf("log line = %+v, want method /test.Test/Method, code %s, level %s", line, tt.code, tt.level)
+			}
+			// slog пишет Duration в наносекундах
+			if time.Duration(line.Latency) < time.Millisecond {
+				t.Errorf("latency = %v, want at least 1ms", time.Duration(line.Latency))
+			}
+			if line.RequestID != "req-42" {
+				t.Errorf("request_id = %q, want req-42", line.RequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/services/auth"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Policy describes who can call the method
+type Policy int
+
+const (
+	// PolicyAuthenticated - нужен действующий access token. Используется для методов не из таблицы
+	PolicyAuthenticated Policy = iota
+	// PolicyPublic - можно вызывать без токена
+	PolicyPublic
+	// PolicyAdmin - нужен токен администратора приложения, для которого он выдан
+	PolicyAdmin
+	// PolicyService - только для сервисов с проверенным клиентским сертификатом (mTLS)
+	// из списка serviceIdentities, токен не нужен. Вместо principal в контексте сервис, см. ServiceFromContext
+	PolicyService
+)
+
+const authorizationHeader = "authorization"
+
+// Policies maps full method name ("/package.Service/Method") to its policy
+type Policies map[string]Policy
+
+type TokenVerifier interface {
+	// Authenticate returns auth.ErrInvalidToken if the token is not active
+	Authenticate(ctx context.Context, token string) (models.Principal, error)
+	IsAdmin(ctx context.Context, userID uint32, appID uint32) (bool, error)
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller authenticated by the interceptor
+func PrincipalFromContext(ctx context.Context) (models.Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(models.Principal)
+	return principal, ok
+}
+
+// ContextWithPrincipal returns context with the caller
+func ContextWithPrincipal(ctx context.Context, principal models.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+type serviceKey struct{}
+
+// ServiceFromContext returns the service authenticated by the interceptor for PolicyService method
+func ServiceFromContext(ctx context.Context) (ClientIdentity, bool) {
+	identity, ok := ctx.Value(serviceKey{}).(ClientIdentity)
+	return identity, ok
+}
+
+// ContextWithService returns context with the calling service
+func ContextWithService(ctx context.Context, identity ClientIdentity) context.Context {
+	return context.WithValue(ctx, serviceKey{}, identity)
+}
+
+// Auth checks bearer token from metadata according to the method policy
+type Auth struct {
+	log      *slog.Logger
+	verifier TokenVerifier
+	policies Policies
+	// CN или полный subject сертификатов сервисов
+	serviceIdentities map[string]bool
+}
+
+func NewAuth(
+	log *slog.Logger,
+	verifier TokenVerifier,
+	policies Policies,
+	serviceIdentities []string,
+) *Auth {
+	services := make(map[string]bool, len(serviceIdentities))
+	for _, identity := range serviceIdentities {
+		services[identity] = true
+	}
+
+	return &Auth{
+		log:               log,
+		verifier:          verifier,
+		policies:          policies,
+		serviceIdentities: services,
+	}
+}
+
+func (a *Auth) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (a *Auth) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize returns context with the principal or gRPC status error
+func (a *Auth) authorize(ctx context.Context, method string) (context.Context, error) {
+	const op = "interceptors.Auth"
+
+	log := slogger.FromContext(ctx, a.log).With(
+		slog.String("op", op),
+		slog.String("method", method),
+	)
+
+	policy := a.policies[method]
+
+	if policy == PolicyService {
+		identity, err := a.authorizeService(ctx, log)
+		if err != nil {
+			return nil, err
+		}
+		return ContextWithService(ctx, identity), nil
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		if policy == PolicyPublic {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	principal, err := a.verifier.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			if policy == PolicyPublic {
+				// Публичный метод работает и с плохим токеном, но без principal
+				return ctx, nil
+			}
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		log.Error("failed to authenticate", slogger.Err(err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	if policy == PolicyAdmin {
+		isAdmin, err := a.verifier.IsAdmin(ctx, principal.UserID, principal.AppID)
+		if err != nil {
+			log.Error("failed to check admin", slogger.Err(err))
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		if !isAdmin {
+			log.Warn("admin method called by non admin", slog.Any("userID", principal.UserID))
+			return nil, status.Error(codes.PermissionDenied, "admin role required")
+		}
+	}
+
+	return ContextWithPrincipal(ctx, principal), nil
+}
+
+// authorizeService returns identity of the caller if it is a known service
+func (a *Auth) authorizeService(ctx context.Context, log *slog.Logger) (ClientIdentity, error) {
+	identity, ok := ClientIdentityFromContext(ctx)
+	if !ok {
+		return ClientIdentity{}, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+
+	if !a.serviceIdentities[identity.CommonName] && !a.serviceIdentities[identity.Subject] {
+		log.Warn("service method called by unknown service", slog.String("subject", identity.Subject))
+		return ClientIdentity{}, status.Error(codes.PermissionDenied, "unknown service identity")
+	}
+
+	return identity, nil
+}
+
+// bearerToken returns token from "authorization: Bearer <token>" metadata
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, value := range md.Get(authorizationHeader) {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
+
+// serverStream подменяет контекст потока
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,146 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/services/auth"
+	"io"
+	"log/slog"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	methodPublic        = "/test.Test/Public"
+	methodAuthenticated = "/test.Test/Authenticated"
+	methodAdmin         = "/test.Test/Admin"
+	methodUnknown       = "/test.Test/Unknown"
+)
+
+var testPolicies = Policies{
+	methodPublic:        PolicyPublic,
+	methodAuthenticated: PolicyAuthenticated,
+	methodAdmin:         PolicyAdmin,
+}
+
+// stubVerifier knows tokens "user" and "admin", "revoked" is not active, "broken" fails
+type stubVerifier struct{}
+
+var (
+	userPrincipal  = models.Principal{UserID: 1, AppID: 1, TokenID: "user-jti"}
+	adminPrincipal = models.Principal{UserID: 2, AppID: 1, TokenID: "admin-jti"}
+)
+
+func (stubVerifier) Authenticate(_ context.Context, token string) (models.Principal, error) {
+	switch token {
+	case "user":
+		return userPrincipal, nil
+	case "admin":
+		return adminPrincipal, nil
+	case "broken":
+		return models.Principal{}, errors.New("storage is down")
+	}
+	// revoked jti, истёкший или чужой токен
+	return models.Principal{}, auth.ErrInvalidToken
+}
+
+func (stubVerifier) IsAdmin(_ context.Context, userID uint32, appID uint32) (bool, error) {
+	return userID == adminPrincipal.UserID && appID == adminPrincipal.AppID, nil
+}
+
+// callUnary runs the interceptor and returns principal seen by the handler
+func callUnary(
+	t *testing.T,
+	a *Auth,
+	ctx context.Context,
+	method string,
+) (principal models.Principal, hasPrincipal bool, err error) {
+	t.Helper()
+
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		principal, hasPrincipal = PrincipalFromContext(ctx)
+		return nil, nil
+	}
+
+	_, err = a.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return principal, hasPrincipal, err
+}
+
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorizationHeader, "Bearer "+token))
+}
+
+func TestAuthPolicies(t *testing.T) {
+	a := NewAuth(slog.New(slog.NewTextHandler(io.Discard, nil)), stubVerifier{}, testPolicies, nil)
+
+	tests := []struct {
+		name      string
+		method    string
+		token     string
+		code      codes.Code
+		principal *models.Principal
+	}{
+		{"public without token", methodPublic, "", codes.OK, nil},
+		{"public with token", methodPublic, "user", codes.OK, &userPrincipal},
+		{"public with revoked token", methodPublic, "revoked", codes.OK, nil},
+		{"authenticated without token", methodAuthenticated, "", codes.Unauthenticated, nil},
+		{"authenticated", methodAuthenticated, "user", codes.OK, &userPrincipal},
+		{"authenticated with revoked token", methodAuthenticated, "revoked", codes.Unauthenticated, nil},
+		{"authenticated verifier error", methodAuthenticated, "broken", codes.Internal, nil},
+		{"admin without token", methodAdmin, "", codes.Unauthenticated, nil},
+		{"admin by user", methodAdmin, "user", codes.PermissionDenied, nil},
+		{"admin", methodAdmin, "admin", codes.OK, &adminPrincipal},
+		{"admin with revoked token", methodAdmin, "revoked", codes.Unauthenticated, nil},
+		{"unknown without token", methodUnknown, "", codes.Unauthenticated, nil},
+		{"unknown", methodUnknown, "user", codes.OK, &userPrincipal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, ok, err := callUnary(t, a, withToken(tt.token), tt.method)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %s, want %s (err %v)", code, tt.code, err)
+			}
+			if tt.principal == nil {
+				if ok {
+					t.Errorf("principal = %+v, want none", principal)
+				}
+				return
+			}
+			if !ok || principal.UserID != tt.principal.UserID || principal.TokenID != tt.principal.TokenID {
+				t.Errorf("principal = %+v, %v, want %+v", principal, ok, *tt.principal)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{"bearer", []string{"Bearer abc"}, "abc"},
+		{"lowercase scheme", []string{"bearer abc"}, "abc"},
+		{"other scheme", []string{"Basic abc"}, ""},
+		{"no scheme", []string{"abc"}, ""},
+		{"second value", []string{"Basic xyz", "Bearer abc"}, "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{authorizationHeader: tt.values})
+			if got := bearerToken(ctx); got != tt.want {
+				t.Errorf("bearerToken = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// pipeAddr - адрес соединения без IP, как у bufconn
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "bufconn" }
+func (pipeAddr) String() string  { return "bufconn" }
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcp := func(ip string) net.Addr {
+		return &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}
+	}
+
+	tests := []struct {
+		name      string
+		peer      net.Addr
+		forwarded []string
+		want      string
+	}{
+		{"direct", tcp("198.51.100.7"), nil, "198.51.100.7"},
+		{"untrusted peer ignores header", tcp("198.51.100.7"), []string{"203.0.113.1"}, "198.51.100.7"},
+		{"trusted proxy", tcp("10.1.2.3"), []string{"203.0.113.1"}, "203.0.113.1"},
+		{"proxy chain", tcp("10.1.2.3"), []string{"1.1.1.1, 203.0.113.1, 192.0.2.10"}, "203.0.113.1"},
+		{"several headers", tcp("10.1.2.3"), []string{"1.1.1.1", "203.0.113.1"}, "203.0.113.1"},
+		{"trusted proxy without header", tcp("10.1.2.3"), nil, "10.1.2.3"},
+		{"garbage in header", tcp("10.1.2.3"), []string{"203.0.113.1, garbage"}, "10.1.2.3"},
+		{"ipv4 in ipv6", tcp("::ffff:198.51.100.7"), nil, "198.51.100.7"},
+		{"gateway", pipeAddr{}, []string{"203.0.113.1"}, "203.0.113.1"},
+		{"gateway without header", pipeAddr{}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tt.peer})
+			if tt.forwarded != nil {
+				md := metadata.MD{forwardedForHeader: tt.forwarded}
+				ctx = metadata.NewIncomingContext(ctx, md)
+			}
+
+			if got := ClientIP(ctx, trusted); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesError(t *testing.T) {
+	for _, proxy := range []string{"", "10.0.0.0/33", "example.com"} {
+		if _, err := ParseTrustedProxies([]string{proxy}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q): err = nil", proxy)
+		}
+	}
+}
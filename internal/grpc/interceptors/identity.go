@@ -0,0 +1,39 @@
+package interceptors
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIdentity - subject of the verified client certificate (mTLS)
+type ClientIdentity struct {
+	Subject    string // RFC 2253, например "CN=billing,O=example"
+	CommonName string
+}
+
+// ClientIdentityFromContext returns identity of the caller if it presented a certificate
+// that was verified against the client CA. Непроверенные сертификаты не учитываются
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ClientIdentity{}, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ClientIdentity{}, false
+	}
+
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ClientIdentity{}, false
+	}
+
+	subject := chains[0][0].Subject
+	return ClientIdentity{
+		Subject:    subject.String(),
+		CommonName: subject.CommonName,
+	}, true
+}
@@ -0,0 +1,70 @@
+package interceptors
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery turns panic in a handler into codes.Internal instead of crashing the process
+type Recovery struct {
+	log *slog.Logger
+}
+
+func NewRecovery(log *slog.Logger) *Recovery {
+	return &Recovery{
+		log: log,
+	}
+}
+
+func (r *Recovery) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = r.recovered(ctx, info.FullMethod, p)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+func (r *Recovery) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = r.recovered(ss.Context(), info.FullMethod, p)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+func (r *Recovery) recovered(ctx context.Context, method string, p interface{}) error {
+	const op = "interceptors.Recovery"
+
+	slogger.FromContext(ctx, r.log).Error("panic in handler",
+		slog.String("op", op),
+		slog.String("method", method),
+		slog.Any("panic", p),
+		slog.String("stack", string(debug.Stack())),
+	)
+
+	return status.Error(codes.Internal, "internal error")
+}
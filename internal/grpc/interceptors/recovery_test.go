@@ -0,0 +1,47 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecovery(t *testing.T) {
+	const secret = "db password is hunter2"
+
+	var logs bytes.Buffer
+	r := NewRecovery(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		panic(secret)
+	}
+	_, err := r.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Test/Panic"}, handler)
+
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Fatalf("code = %s, want %s", st.Code(), codes.Internal)
+	}
+	// Значение panic уходит только в лог, клиенту - общее сообщение
+	if strings.Contains(st.Message(), "hunter2") || len(st.Details()) != 0 {
+		t.Errorf("status leaks the panic: %q, %v", st.Message(), st.Details())
+	}
+	if !strings.Contains(logs.String(), "hunter2") || !strings.Contains(logs.String(), "/test.Test/Panic") {
+		t.Errorf("panic is not logged: %s", logs.String())
+	}
+
+	// Без panic ответ и ошибка handler'а не меняются
+	want := status.Error(codes.NotFound, "not found")
+	resp, err := r.Unary()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test.Test/Ok"},
+		func(context.Context, interface{}) (interface{}, error) {
+			return "resp", want
+		})
+	if resp != "resp" || err != want {
+		t.Errorf("Unary = %v, %v, want resp, %v", resp, err, want)
+	}
+}
@@ -0,0 +1,118 @@
+package interceptors
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"grpc_service/internal/slogger"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader - метаданные с id запроса, id возвращается и в заголовке ответа
+const RequestIDHeader = "x-request-id"
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns id of the current request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID takes x-request-id from metadata or generates a new one
+// and stores it in the context along with the logger that writes request_id
+// Должен быть первым в цепочке, чтобы остальные interceptor'ы писали request_id
+type RequestID struct {
+	log *slog.Logger
+}
+
+func NewRequestID(log *slog.Logger) *RequestID {
+	return &RequestID{
+		log: log,
+	}
+}
+
+func (r *RequestID) Unary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, id := r.withRequestID(ctx)
+
+		// Ошибка возможна только если заголовки уже отправлены
+		_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		return handler(ctx, req)
+	}
+}
+
+func (r *RequestID) Stream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, id := r.withRequestID(ss.Context())
+
+		_ = ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (r *RequestID) withRequestID(ctx context.Context) (context.Context, string) {
+	id := incomingRequestID(ctx)
+	if id == "" {
+		id = newRequestID()
+	}
+
+	log := r.log.With(slog.String("request_id", id))
+
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	ctx = slogger.WithContext(ctx, log)
+
+	return ctx, id
+}
+
+// incomingRequestID returns id from metadata if it looks sane
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(RequestIDHeader)
+	if len(values) == 0 {
+		return ""
+	}
+
+	id := values[0]
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return ""
+	}
+	// id попадает в логи, поэтому только печатные ASCII символы без пробелов
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return ""
+		}
+	}
+
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand не должен падать, но id запроса не повод отказывать в обслуживании
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package interceptors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"grpc_service/internal/slogger"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerStream captures headers set by grpc.SetHeader
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "/test.Test/Method" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+func (s *headerStream) SetTrailer(metadata.MD) error    { return nil }
+
+// callWithStream runs the interceptor in context of a server stream, returns response header
+func callWithStream(
+	t *testing.T,
+	interceptor grpc.UnaryServerInterceptor,
+	ctx context.Context,
+	handler grpc.UnaryHandler,
+) (metadata.MD, error) {
+	t.Helper()
+
+	stream := &headerStream{}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+
+	_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: stream.Method()}, handler)
+	return stream.header, err
+}
+
+func withRequestID(id string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(RequestIDHeader, id))
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		want     string
+		generate bool
+	}{
+		{"passed through", withRequestID("req-42"), "req-42", false},
+		{"missing", context.Background(), "", true},
+		{"empty", withRequestID(""), "", true},
+		{"with spaces", withRequestID("req 42"), "", true},
+		{"not ascii", withRequestID("запрос"), "", true},
+		{"too long", withRequestID(strings.Repeat("a", maxRequestIDLength+1)), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			r := NewRequestID(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+			var seen string
+			handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+				seen = RequestIDFromContext(ctx)
+				slogger.FromContext(ctx, slog.Default()).Info("in handler")
+				return nil, nil
+			}
+
+			header, err := callWithStream(t, r.Unary(), tt.ctx, handler)
+			if err != nil {
+				t.Fatalf("interceptor: %v", err)
+			}
+
+			if tt.generate {
+				if len(seen) != 32 || seen == tt.want {
+					t.Errorf("generated id = %q, want 32 hex chars", seen)
+				}
+			} else if seen != tt.want {
+				t.Errorf("request id = %q, want %q", seen, tt.want)
+			}
+
+			if got := header.Get(RequestIDHeader); len(got) != 1 || got[0] != seen {
+				t.Errorf("response header %s = %v, want [%s]", RequestIDHeader, got, seen)
+			}
+
+			// Логгер из контекста пишет request_id
+			var line map[string]any
+			if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+				t.Fatalf("log line %q: %v", logs.String(), err)
+			}
+			if line["request_id"] != seen {
+				t.Errorf("logged request_id = %v, want %s", line["request_id"], seen)
+			}
+		})
+	}
+
+	// Каждый запрос без id получает свой
+	r := NewRequestID(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ids := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		header, _ := callWithStream(t, r.Unary(), context.Background(), func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		ids[header.Get(RequestIDHeader)[0]] = true
+	}
+	if len(ids) != 10 {
+		t.Errorf("%d unique ids for 10 requests", len(ids))
+	}
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"context"
+	"grpc_service/internal/grpc/interceptors"
+	ssov1 "grpc_service/protos/gen/go/sso"
+	"grpc_service/protos/gen/openapiv2"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// Prefix - пути REST API из google.api.http в sso.proto
+	Prefix = "/v1/"
+	// OpenAPIPath - сгенерированный protoc-gen-openapiv2 документ
+	OpenAPIPath = "/openapi.json"
+)
+
+// New returns HTTP/JSON handler that calls the Auth service through conn
+// Коды gRPC переводятся в HTTP (runtime.HTTPStatusFromCode),
+// ошибки отдаются JSON'ом {"code": ..., "message": ..., "details": [...]}
+func New(
+	ctx context.Context,
+	conn grpc.ClientConnInterface,
+) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+			},
+		}),
+		runtime.WithIncomingHeaderMatcher(incomingHeader),
+		runtime.WithOutgoingHeaderMatcher(outgoingHeader),
+	)
+
+	if err := ssov1.RegisterAuthHandlerClient(ctx, mux, ssov1.NewAuthClient(conn)); err != nil {
+		return nil, err
+	}
+
+	return mux, nil
+}
+
+// Register registers REST API and its OpenAPI document
+func Register(mux *http.ServeMux, gateway http.Handler) {
+	mux.Handle(Prefix, gateway)
+	mux.HandleFunc(OpenAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openapiv2.SSO)
+	})
+}
+
+// incomingHeader передаёт x-request-id в gRPC как есть, чтобы запрос было видно в логах под тем же id
+// Authorization grpc-gateway передаёт сам
+func incomingHeader(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == textproto.CanonicalMIMEHeaderKey(interceptors.RequestIDHeader) {
+		return interceptors.RequestIDHeader, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// outgoingHeader возвращает клиенту x-request-id без префикса Grpc-Metadata-
+func outgoingHeader(key string) (string, bool) {
+	if key == interceptors.RequestIDHeader {
+		return textproto.CanonicalMIMEHeaderKey(key), true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"grpc_service/internal/grpc/interceptors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeConn answers every unary call with err and remembers outgoing metadata
+type fakeConn struct {
+	err      error
+	header   metadata.MD
+	incoming metadata.MD
+}
+
+func (c *fakeConn) Invoke(ctx context.Context, _ string, _, _ any, opts ...grpc.CallOption) error {
+	c.incoming, _ = metadata.FromOutgoingContext(ctx)
+	for _, opt := range opts {
+		if h, ok := opt.(grpc.HeaderCallOption); ok {
+			*h.HeaderAddr = c.header
+		}
+	}
+	return c.err
+}
+
+func (c *fakeConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, errors.New("streams are not used")
+}
+
+func serve(t *testing.T, conn *fakeConn, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	gateway, err := New(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	mux := http.NewServeMux()
+	Register(mux, gateway)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func loginRequest() *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(`{"email": "user@example.com", "password": "password", "app_id": 1}`))
+}
+
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		http int
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			w := serve(t, &fakeConn{err: status.Error(tt.code, "something failed")}, loginRequest())
+			if w.Code != tt.http {
+				t.Errorf("HTTP status = %d, want %d", w.Code, tt.http)
+			}
+		})
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "password is too weak").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "password", Description: "too short"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(t, &fakeConn{err: st.Err()}, loginRequest())
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Details []struct {
+			Type            string `json:"@type"`
+			FieldViolations []struct {
+				Field       string `json:"field"`
+				Description string `json:"description"`
+			} `json:"field_violations"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+
+	if body.Code != int(codes.InvalidArgument) || body.Message != "password is too weak" {
+		t.Errorf("body = %+v, want code %d and the status message", body, codes.InvalidArgument)
+	}
+	if len(body.Details) != 1 || !strings.HasSuffix(body.Details[0].Type, "google.rpc.BadRequest") ||
+		len(body.Details[0].FieldViolations) != 1 || body.Details[0].FieldViolations[0].Field != "password" {
+		t.Errorf("details = %+v, want BadRequest with password violation", body.Details)
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	conn := &fakeConn{header: metadata.Pairs(interceptors.RequestIDHeader, "req-42", "other", "value")}
+
+	r := loginRequest()
+	r.Header.Set("X-Request-Id", "req-42")
+	r.Header.Set("Authorization", "Bearer token")
+	w := serve(t, conn, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("HTTP status = %d, want 200", w.Code)
+	}
+	// В gRPC id уходит под своим именем, обратно - без префикса Grpc-Metadata-
+	if got := conn.incoming.Get(interceptors.RequestIDHeader); len(got) != 1 || got[0] != "req-42" {
+		t.Errorf("incoming %s = %v, want [req-42]", interceptors.RequestIDHeader, got)
+	}
+	if got := conn.incoming.Get("authorization"); len(got) != 1 || got[0] != "Bearer token" {
+		t.Errorf("incoming authorization = %v, want [Bearer token]", got)
+	}
+	if got := w.Header().Get("X-Request-Id"); got != "req-42" {
+		t.Errorf("response X-Request-Id = %q, want req-42", got)
+	}
+	if got := w.Header().Get("Grpc-Metadata-Other"); got != "value" {
+		t.Errorf("response Grpc-Metadata-Other = %q, want value", got)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	w := serve(t, &fakeConn{}, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	if w.Code != http.StatusOK || !json.Valid(w.Body.Bytes()) {
+		t.Errorf("GET %s = %d, valid JSON %v", OpenAPIPath, w.Code, json.Valid(w.Body.Bytes()))
+	}
+
+	w = serve(t, &fakeConn{}, httptest.NewRequest(http.MethodPost, OpenAPIPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST %s = %d, want %d", OpenAPIPath, w.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,47 @@
+package jwks
+
+import (
+	"context"
+	"encoding/json"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"net/http"
+)
+
+const Path = "/.well-known/jwks.json"
+
+type Provider interface {
+	JWKS(ctx context.Context) ([]models.JWK, error)
+}
+
+type response struct {
+	Keys []models.JWK `json:"keys"`
+}
+
+// Register registers handler of the JWKS document (RFC 7517)
+func Register(mux *http.ServeMux, log *slog.Logger, provider Provider) {
+	mux.HandleFunc(Path, func(w http.ResponseWriter, r *http.Request) {
+		const op = "http.jwks"
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		keys, err := provider.JWKS(r.Context())
+		if err != nil {
+			log.Error("failed to get jwks", slog.String("op", op), slogger.Err(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// Ключи меняются редко, но после ротации клиенты должны быстро увидеть новый
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(response{Keys: keys}); err != nil {
+			log.Error("failed to write jwks", slog.String("op", op), slogger.Err(err))
+		}
+	})
+}
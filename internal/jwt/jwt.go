@@ -1,31 +1,269 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"grpc_service/internal/domain/models"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-// TODO: Тесты
+// Поддерживаемые алгоритмы подписи
+const (
+	AlgHS256 = "HS256" // legacy: подпись общим секретом приложения
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrMalformed     = errors.New("token is malformed")
+	ErrExpired       = errors.New("token is expired")
+	ErrNotValidYet   = errors.New("token is not valid yet")
+	ErrBadSignature  = errors.New("token signature is invalid")
+	ErrInvalidClaims = errors.New("token claims are invalid")
+)
+
+// Key is a key to sign or verify tokens
+type Key struct {
+	ID        string // kid, пустой для HS256
+	Algorithm string
+	// []byte для HS256, crypto.PrivateKey для RS256 и EdDSA
+	// Для проверки подписи может быть пустым
+	Private interface{}
+	// []byte для HS256, crypto.PublicKey для RS256 и EdDSA
+	Public interface{}
+}
+
+// KeyFunc returns key to verify the token of the app
+// keyID and alg are taken from the token header
+type KeyFunc func(appID uint32, keyID string, alg string) (Key, error)
+
+// Params are the same for all issued tokens
+type Params struct {
+	Issuer string
+	TTL    time.Duration
+	// Дополнительно писать userID, appID и ext для старых потребителей
+	LegacyClaims bool
+	// Максимальный размер roles и scope в байтах, 0 - без ограничения
+	MaxAccessSize int
+}
+
+// Access - права пользователя в приложении, которые пишутся в токен
+// Пустые поля в токен не попадают
+type Access struct {
+	Roles []string
+	Scope []string
+}
+
+// Size returns approximate size of roles and scope claims in the token
+func (a Access) Size() int {
+	size := 0
+	for _, role := range a.Roles {
+		size += len(role) + 3 // кавычки и запятая
+	}
+	for _, permission := range a.Scope {
+		size += len(permission) + 1 // пробел
+	}
+	return size
+}
+
+// Claims are the verified claims of the token
+type Claims struct {
+	ID        string // jti
+	UserID    uint32
+	Email     string
+	AppID     uint32
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Access    Access
+}
+
+// tokenClaims - то, что пишется в токен
+// sub - id пользователя, aud - id приложения
+type tokenClaims struct {
+	jwt.StandardClaims
+	Email string   `json:"email"`
+	Roles []string `json:"roles,omitempty"`
+	// Права через пробел (RFC 8693)
+	Scope string `json:"scope,omitempty"`
+
+	// legacy
+	LegacyUserID uint32 `json:"userID,omitempty"`
+	LegacyAppID  uint32 `json:"appID,omitempty"`
+	LegacyExt    int64  `json:"ext,omitempty"`
+}
+
+// NewToken returns signed token and its claims
 func NewToken(
 	user models.User,
 	app models.App,
-	duration time.Duration,
-) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256) //?-Какой выбрать метод
-
-	claims := token.Claims.(jwt.MapClaims)
-	claims["userID"] = user.ID
-	claims["email"] = user.Email
-	claims["ext"] = time.Now().Add(duration).Unix()
-	claims["appID"] = app.ID
-
-	//!-Быть аккуратным и не залогировать app.Secret
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	key Key,
+	params Params,
+	access Access,
+) (string, Claims, error) {
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return "", Claims{}, fmt.Errorf("unsupported signing method %q", key.Algorithm)
+	}
+
+	id, err := newTokenID()
 	if err != nil {
-		return "", err
+		return "", Claims{}, err
+	}
+
+	now := time.Now()
+	claims := tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        id,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Audience:  strconv.FormatUint(uint64(app.ID), 10),
+			Issuer:    params.Issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(params.TTL).Unix(),
+		},
+		Email: user.Email,
+		Roles: access.Roles,
+		Scope: strings.Join(access.Scope, " "),
+	}
+
+	if params.LegacyClaims {
+		claims.LegacyUserID = user.ID
+		claims.LegacyAppID = app.ID
+		claims.LegacyExt = claims.ExpiresAt
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	//!-Быть аккуратным и не залогировать app.Secret и приватные ключи
+	tokenString, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", Claims{}, err
+	}
+
+	return tokenString, Claims{
+		ID:        id,
+		UserID:    user.ID,
+		Email:     user.Email,
+		AppID:     app.ID,
+		IssuedAt:  time.Unix(claims.IssuedAt, 0),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		Access:    access,
+	}, nil
+}
+
+// ParseToken verifies signature of the token with the key returned by keyFunc
+// Error of keyFunc is returned as is, so the caller can detect unknown app
+// Claims of the expired token are returned along with ErrExpired
+func ParseToken(
+	tokenString string,
+	issuer string,
+	keyFunc KeyFunc,
+) (Claims, error) {
+	var tc tokenClaims
+
+	_, err := jwt.ParseWithClaims(tokenString, &tc, func(token *jwt.Token) (interface{}, error) {
+		appID, err := parseID(tc.Audience)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		keyID, _ := token.Header["kid"].(string)
+
+		key, err := keyFunc(appID, keyID, token.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+
+		// Алгоритм задаёт сервер, а не заголовок токена (alg confusion)
+		if key.Algorithm != token.Method.Alg() {
+			return nil, fmt.Errorf("%w: unexpected signing method %s", ErrBadSignature, token.Method.Alg())
+		}
+
+		return key.Public, nil
+	})
+
+	var claims Claims
+	if err != nil {
+		var ve *jwt.ValidationError
+		if !errors.As(err, &ve) {
+			return claims, err
+		}
+		switch {
+		case ve.Errors&jwt.ValidationErrorMalformed != 0:
+			return claims, ErrMalformed
+		case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return claims, ErrBadSignature
+		case ve.Errors&jwt.ValidationErrorUnverifiable != 0 && ve.Inner != nil:
+			// Ошибка из keyFunc
+			return claims, ve.Inner
+		case ve.Errors&jwt.ValidationErrorExpired != 0:
+			// Подпись проверена, можно вернуть claims
+			claims, cErr := tc.claims()
+			if cErr != nil {
+				return Claims{}, cErr
+			}
+			return claims, ErrExpired
+		case ve.Errors&(jwt.ValidationErrorNotValidYet|jwt.ValidationErrorIssuedAt) != 0:
+			return claims, ErrNotValidYet
+		}
+		return claims, err
+	}
+
+	if tc.Issuer != issuer {
+		return claims, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, tc.Issuer)
+	}
+
+	return tc.claims()
+}
+
+func (tc tokenClaims) claims() (Claims, error) {
+	userID, err := parseID(tc.Subject)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: bad sub", ErrInvalidClaims)
+	}
+	appID, err := parseID(tc.Audience)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: bad aud", ErrInvalidClaims)
+	}
+	if tc.Id == "" || tc.ExpiresAt == 0 || tc.IssuedAt == 0 {
+		return Claims{}, fmt.Errorf("%w: missing jti, exp or iat", ErrInvalidClaims)
 	}
 
-	return tokenString, nil
+	return Claims{
+		ID:        tc.Id,
+		UserID:    userID,
+		Email:     tc.Email,
+		AppID:     appID,
+		IssuedAt:  time.Unix(tc.IssuedAt, 0),
+		ExpiresAt: time.Unix(tc.ExpiresAt, 0),
+		Access: Access{
+			Roles: tc.Roles,
+			Scope: strings.Fields(tc.Scope),
+		},
+	}, nil
+}
+
+func parseID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(id), nil
+}
+
+// newTokenID generates unique jti
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
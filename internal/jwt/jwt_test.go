@@ -0,0 +1,327 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "sso-test"
+
+var (
+	testUser = models.User{ID: 42, Email: "user@example.com"}
+	testApp  = models.App{ID: 7, Name: "test", Secret: "test-secret"}
+)
+
+func hsKey(secret string) Key {
+	return Key{Algorithm: AlgHS256, Private: []byte(secret), Public: []byte(secret)}
+}
+
+func staticKey(key Key) KeyFunc {
+	return func(uint32, string, string) (Key, error) {
+		return key, nil
+	}
+}
+
+// payload decodes claims of the token without verification
+func payload(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token has %d parts, want 3", len(parts))
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+
+	return claims
+}
+
+func TestNewToken_RegisteredClaims(t *testing.T) {
+	params := Params{Issuer: testIssuer, TTL: time.Hour}
+
+	before := time.Now().Unix()
+	token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), params, Access{})
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+	after := time.Now().Unix()
+
+	claims := payload(t, token)
+
+	if got := claims["sub"]; got != "42" {
+		t.Errorf("sub = %v, want 42", got)
+	}
+	if got := claims["aud"]; got != "7" {
+		t.Errorf("aud = %v, want 7", got)
+	}
+	if got := claims["iss"]; got != testIssuer {
+		t.Errorf("iss = %v, want %s", got, testIssuer)
+	}
+	if got := claims["email"]; got != testUser.Email {
+		t.Errorf("email = %v, want %s", got, testUser.Email)
+	}
+	if jti, _ := claims["jti"].(string); jti == "" {
+		t.Errorf("jti is empty")
+	}
+
+	iat, _ := claims["iat"].(float64)
+	if int64(iat) < before || int64(iat) > after {
+		t.Errorf("iat = %v, want between %d and %d", iat, before, after)
+	}
+	if nbf, _ := claims["nbf"].(float64); nbf != iat {
+		t.Errorf("nbf = %v, want %v", nbf, iat)
+	}
+	if exp, _ := claims["exp"].(float64); int64(exp) != int64(iat)+int64(time.Hour.Seconds()) {
+		t.Errorf("exp = %v, want iat + 1h", exp)
+	}
+
+	for _, key := range []string{"userID", "appID", "ext"} {
+		if _, ok := claims[key]; ok {
+			t.Errorf("legacy claim %q is present without LegacyClaims", key)
+		}
+	}
+	for _, key := range []string{"roles", "scope"} {
+		if _, ok := claims[key]; ok {
+			t.Errorf("claim %q is present without Access", key)
+		}
+	}
+}
+
+func TestNewToken_Access(t *testing.T) {
+	params := Params{Issuer: testIssuer, TTL: time.Hour}
+	access := Access{
+		Roles: []string{"admin", "editor"},
+		Scope: []string{"posts:read", "posts:write"},
+	}
+
+	token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), params, access)
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+
+	raw := payload(t, token)
+	if got := raw["scope"]; got != "posts:read posts:write" {
+		t.Errorf("scope = %v, want space separated permissions", got)
+	}
+	if roles, _ := raw["roles"].([]interface{}); len(roles) != 2 {
+		t.Errorf("roles = %v, want 2 roles", raw["roles"])
+	}
+
+	claims, err := ParseToken(token, testIssuer, staticKey(hsKey(testApp.Secret)))
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if strings.Join(claims.Access.Roles, ",") != "admin,editor" {
+		t.Errorf("Access.Roles = %v, want %v", claims.Access.Roles, access.Roles)
+	}
+	if strings.Join(claims.Access.Scope, ",") != "posts:read,posts:write" {
+		t.Errorf("Access.Scope = %v, want %v", claims.Access.Scope, access.Scope)
+	}
+}
+
+func TestNewToken_LegacyClaims(t *testing.T) {
+	params := Params{Issuer: testIssuer, TTL: time.Hour, LegacyClaims: true}
+
+	token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), params, Access{})
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+
+	claims := payload(t, token)
+
+	if got, _ := claims["userID"].(float64); uint32(got) != testUser.ID {
+		t.Errorf("userID = %v, want %d", got, testUser.ID)
+	}
+	if got, _ := claims["appID"].(float64); uint32(got) != testApp.ID {
+		t.Errorf("appID = %v, want %d", got, testApp.ID)
+	}
+	if claims["ext"] != claims["exp"] {
+		t.Errorf("ext = %v, want exp %v", claims["ext"], claims["exp"])
+	}
+	if got := claims["sub"]; got != "42" {
+		t.Errorf("sub = %v, want 42", got)
+	}
+}
+
+func TestNewToken_UniqueID(t *testing.T) {
+	params := Params{Issuer: testIssuer, TTL: time.Hour}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), params, Access{})
+		if err != nil {
+			t.Fatalf("NewToken: %v", err)
+		}
+		jti := payload(t, token)["jti"].(string)
+		if seen[jti] {
+			t.Fatalf("jti %s is issued twice", jti)
+		}
+		seen[jti] = true
+	}
+}
+
+func TestNewToken_KeyID(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key := Key{ID: "key-1", Algorithm: AlgEdDSA, Private: private, Public: public}
+
+	token, _, err := NewToken(testUser, testApp, key, Params{Issuer: testIssuer, TTL: time.Hour}, Access{})
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+
+	var gotKeyID string
+	claims, err := ParseToken(token, testIssuer, func(appID uint32, keyID string, alg string) (Key, error) {
+		gotKeyID = keyID
+		return key, nil
+	})
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if gotKeyID != "key-1" {
+		t.Errorf("kid = %q, want key-1", gotKeyID)
+	}
+	if claims.UserID != testUser.ID {
+		t.Errorf("UserID = %d, want %d", claims.UserID, testUser.ID)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	params := Params{Issuer: testIssuer, TTL: time.Hour}
+
+	token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), params, Access{})
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+
+	var gotAppID uint32
+	claims, err := ParseToken(token, testIssuer, func(appID uint32, keyID string, alg string) (Key, error) {
+		gotAppID = appID
+		return hsKey(testApp.Secret), nil
+	})
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+
+	if gotAppID != testApp.ID {
+		t.Errorf("keyFunc got appID %d, want %d", gotAppID, testApp.ID)
+	}
+	if claims.UserID != testUser.ID || claims.AppID != testApp.ID || claims.Email != testUser.Email {
+		t.Errorf("claims = %+v, want user %d, app %d, email %s", claims, testUser.ID, testApp.ID, testUser.Email)
+	}
+	if claims.ID == "" {
+		t.Errorf("claims.ID is empty")
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt); ttl != time.Hour {
+		t.Errorf("exp - iat = %v, want 1h", ttl)
+	}
+}
+
+func TestParseToken_Errors(t *testing.T) {
+	valid := Params{Issuer: testIssuer, TTL: time.Hour}
+	expired := Params{Issuer: testIssuer, TTL: -time.Minute}
+
+	errAppNotFound := errors.New("app not found")
+
+	tests := []struct {
+		name    string
+		params  Params
+		issuer  string
+		keyFunc KeyFunc
+		wantErr error
+	}{
+		{
+			name:    "expired",
+			params:  expired,
+			issuer:  testIssuer,
+			keyFunc: staticKey(hsKey(testApp.Secret)),
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "bad signature",
+			params:  valid,
+			issuer:  testIssuer,
+			keyFunc: staticKey(hsKey("other-secret")),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:   "algorithm mismatch",
+			params: valid,
+			issuer: testIssuer,
+			keyFunc: staticKey(Key{
+				Algorithm: AlgRS256,
+				Public:    []byte(testApp.Secret),
+			}),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "other issuer",
+			params:  valid,
+			issuer:  "someone-else",
+			keyFunc: staticKey(hsKey(testApp.Secret)),
+			wantErr: ErrInvalidClaims,
+		},
+		{
+			name:   "unknown app",
+			params: valid,
+			issuer: testIssuer,
+			keyFunc: func(uint32, string, string) (Key, error) {
+				return Key{}, errAppNotFound
+			},
+			wantErr: errAppNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), tt.params, Access{})
+			if err != nil {
+				t.Fatalf("NewToken: %v", err)
+			}
+
+			_, err = ParseToken(token, tt.issuer, tt.keyFunc)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseToken error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseToken_ExpiredReturnsClaims(t *testing.T) {
+	token, _, err := NewToken(testUser, testApp, hsKey(testApp.Secret), Params{Issuer: testIssuer, TTL: -time.Minute}, Access{})
+	if err != nil {
+		t.Fatalf("NewToken: %v", err)
+	}
+
+	claims, err := ParseToken(token, testIssuer, staticKey(hsKey(testApp.Secret)))
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("ParseToken error = %v, want %v", err, ErrExpired)
+	}
+	if claims.UserID != testUser.ID {
+		t.Errorf("UserID = %d, want %d", claims.UserID, testUser.ID)
+	}
+}
+
+func TestParseToken_Malformed(t *testing.T) {
+	_, err := ParseToken("not.a.token", testIssuer, staticKey(hsKey(testApp.Secret)))
+	if !errors.Is(err, ErrMalformed) {
+		t.Errorf("ParseToken error = %v, want %v", err, ErrMalformed)
+	}
+}
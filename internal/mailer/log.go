@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+)
+
+// Log writes messages to the log instead of sending them
+// Тело письма (со ссылками и токенами) попадает в лог, поэтому только для разработки
+type Log struct {
+	log *slog.Logger
+}
+
+func NewLog(log *slog.Logger) *Log {
+	return &Log{
+		log: log,
+	}
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+
+	slogger.FromContext(ctx, l.log).Info("mail",
+		slog.String("from", msg.From),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
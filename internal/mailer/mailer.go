@@ -0,0 +1,105 @@
+// Package mailer sends email messages.
+// Отправка через SMTP, в лог (для разработки) или в каталог-спул (.eml файлы, для тестов и внешней отправки)
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Message - письмо из одной текстовой части
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// validate checks addresses and rejects line breaks in headers
+func (m Message) validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("%w: from: %v", ErrInvalidMessage, err)
+	}
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return fmt.Errorf("%w: to: %v", ErrInvalidMessage, err)
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("%w: subject contains line break", ErrInvalidMessage)
+	}
+	return nil
+}
+
+// envelope returns bare addresses for MAIL FROM and RCPT TO
+func (m Message) envelope() (from string, to string, err error) {
+	fromAddr, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: from: %v", ErrInvalidMessage, err)
+	}
+	toAddr, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: to: %v", ErrInvalidMessage, err)
+	}
+	return fromAddr.Address, toAddr.Address, nil
+}
+
+// Bytes returns the message in RFC 5322 format, тело в quoted-printable
+func (m Message) Bytes(date time.Time) ([]byte, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	messageID, err := newMessageID(m.From)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	header := func(name string, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", m.From)
+	header("To", m.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// newMessageID returns random Message-ID in the domain of the sender
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndexByte(addr.Address, '@'); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testMessage = Message{
+	From:    "SSO <sso@example.com>",
+	To:      "user@example.com",
+	Subject: "Подтверждение email",
+	Body:    "Перейдите по ссылке:\nhttps://example.com/verify?token=abc.def\n",
+}
+
+func TestSpool(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spool")
+	spool, err := NewSpool(dir)
+	if err != nil {
+		t.Fatalf("NewSpool: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := spool.Send(context.Background(), testMessage); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("spool has %v, want 2 files", files)
+	}
+	for _, file := range files {
+		if filepath.Ext(file) != ".eml" {
+			t.Errorf("file %s, want .eml", file)
+		}
+	}
+
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+
+	var dec mime.WordDecoder
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != testMessage.Subject {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, testMessage.Subject)
+	}
+	if to := msg.Header.Get("To"); to != testMessage.To {
+		t.Errorf("To = %q, want %q", to, testMessage.To)
+	}
+	if msg.Header.Get("Message-ID") == "" || msg.Header.Get("Date") == "" {
+		t.Errorf("headers %v, want Message-ID and Date", msg.Header)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	want := "Перейдите по ссылке:\r\nhttps://example.com/verify?token=abc.def\r\n"
+	if string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestInvalidMessage(t *testing.T) {
+	spool, err := NewSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSpool: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *Message)
+	}{
+		{"bad to", func(m *Message) { m.To = "not an email" }},
+		{"header injection in to", func(m *Message) { m.To = "user@example.com\r\nBcc: other@example.com" }},
+		{"header injection in subject", func(m *Message) { m.Subject = "hi\r\nBcc: other@example.com" }},
+		{"empty from", func(m *Message) { m.From = "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage
+			tt.modify(&msg)
+
+			if err := spool.Send(context.Background(), msg); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("Send: err = %v, want %v", err, ErrInvalidMessage)
+			}
+			if err := NewLog(nil).Send(context.Background(), msg); !errors.Is(err, ErrInvalidMessage) {
+				t.Errorf("Log.Send: err = %v, want %v", err, ErrInvalidMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Spool writes every message to a separate .eml file in the directory
+// Файл сначала пишется во временный и переименовывается, поэтому читатель спула не видит недописанных писем
+type Spool struct {
+	dir string
+	now func() time.Time
+}
+
+func NewSpool(dir string) (*Spool, error) {
+	const op = "mailer.NewSpool"
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Spool{
+		dir: dir,
+		now: time.Now,
+	}, nil
+}
+
+func (s *Spool) Send(_ context.Context, msg Message) error {
+	const op = "mailer.Spool.Send"
+
+	now := s.now()
+	data, err := msg.Bytes(now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Имя начинается со времени, чтобы файлы сортировались в порядке отправки
+	prefix := strconv.FormatInt(now.UnixNano(), 10) + "-"
+	tmp, err := os.CreateTemp(s.dir, prefix+"*.tmp")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	name := tmpName[:len(tmpName)-len(filepath.Ext(tmpName))] + ".eml"
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
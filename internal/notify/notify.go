@@ -0,0 +1,105 @@
+// Package notify sends out-of-band notices to users by email.
+// Как письмо доставляется (SMTP, лог, спул), решает Mailer
+package notify
+
+import (
+	"context"
+	"fmt"
+	"grpc_service/internal/mailer"
+)
+
+// Mailer delivers a single message
+type Mailer interface {
+	Send(ctx context.Context, msg mailer.Message) error
+}
+
+// Notifier composes notices and sends them through Mailer
+type Notifier struct {
+	mailer Mailer
+	// Адрес отправителя: "SSO <no-reply@example.com>"
+	from string
+}
+
+func New(mailer Mailer, from string) *Notifier {
+	return &Notifier{
+		mailer: mailer,
+		from:   from,
+	}
+}
+
+// RegistrationAttempt tells the owner of the email that someone tried to register with it
+func (n *Notifier) RegistrationAttempt(ctx context.Context, email string) error {
+	const op = "notify.RegistrationAttempt"
+
+	err := n.mailer.Send(ctx, mailer.Message{
+		From:    n.from,
+		To:      email,
+		Subject: "Registration attempt",
+		Body: "Someone tried to create an account with this email address.\n" +
+			"You already have an account, so nothing has changed.\n" +
+			"If it was you, sign in or reset your password. Otherwise, ignore this message.\n",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EmailVerification sends the link confirming the email
+func (n *Notifier) EmailVerification(ctx context.Context, email string, link string) error {
+	const op = "notify.EmailVerification"
+
+	err := n.mailer.Send(ctx, mailer.Message{
+		From:    n.from,
+		To:      email,
+		Subject: "Confirm your email",
+		Body: "To confirm your email address, open the link:\n" +
+			link + "\n\n" +
+			"If you did not create an account, ignore this message.\n",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordReset sends the password reset link
+func (n *Notifier) PasswordReset(ctx context.Context, email string, link string) error {
+	const op = "notify.PasswordReset"
+
+	err := n.mailer.Send(ctx, mailer.Message{
+		From:    n.from,
+		To:      email,
+		Subject: "Reset your password",
+		Body: "To set a new password, open the link:\n" +
+			link + "\n\n" +
+			"The link works once and expires soon. After the reset you will be signed out everywhere.\n" +
+			"If you did not request a password reset, ignore this message.\n",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// EmailChange sends the link confirming the new email to the new address
+func (n *Notifier) EmailChange(ctx context.Context, newEmail string, link string) error {
+	const op = "notify.EmailChange"
+
+	err := n.mailer.Send(ctx, mailer.Message{
+		From:    n.from,
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body: "To use this address for your account, open the link:\n" +
+			link + "\n\n" +
+			"If you did not request an email change, ignore this message.\n",
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
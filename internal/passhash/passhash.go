@@ -0,0 +1,347 @@
+// Package passhash hashes and verifies passwords.
+// Хэши хранятся в формате PHC (https://github.com/P-H-C/phc-string-format):
+//
+//	$argon2id$v=19$m=65536,t=3,p=2[,pepper=1]$<salt>$<hash>
+//	$bcrypt-sha256$v=2,t=2a,r=12[,pepper=1]$<salt>$<hash>
+//
+// t - вариант bcrypt, pepper=1 - при хэшировании подмешивался pepper.
+// Старые хэши bcrypt ($2a$...) проверяются и при входе пересчитываются в текущий формат
+package passhash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Поддерживаемые алгоритмы
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+const (
+	phcArgon2id     = "argon2id"
+	phcBcryptSHA256 = "bcrypt-sha256"
+
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+
+	bcryptSHA256Version = 2
+	bcryptSaltSize      = 22 // символов в bcrypt base64
+)
+
+var (
+	ErrMismatch       = errors.New("password does not match")
+	ErrUnknownFormat  = errors.New("unknown password hash format")
+	ErrPepperRequired = errors.New("password hash is peppered, but pepper is not configured")
+)
+
+// Params of new hashes. Хэши с другими параметрами проверяются, но требуют пересчёта
+type Params struct {
+	Algorithm  string
+	BcryptCost int
+	// Память в KiB, число проходов и потоков argon2id
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+	// Секрет сервера, подмешивается в пароль через HMAC-SHA256. Пустой - без pepper
+	Pepper []byte
+	// Сколько хэшей считается одновременно, 0 - GOMAXPROCS
+	// Каждый argon2id держит Argon2Memory, без ограничения поток входов съедает всю память
+	MaxConcurrent int
+}
+
+// Hasher hashes passwords with the configured params. Safe for concurrent use
+type Hasher struct {
+	params Params
+	// Семафор: остальные вызовы ждут свободного места
+	sem chan struct{}
+}
+
+// New checks params and returns a hasher
+func New(params Params) (*Hasher, error) {
+	switch params.Algorithm {
+	case AlgArgon2id:
+		if params.Argon2Memory == 0 || params.Argon2Time == 0 || params.Argon2Threads == 0 {
+			return nil, fmt.Errorf("argon2id memory, time and threads must be positive")
+		}
+	case AlgBcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password algorithm %q", params.Algorithm)
+	}
+	if params.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("max concurrent hashes must not be negative")
+	}
+
+	limit := params.MaxConcurrent
+	if limit == 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+
+	return &Hasher{params: params, sem: make(chan struct{}, limit)}, nil
+}
+
+// acquire takes a place in the semaphore and returns its release
+func (h *Hasher) acquire() func() {
+	h.sem <- struct{}{}
+	return func() { <-h.sem }
+}
+
+// Hash returns PHC string of the password hash
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	defer h.acquire()()
+
+	peppered := len(h.params.Pepper) > 0
+	input := h.input(password, peppered)
+
+	switch h.params.Algorithm {
+	case AlgArgon2id:
+		salt := make([]byte, argon2SaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		p := argon2Params{
+			memory:   h.params.Argon2Memory,
+			time:     h.params.Argon2Time,
+			threads:  h.params.Argon2Threads,
+			peppered: peppered,
+		}
+		key := argon2.IDKey(input, salt, p.time, p.memory, p.threads, argon2KeySize)
+		return []byte(p.encode(salt, key)), nil
+
+	case AlgBcrypt:
+		hash, err := bcrypt.GenerateFromPassword(prehash(input), h.params.BcryptCost)
+		if err != nil {
+			return nil, err
+		}
+		return encodeBcryptSHA256(hash, peppered)
+	}
+
+	return nil, fmt.Errorf("unsupported password algorithm %q", h.params.Algorithm)
+}
+
+// Verify checks the password against the hash
+// needsRehash - пароль верный, но хэш сделан другим алгоритмом, с другими параметрами или без pepper
+// Wrong password returns ErrMismatch
+func (h *Hasher) Verify(hash []byte, password string) (needsRehash bool, err error) {
+	defer h.acquire()()
+
+	s := string(hash)
+
+	switch {
+	case strings.HasPrefix(s, "$"+phcArgon2id+"$"):
+		p, salt, key, err := decodeArgon2(s)
+		if err != nil {
+			return false, err
+		}
+		input, err := h.verifyInput(password, p.peppered)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey(input, salt, p.time, p.memory, p.threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, ErrMismatch
+		}
+		return h.params.Algorithm != AlgArgon2id ||
+			p.memory != h.params.Argon2Memory ||
+			p.time != h.params.Argon2Time ||
+			p.threads != h.params.Argon2Threads ||
+			p.peppered != (len(h.params.Pepper) > 0), nil
+
+	case strings.HasPrefix(s, "$"+phcBcryptSHA256+"$"):
+		bcryptHash, peppered, err := decodeBcryptSHA256(s)
+		if err != nil {
+			return false, err
+		}
+		input, err := h.verifyInput(password, peppered)
+		if err != nil {
+			return false, err
+		}
+		if err := compareBcrypt(bcryptHash, prehash(input)); err != nil {
+			return false, err
+		}
+		cost, err := bcrypt.Cost(bcryptHash)
+		if err != nil {
+			return false, err
+		}
+		return h.params.Algorithm != AlgBcrypt ||
+			cost != h.params.BcryptCost ||
+			peppered != (len(h.params.Pepper) > 0), nil
+
+	case strings.HasPrefix(s, "$2a$"), strings.HasPrefix(s, "$2b$"), strings.HasPrefix(s, "$2y$"):
+		// Старый формат: bcrypt от самого пароля, без pepper
+		if err := compareBcrypt(hash, []byte(password)); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	return false, ErrUnknownFormat
+}
+
+// input returns what is actually hashed
+func (h *Hasher) input(password string, peppered bool) []byte {
+	if !peppered {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, h.params.Pepper)
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+func (h *Hasher) verifyInput(password string, peppered bool) ([]byte, error) {
+	if peppered && len(h.params.Pepper) == 0 {
+		return nil, ErrPepperRequired
+	}
+	return h.input(password, peppered), nil
+}
+
+func compareBcrypt(hash []byte, input []byte) error {
+	err := bcrypt.CompareHashAndPassword(hash, input)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+// prehash makes bcrypt input shorter than 72 bytes and without zero bytes
+// Сам bcrypt молча обрезает пароли длиннее 72 байт
+func prehash(input []byte) []byte {
+	sum := sha256.Sum256(input)
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// argon2Params are params of the argon2id PHC string
+type argon2Params struct {
+	memory   uint32
+	time     uint32
+	threads  uint8
+	peppered bool
+}
+
+func (p argon2Params) encode(salt, key []byte) string {
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", p.memory, p.time, p.threads)
+	if p.peppered {
+		params += ",pepper=1"
+	}
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s",
+		phcArgon2id,
+		argon2.Version,
+		params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(s string) (argon2Params, []byte, []byte, error) {
+	// "", argon2id, v=19, params, salt, hash
+	parts := strings.Split(s, "$")
+	if len(parts) != 6 || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return argon2Params{}, nil, nil, ErrUnknownFormat
+	}
+
+	var p argon2Params
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return argon2Params{}, nil, nil, ErrUnknownFormat
+		}
+		switch name {
+		case "m":
+			p.memory = uint32(n)
+		case "t":
+			p.time = uint32(n)
+		case "p":
+			if n > 255 {
+				return argon2Params{}, nil, nil, ErrUnknownFormat
+			}
+			p.threads = uint8(n)
+		case "pepper":
+			p.peppered = n == 1
+		default:
+			return argon2Params{}, nil, nil, ErrUnknownFormat
+		}
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return argon2Params{}, nil, nil, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, ErrUnknownFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, ErrUnknownFormat
+	}
+
+	return p, salt, key, nil
+}
+
+// encodeBcryptSHA256 converts "$2a$12$<salt><hash>" to "$bcrypt-sha256$v=2,t=2a,r=12$<salt>$<hash>"
+func encodeBcryptSHA256(hash []byte, peppered bool) ([]byte, error) {
+	// "", 2a, 12, salt+hash
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 4 || len(parts[3]) <= bcryptSaltSize {
+		return nil, ErrUnknownFormat
+	}
+
+	params := fmt.Sprintf("v=%d,t=%s,r=%s", bcryptSHA256Version, parts[1], parts[2])
+	if peppered {
+		params += ",pepper=1"
+	}
+
+	return []byte(fmt.Sprintf("$%s$%s$%s$%s",
+		phcBcryptSHA256, params, parts[3][:bcryptSaltSize], parts[3][bcryptSaltSize:])), nil
+}
+
+// decodeBcryptSHA256 returns bcrypt hash back in the "$2a$12$..." form
+func decodeBcryptSHA256(s string) ([]byte, bool, error) {
+	// "", bcrypt-sha256, params, salt, hash
+	parts := strings.Split(s, "$")
+	if len(parts) != 5 {
+		return nil, false, ErrUnknownFormat
+	}
+
+	var (
+		variant, cost string
+		peppered      bool
+	)
+	for _, param := range strings.Split(parts[2], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		switch name {
+		case "v":
+			if value != strconv.Itoa(bcryptSHA256Version) {
+				return nil, false, ErrUnknownFormat
+			}
+		case "t":
+			variant = value
+		case "r":
+			cost = value
+		case "pepper":
+			peppered = value == "1"
+		default:
+			return nil, false, ErrUnknownFormat
+		}
+	}
+	if variant == "" || cost == "" {
+		return nil, false, ErrUnknownFormat
+	}
+
+	return []byte(fmt.Sprintf("$%s$%s$%s%s", variant, cost, parts[3], parts[4])), peppered, nil
+}
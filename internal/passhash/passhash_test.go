@@ -0,0 +1,243 @@
+package passhash
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Маленькие параметры, чтобы тесты шли быстро
+var (
+	testArgon2 = Params{
+		Algorithm:     AlgArgon2id,
+		Argon2Memory:  64,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+	}
+	testBcrypt = Params{
+		Algorithm:  AlgBcrypt,
+		BcryptCost: bcrypt.MinCost,
+	}
+)
+
+func newHasher(t *testing.T, params Params) *Hasher {
+	t.Helper()
+
+	h, err := New(params)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return h
+}
+
+func hash(t *testing.T, h *Hasher, password string) []byte {
+	t.Helper()
+
+	hash, err := h.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	return hash
+}
+
+func TestRoundTrip(t *testing.T) {
+	withPepper := func(p Params) Params {
+		p.Pepper = []byte("server-secret")
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		params Params
+		prefix string
+	}{
+		{"argon2id", testArgon2, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{"argon2id pepper", withPepper(testArgon2), "$argon2id$v=19$m=64,t=1,p=1,pepper=1$"},
+		{"bcrypt", testBcrypt, "$bcrypt-sha256$v=2,t=2a,r=04$"},
+		{"bcrypt pepper", withPepper(testBcrypt), "$bcrypt-sha256$v=2,t=2a,r=04,pepper=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHasher(t, tt.params)
+			got := hash(t, h, "correct horse")
+
+			if !strings.HasPrefix(string(got), tt.prefix) {
+				t.Fatalf("hash = %q, want prefix %q", got, tt.prefix)
+			}
+
+			needsRehash, err := h.Verify(got, "correct horse")
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if needsRehash {
+				t.Error("fresh hash needs rehash")
+			}
+
+			if _, err := h.Verify(got, "wrong horse"); !errors.Is(err, ErrMismatch) {
+				t.Errorf("Verify wrong password: err = %v, want ErrMismatch", err)
+			}
+		})
+	}
+}
+
+func TestSaltIsRandom(t *testing.T) {
+	h := newHasher(t, testArgon2)
+
+	if string(hash(t, h, "password")) == string(hash(t, h, "password")) {
+		t.Error("two hashes of the same password are equal")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	changed := func(p Params, change func(p *Params)) Params {
+		change(&p)
+		return p
+	}
+
+	tests := []struct {
+		name string
+		old  Params
+		new  Params
+	}{
+		{"argon2 memory", testArgon2, changed(testArgon2, func(p *Params) { p.Argon2Memory = 128 })},
+		{"argon2 time", testArgon2, changed(testArgon2, func(p *Params) { p.Argon2Time = 2 })},
+		{"argon2 threads", testArgon2, changed(testArgon2, func(p *Params) { p.Argon2Threads = 2 })},
+		{"bcrypt cost", testBcrypt, changed(testBcrypt, func(p *Params) { p.BcryptCost = bcrypt.MinCost + 1 })},
+		{"bcrypt to argon2", testBcrypt, testArgon2},
+		{"argon2 to bcrypt", testArgon2, testBcrypt},
+		{"pepper added", testArgon2, changed(testArgon2, func(p *Params) { p.Pepper = []byte("secret") })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := hash(t, newHasher(t, tt.old), "password")
+
+			needsRehash, err := newHasher(t, tt.new).Verify(old, "password")
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !needsRehash {
+				t.Error("needsRehash = false, want true")
+			}
+		})
+	}
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, params := range []Params{testArgon2, testBcrypt} {
+		h := newHasher(t, params)
+
+		needsRehash, err := h.Verify(legacy, "password")
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", params.Algorithm, err)
+		}
+		if !needsRehash {
+			t.Errorf("%s: legacy hash does not need rehash", params.Algorithm)
+		}
+
+		if _, err := h.Verify(legacy, "wrong"); !errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: Verify wrong password: err = %v, want ErrMismatch", params.Algorithm, err)
+		}
+	}
+}
+
+func TestPepper(t *testing.T) {
+	params := testArgon2
+	params.Pepper = []byte("secret")
+	peppered := hash(t, newHasher(t, params), "password")
+
+	if _, err := newHasher(t, testArgon2).Verify(peppered, "password"); !errors.Is(err, ErrPepperRequired) {
+		t.Errorf("Verify without pepper: err = %v, want ErrPepperRequired", err)
+	}
+
+	params.Pepper = []byte("other")
+	if _, err := newHasher(t, params).Verify(peppered, "password"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify with other pepper: err = %v, want ErrMismatch", err)
+	}
+}
+
+// bcrypt сам по себе не различает пароли, совпадающие в первых 72 байтах
+func TestBcryptLongPassword(t *testing.T) {
+	h := newHasher(t, testBcrypt)
+	long := strings.Repeat("a", 80)
+	got := hash(t, h, long+"1")
+
+	if _, err := h.Verify(got, long+"2"); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify: err = %v, want ErrMismatch", err)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	h := newHasher(t, testArgon2)
+
+	for _, hash := range []string{
+		"",
+		"plain",
+		"$scrypt$ln=16,r=8,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$aGFzaA",
+		"$bcrypt-sha256$v=1,t=2a,r=04$salt$hash",
+	} {
+		if _, err := h.Verify([]byte(hash), "password"); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Verify(%q): err = %v, want ErrUnknownFormat", hash, err)
+		}
+	}
+}
+
+func TestNewInvalidParams(t *testing.T) {
+	for _, params := range []Params{
+		{},
+		{Algorithm: "md5"},
+		{Algorithm: AlgArgon2id},
+		{Algorithm: AlgBcrypt, BcryptCost: 1},
+		{Algorithm: AlgBcrypt, BcryptCost: bcrypt.MinCost, MaxConcurrent: -1},
+	} {
+		if _, err := New(params); err == nil {
+			t.Errorf("New(%+v): err = nil", params)
+		}
+	}
+}
+
+// Сверх MaxConcurrent хэширование и проверка ждут, пока освободится место
+func TestMaxConcurrent(t *testing.T) {
+	params := testArgon2
+	params.MaxConcurrent = 1
+	h := newHasher(t, params)
+	stored := hash(t, h, "password")
+
+	release := h.acquire()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = h.Hash("password")
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = h.Verify(stored, "password")
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("hash computed while the semaphore is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("hash is not computed after release")
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package passpolicy checks new passwords against the configured rules.
+// Проверяются новые пароли (регистрация, смена), при входе проверяется только max_length
+package passpolicy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Правила, имя попадает в ответ клиенту
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxLength     = "max_length"
+	RuleUpper         = "upper"
+	RuleLower         = "lower"
+	RuleDigit         = "digit"
+	RuleSymbol        = "symbol"
+	RuleContainsEmail = "contains_email"
+	RuleBreached      = "breached"
+)
+
+// Слишком короткая локальная часть email (например, "a@x.io") встречается в паролях случайно
+const minEmailPartLength = 3
+
+// Rules of the policy. Длины считаются в символах, а не байтах
+type Rules struct {
+	MinLength     int
+	MaxLength     int // 0 - без ограничения
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Запрещать пароли, содержащие локальную часть email
+	RejectEmail bool
+	// Файл с распространёнными и утёкшими паролями, по одному в строке. Пустой - не проверять
+	BreachedFile string
+}
+
+// Violation is a failed rule
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Error lists every failed rule
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return "password does not satisfy policy: " + strings.Join(rules, ", ")
+}
+
+// Policy checks passwords. Safe for concurrent use
+type Policy struct {
+	rules    Rules
+	breached map[string]struct{}
+}
+
+// New loads breached passwords list and returns the policy
+func New(rules Rules) (*Policy, error) {
+	const op = "passpolicy.New"
+
+	if rules.MaxLength > 0 && rules.MaxLength < rules.MinLength {
+		return nil, fmt.Errorf("%s: max length %d is less than min length %d", op, rules.MaxLength, rules.MinLength)
+	}
+
+	p := &Policy{rules: rules}
+
+	if rules.BreachedFile != "" {
+		breached, err := loadBreached(rules.BreachedFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		p.breached = breached
+	}
+
+	return p, nil
+}
+
+// Check returns *Error with all failed rules or nil
+func (p *Policy) Check(email string, password string) error {
+	var violations []Violation
+	fail := func(rule string, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Description: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.rules.MinLength {
+		fail(RuleMinLength, "password must be at least %d characters long", p.rules.MinLength)
+	}
+	if p.TooLong(password) {
+		fail(RuleMaxLength, "password must be at most %d characters long", p.rules.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.rules.RequireUpper && !upper {
+		fail(RuleUpper, "password must contain an uppercase letter")
+	}
+	if p.rules.RequireLower && !lower {
+		fail(RuleLower, "password must contain a lowercase letter")
+	}
+	if p.rules.RequireDigit && !digit {
+		fail(RuleDigit, "password must contain a digit")
+	}
+	if p.rules.RequireSymbol && !symbol {
+		fail(RuleSymbol, "password must contain a symbol")
+	}
+
+	if p.rules.RejectEmail {
+		local, _, _ := strings.Cut(email, "@")
+		local = strings.ToLower(local)
+		if utf8.RuneCountInString(local) >= minEmailPartLength && strings.Contains(strings.ToLower(password), local) {
+			fail(RuleContainsEmail, "password must not contain the email")
+		}
+	}
+
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		fail(RuleBreached, "password is too common or has been leaked")
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+// TooLong reports whether the password breaks max_length rule
+// Такой пароль не мог быть установлен, при входе его незачем хэшировать
+func (p *Policy) TooLong(password string) bool {
+	return p.rules.MaxLength > 0 && utf8.RuneCountInString(password) > p.rules.MaxLength
+}
+
+// loadBreached reads passwords list. Пустые строки и строки с # пропускаются, регистр не важен
+func loadBreached(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return breached, nil
+}
@@ -0,0 +1,133 @@
+package passpolicy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// rules returns names of failed rules
+func rules(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+	var policyErr *Error
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+
+	names := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestCheck(t *testing.T) {
+	p, err := New(Rules{
+		MinLength:     8,
+		MaxLength:     16,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		RejectEmail:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"ok", "Tr0ub4dor&3", nil},
+		{"unicode", "Пароль-2024", nil},
+		{"too short", "Aa1!", []string{RuleMinLength}},
+		{"too long", "Aa1!aaaaaaaaaaaaaaaa", []string{RuleMaxLength}},
+		{"no upper", "tr0ub4dor&3", []string{RuleUpper}},
+		{"no lower", "TR0UB4DOR&3", []string{RuleLower}},
+		{"no digit", "Troubador&x", []string{RuleDigit}},
+		{"no symbol", "Tr0ub4dor3x", []string{RuleSymbol}},
+		{"contains email", "xJohn.Doe1!", []string{RuleContainsEmail}},
+		{"all classes", "        ", []string{RuleUpper, RuleLower, RuleDigit}},
+		{"empty", "", []string{RuleMinLength, RuleUpper, RuleLower, RuleDigit, RuleSymbol}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(t, p.Check("john.doe@example.com", tt.password))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortEmailIsIgnored(t *testing.T) {
+	p, err := New(Rules{RejectEmail: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Check("al@example.com", "totally-normal"); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
+
+func TestBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# comment\n\nqwerty123\n  Password1  \n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := New(Rules{MinLength: 8, BreachedFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, password := range []string{"qwerty123", "QWERTY123", "password1"} {
+		if got := rules(t, p.Check("user@example.com", password)); !slices.Equal(got, []string{RuleBreached}) {
+			t.Errorf("Check(%q) = %v, want [%s]", password, got, RuleBreached)
+		}
+	}
+
+	if err := p.Check("user@example.com", "# comment"); err != nil {
+		t.Errorf("Check comment line: %v", err)
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	p, err := New(Rules{MaxLength: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Длина в символах: 4 кириллических символа - 8 байт
+	if p.TooLong("пароль"[:8]) || !p.TooLong("12345") {
+		t.Error("TooLong does not count characters against max_length")
+	}
+
+	unlimited, err := New(Rules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlimited.TooLong(strings.Repeat("a", 10000)) {
+		t.Error("TooLong without max_length = true")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New(Rules{MinLength: 10, MaxLength: 8}); err == nil {
+		t.Error("New with max < min: err = nil")
+	}
+	if _, err := New(Rules{BreachedFile: filepath.Join(t.TempDir(), "missing.txt")}); err == nil {
+		t.Error("New with missing file: err = nil")
+	}
+}
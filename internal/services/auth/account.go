@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"grpc_service/internal/actiontoken"
+	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/passhash"
+	"grpc_service/internal/services/limiter"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// ChangePassword sets a new password after checking the current one
+// С revokeOtherSessions отзываются все токены пользователя, а вызывающему выдаётся новая пара для appID.
+// Без него tokens пустые
+func (a *Auth) ChangePassword(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	oldPassword string,
+	newPassword string,
+	revokeOtherSessions bool,
+	ip string,
+) (tokens models.TokenPair, err error) {
+	const op = "auth.ChangePassword"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.String("ip", ip),
+	)
+
+	user, err := a.checkPassword(ctx, log, userID, oldPassword, ip)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.passwordPolicy.Check(user.Email, newPassword); err != nil {
+		log.Info("password rejected by policy", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Новая пара создаётся до транзакции, сохраняется в ней после отзыва старых
+	var issued issuedTokens
+	if revokeOtherSessions {
+		app, err := a.appProvider.App(ctx, appID)
+		if err != nil {
+			log.Error("failed to get app", slogger.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+		familyID, err := newFamilyID()
+		if err != nil {
+			log.Error("failed to generate token family", slogger.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+		issued, err = a.newTokens(ctx, user, app, familyID)
+		if err != nil {
+			log.Error("failed to generate tokens", slogger.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = a.transactor.WithTx(ctx, func(ctx context.Context) error {
+		if err := a.userSaver.UpdatePassHash(ctx, user.ID, passHash); err != nil {
+			return err
+		}
+		// Ссылки сброса, выданные до смены, больше не нужны
+		if err := a.tokenStorage.DeletePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		if revokeOtherSessions {
+			if err := a.tokenStorage.RevokeUserTokens(ctx, user.ID, 0); err != nil {
+				return err
+			}
+			if err := issued.save(a.tokenStorage)(ctx); err != nil {
+				return err
+			}
+		}
+		return a.audit.SaveAuditEvent(ctx, models.AuditEvent{
+			Type:      models.AuditPasswordChange,
+			UserID:    user.ID,
+			IP:        ip,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		log.Error("failed to change password", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password changed", slog.Bool("revokeOtherSessions", revokeOtherSessions))
+
+	return issued.pair, nil
+}
+
+// ChangeEmail sends the link confirming the new email after checking the password
+// Email меняется только в ConfirmEmailChange. Если новый email занят, с hideExistingUsers ответ тот же, но письма нет.
+// Ссылка привязана к текущему паролю: после сброса или смены пароля она не действует
+func (a *Auth) ChangeEmail(
+	ctx context.Context,
+	userID uint32,
+	newEmail string,
+	password string,
+	ip string,
+) error {
+	const op = "auth.ChangeEmail"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.String("newEmail", newEmail),
+		slog.String("ip", ip),
+	)
+
+	user, err := a.checkPassword(ctx, log, userID, password, ip)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Email == newEmail {
+		return fmt.Errorf("%s: %w", op, ErrEmailUnchanged)
+	}
+
+	_, err = a.userProvider.User(ctx, newEmail)
+	switch {
+	case err == nil:
+		if a.hideExistingUsers {
+			log.Info("email is taken, confirmation is not sent")
+			return nil
+		}
+		log.Info("email is taken")
+		return fmt.Errorf("%s: %w", op, db.ErrUserExists)
+	case !errors.Is(err, db.ErrUserNotFound):
+		log.Error("failed to get user", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := a.actionTokens.Sign(actiontoken.Claims{
+		Purpose:  actiontoken.PurposeChangeEmail,
+		UserID:   user.ID,
+		Email:    newEmail,
+		OldEmail: user.Email,
+		Stamp:    passwordStamp(user.PassHash),
+	}, a.emailChange.TTL)
+	if err != nil {
+		log.Error("failed to sign email change token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	link := a.emailChange.URL + url.QueryEscape(token)
+
+	ctx = context.WithoutCancel(ctx)
+	a.background(log, func() {
+		if err := a.notifier.EmailChange(ctx, newEmail, link); err != nil {
+			log.Error("failed to send email change confirmation", slogger.Err(err))
+		}
+	})
+
+	log.Info("email change confirmation sent")
+
+	return nil
+}
+
+// ConfirmEmailChange sets the email from the token as confirmed email of the user
+// Токен действует, пока email пользователя тот же, что при выдаче, поэтому он одноразовый,
+// и пока не сменился пароль: иначе захваченная сессия пережила бы сброс пароля
+func (a *Auth) ConfirmEmailChange(
+	ctx context.Context,
+	token string,
+	ip string,
+) error {
+	const op = "auth.ConfirmEmailChange"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.String("ip", ip),
+	)
+
+	claims, err := a.actionTokens.Verify(token, actiontoken.PurposeChangeEmail)
+	if err != nil {
+		log.Info("invalid email change token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidEmailChangeToken)
+	}
+
+	log = log.With(
+		slog.Any("userID", claims.UserID),
+	)
+
+	err = a.transactor.WithTx(ctx, func(ctx context.Context) error {
+		user, err := a.userProvider.UserByID(ctx, claims.UserID)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(passwordStamp(user.PassHash)), []byte(claims.Stamp)) != 1 {
+			return errPasswordChanged
+		}
+		if err := a.userSaver.UpdateEmail(ctx, claims.UserID, claims.OldEmail, claims.Email); err != nil {
+			return err
+		}
+		// Ссылка пришла на новый адрес, значит он подтверждён
+		if err := a.userSaver.MarkEmailVerified(ctx, claims.UserID, claims.Email); err != nil {
+			return err
+		}
+		// Ссылки сброса были отправлены на старый адрес
+		if err := a.tokenStorage.DeletePasswordResetTokens(ctx, claims.UserID); err != nil {
+			return err
+		}
+		return a.audit.SaveAuditEvent(ctx, models.AuditEvent{
+			Type:      models.AuditEmailChange,
+			UserID:    claims.UserID,
+			IP:        ip,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrUserNotFound):
+			log.Info("email already changed")
+			return fmt.Errorf("%s: %w", op, ErrInvalidEmailChangeToken)
+		case errors.Is(err, errPasswordChanged):
+			log.Warn("password changed after email change was requested")
+			return fmt.Errorf("%s: %w", op, ErrInvalidEmailChangeToken)
+		case errors.Is(err, db.ErrUserExists):
+			log.Info("email is taken")
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		log.Error("failed to change email", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email changed")
+
+	return nil
+}
+
+// errPasswordChanged - пароль сменили после выдачи ссылки смены email
+var errPasswordChanged = errors.New("password changed")
+
+// passwordStamp returns fingerprint of the password hash for links that must die with the password.
+// Хэш пароля солёный, поэтому по отпечатку в письме ничего не подобрать
+func passwordStamp(passHash []byte) string {
+	sum := sha256.Sum256(passHash)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// checkPassword returns the user if password is correct
+// Попытки ограничиваются так же, как вход: украденный токен не должен помогать подобрать пароль
+func (a *Auth) checkPassword(
+	ctx context.Context,
+	log *slog.Logger,
+	userID uint32,
+	password string,
+	ip string,
+) (models.User, error) {
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		log.Error("failed to get user", slogger.Err(err))
+		return models.User{}, err
+	}
+
+	if err := a.loginLimiter.Allow(ctx, user.Email, ip); err != nil {
+		if errors.Is(err, limiter.ErrLimited) {
+			log.Warn("password check rate limited", slogger.Err(err))
+		} else {
+			log.Error("failed to check login limits", slogger.Err(err))
+		}
+		return models.User{}, err
+	}
+
+	if a.passwordPolicy.TooLong(password) {
+		log.Info("password is too long")
+		a.loginFailed(ctx, log, user.Email, ip)
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	if _, err := a.hasher.Verify(user.PassHash, password); err != nil {
+		if errors.Is(err, passhash.ErrMismatch) {
+			log.Info("invalid credentials", slogger.Err(err))
+			a.loginFailed(ctx, log, user.Email, ip)
+			return models.User{}, ErrInvalidCredentials
+		}
+		log.Error("failed to verify password", slogger.Err(err))
+		return models.User{}, err
+	}
+
+	if err := a.loginLimiter.Success(ctx, user.Email); err != nil {
+		log.Error("failed to reset login attempts", slogger.Err(err))
+	}
+
+	return user, nil
+}
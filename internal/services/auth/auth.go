@@ -4,30 +4,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"grpc_service/internal/actiontoken"
 	"grpc_service/internal/db"
 	"grpc_service/internal/domain/models"
 	"grpc_service/internal/jwt"
+	"grpc_service/internal/passhash"
+	"grpc_service/internal/services/limiter"
 	"grpc_service/internal/slogger"
 	"log/slog"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
 	emptyValue = 0
+	// Пароль для dummyHash, совпадение с ним ни на что не влияет
+	dummyPassword = "dummy password"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrEmailNotVerified    = errors.New("email not verified")
+	// Logout с токеном другого пользователя
+	ErrNotTokenOwner = errors.New("token belongs to another user")
+	// Токен подтверждения истёк, подделан или уже использован
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	ErrInvalidResetToken        = errors.New("invalid password reset token")
+	ErrInvalidEmailChangeToken  = errors.New("invalid email change token")
+	ErrEmailUnchanged           = errors.New("new email is the same as current")
 )
 
 type Auth struct {
-	log          *slog.Logger
-	userSaver    UserSaver
-	userProvider UserProvider
-	appProvider  AppProvider
-	tokenTTL     time.Duration
+	log             *slog.Logger
+	userSaver       UserSaver
+	userProvider    UserProvider
+	appProvider     AppProvider
+	roleSaver       RoleSaver
+	tokenStorage    TokenStorage
+	transactor      Transactor
+	keyProvider     KeyProvider
+	hasher          PasswordHasher
+	passwordPolicy  PasswordPolicy
+	loginLimiter    LoginLimiter
+	resetLimiter    LoginLimiter
+	notifier        Notifier
+	actionTokens    ActionTokens
+	verification    LinkParams
+	passwordReset   LinkParams
+	emailChange     LinkParams
+	audit           AuditLog
+	tokenParams     jwt.Params
+	refreshTokenTTL time.Duration
+	// Register не сообщает, что email уже занят, владельцу приходит уведомление
+	hideExistingUsers bool
+	// Семафор отправок в фоне, см. background
+	pending chan struct{}
+	// Хэш с текущими параметрами: вход с неизвестным email проверяется по нему,
+	// чтобы по времени ответа нельзя было понять, есть ли такой пользователь
+	dummyHash []byte
 }
 
 type UserSaver interface {
@@ -36,87 +72,291 @@ type UserSaver interface {
 		email string,
 		passHash []byte,
 	) (userID uint32, err error)
+	UpdatePassHash(ctx context.Context, userID uint32, passHash []byte) error
+	// ReplacePassHash returns db.ErrUserNotFound, если хэш пользователя уже не oldHash
+	ReplacePassHash(ctx context.Context, userID uint32, oldHash []byte, newHash []byte) error
+	// UpdateEmail returns db.ErrUserExists, если email занят, и db.ErrUserNotFound, если текущий email не oldEmail
+	UpdateEmail(ctx context.Context, userID uint32, oldEmail string, newEmail string) error
+	// MarkEmailVerified returns db.ErrUserNotFound, если email пользователя другой или уже подтверждён
+	MarkEmailVerified(ctx context.Context, userID uint32, email string) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
-	IsAdmin(ctx context.Context, userID uint32) (bool, error)
+	UserByID(ctx context.Context, userID uint32) (models.User, error)
+	UserRoles(ctx context.Context, userID uint32, appID uint32) ([]models.UserRole, error)
+	HasPermission(ctx context.Context, userID uint32, appID uint32, permission string) (bool, error)
+}
+
+type RoleSaver interface {
+	AssignRole(ctx context.Context, userID uint32, appID uint32, role string) error
+	RevokeRole(ctx context.Context, userID uint32, appID uint32, role string) error
 }
 
 type AppProvider interface {
 	App(ctx context.Context, appID uint32) (models.App, error)
 }
 
+type TokenStorage interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RefreshToken(ctx context.Context, tokenHash []byte) (models.RefreshToken, error)
+	UseRefreshToken(ctx context.Context, tokenID int64) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	SaveAccessToken(ctx context.Context, token models.AccessToken) error
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokeUserTokens(ctx context.Context, userID uint32, appID uint32) error
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	SavePasswordResetToken(ctx context.Context, token models.PasswordResetToken) error
+	PasswordResetToken(ctx context.Context, tokenHash []byte) (models.PasswordResetToken, error)
+	// UsePasswordResetToken returns db.ErrTokenUsed, если токен уже использован
+	UsePasswordResetToken(ctx context.Context, tokenHash []byte) error
+	DeletePasswordResetTokens(ctx context.Context, userID uint32) error
+}
+
+// AuditLog records important account changes
+type AuditLog interface {
+	SaveAuditEvent(ctx context.Context, event models.AuditEvent) error
+}
+
+// Transactor runs fn atomically: storage calls made with ctx passed to fn
+// are committed together or not at all. fn may be retried on conflicts
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// PasswordHasher hashes passwords. needsRehash - пароль верный, но хэш устарел
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(hash []byte, password string) (needsRehash bool, err error)
+}
+
+// PasswordPolicy checks new passwords. Ошибка - *passpolicy.Error со списком нарушенных правил
+type PasswordPolicy interface {
+	Check(email string, password string) error
+	// TooLong - пароль длиннее max_length, такой не мог быть установлен
+	TooLong(password string) bool
+}
+
+// LoginLimiter slows down password guessing. Allow возвращает *limiter.Error, если вход пока запрещён
+type LoginLimiter interface {
+	Allow(ctx context.Context, email string, ip string) error
+	Failure(ctx context.Context, email string, ip string) error
+	Success(ctx context.Context, email string) error
+	Unlock(ctx context.Context, email string, ip string) error
+}
+
+// Notifier sends out-of-band notices to the owner of the email
+type Notifier interface {
+	RegistrationAttempt(ctx context.Context, email string) error
+	EmailVerification(ctx context.Context, email string, link string) error
+	PasswordReset(ctx context.Context, email string, link string) error
+	EmailChange(ctx context.Context, newEmail string, link string) error
+}
+
+// ActionTokens signs tokens for links in emails. Verify возвращает actiontoken.ErrInvalid или ErrExpired
+type ActionTokens interface {
+	Sign(claims actiontoken.Claims, ttl time.Duration) (string, error)
+	Verify(token string, purpose string) (actiontoken.Claims, error)
+}
+
+// LinkParams - ссылка в письме: URL + токен, действует TTL
+type LinkParams struct {
+	URL string
+	TTL time.Duration
+}
+
+type KeyProvider interface {
+	SigningKey(ctx context.Context, app models.App) (jwt.Key, error)
+	VerificationKey(ctx context.Context, app models.App, keyID string, alg string) (jwt.Key, error)
+	JWKS(ctx context.Context) ([]models.JWK, error)
+}
+
+// Deps are storages and services Auth works with
+type Deps struct {
+	UserSaver      UserSaver
+	UserProvider   UserProvider
+	AppProvider    AppProvider
+	RoleSaver      RoleSaver
+	TokenStorage   TokenStorage
+	Transactor     Transactor
+	KeyProvider    KeyProvider
+	Hasher         PasswordHasher
+	PasswordPolicy PasswordPolicy
+	LoginLimiter   LoginLimiter
+	Notifier       Notifier
+	ActionTokens   ActionTokens
+	Audit          AuditLog
+	// Лимит запросов сброса пароля по email и ip: каждый запрос считается попыткой
+	ResetLimiter LoginLimiter
+}
+
+// Options are settings of Auth service
+type Options struct {
+	// Ссылки в письмах: подтверждение email, сброс пароля, подтверждение нового email
+	Verification  LinkParams
+	PasswordReset LinkParams
+	EmailChange   LinkParams
+
+	TokenParams     jwt.Params
+	RefreshTokenTTL time.Duration
+	// Register не сообщает, что email уже занят, владельцу приходит уведомление
+	HideExistingUsers bool
+	// Сколько писем одновременно отправляется в фоне, лишние отбрасываются. 0 - defaultMaxPendingNotices
+	MaxPendingNotices int
+}
+
+const defaultMaxPendingNotices = 100
+
 // New returns a new istance of Auth service
-func New(
-	log *slog.Logger,
-	userSaver UserSaver,
-	userProvider UserProvider,
-	appProvider AppProvider,
-	tokenTTL time.Duration,
-) *Auth {
+func New(log *slog.Logger, deps Deps, opts Options) *Auth {
+	dummyHash, err := deps.Hasher.Hash(dummyPassword)
+	if err != nil {
+		log.Error("failed to generate dummy password hash", slogger.Err(err))
+	}
+
+	maxPending := opts.MaxPendingNotices
+	if maxPending <= 0 {
+		maxPending = defaultMaxPendingNotices
+	}
+
 	return &Auth{
-		log:          log,
-		userSaver:    userSaver,
-		userProvider: userProvider,
-		appProvider:  appProvider,
-		tokenTTL:     tokenTTL,
+		log:               log,
+		userSaver:         deps.UserSaver,
+		userProvider:      deps.UserProvider,
+		appProvider:       deps.AppProvider,
+		roleSaver:         deps.RoleSaver,
+		tokenStorage:      deps.TokenStorage,
+		transactor:        deps.Transactor,
+		keyProvider:       deps.KeyProvider,
+		hasher:            deps.Hasher,
+		passwordPolicy:    deps.PasswordPolicy,
+		loginLimiter:      deps.LoginLimiter,
+		resetLimiter:      deps.ResetLimiter,
+		notifier:          deps.Notifier,
+		actionTokens:      deps.ActionTokens,
+		verification:      opts.Verification,
+		passwordReset:     opts.PasswordReset,
+		emailChange:       opts.EmailChange,
+		audit:             deps.Audit,
+		tokenParams:       opts.TokenParams,
+		refreshTokenTTL:   opts.RefreshTokenTTL,
+		hideExistingUsers: opts.HideExistingUsers,
+		pending:           make(chan struct{}, maxPending),
+		dummyHash:         dummyHash,
 	}
 }
 
-// Login checks if User with given credentials exists in the system and returns token
+// logger returns request-scoped logger from ctx (request_id and so on) or the service logger
+func (a *Auth) logger(ctx context.Context) *slog.Logger {
+	return slogger.FromContext(ctx, a.log)
+}
+
+// Login checks if User with given credentials exists in the system and returns tokens
 // If User exist, but password is incorrect, returns error
 // If User doesn`t exist, returns error
+// ip - адрес клиента для ограничения попыток, пустой - не учитывается
 func (a *Auth) Login(
 	ctx context.Context,
 	email string,
 	password string,
 	appID uint32,
-) (token string, err error) {
+	ip string,
+) (tokens models.TokenPair, err error) {
 	const op = "auth.Login"
 
-	log := a.log.With(
+	log := a.logger(ctx).With(
 		slog.String("op", op),
 		slog.String("email", email),
+		slog.String("ip", ip),
 	)
 
 	log.Info("attempting to login user")
 
+	if err := a.loginLimiter.Allow(ctx, email, ip); err != nil {
+		if errors.Is(err, limiter.ErrLimited) {
+			log.Warn("login rate limited", slogger.Err(err))
+		} else {
+			log.Error("failed to check login limits", slogger.Err(err))
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Хэш от длинного пароля стоит дорого, а совпасть он всё равно не может
+	if a.passwordPolicy.TooLong(password) {
+		log.Info("password is too long")
+		a.loginFailed(ctx, log, email, ip)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
 	user, err := a.userProvider.User(ctx, email)
 	if err != nil {
 		if errors.Is(err, db.ErrUserNotFound) {
 			log.Warn("user not found", slogger.Err(err))
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			a.verifyDummy(password)
+			a.loginFailed(ctx, log, email, ip)
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 		log.Error("failed to get user", slogger.Err(err))
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	needsRehash, err := a.hasher.Verify(user.PassHash, password)
+	if err != nil {
+		if errors.Is(err, passhash.ErrMismatch) {
+			log.Info("invalid credentials", slogger.Err(err))
+			a.loginFailed(ctx, log, email, ip)
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		log.Error("failed to verify password", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if needsRehash {
+		a.rehash(ctx, log, user, password)
 	}
 
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		log.Info("invalid credentials", slogger.Err(err))
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	if err := a.loginLimiter.Success(ctx, email); err != nil {
+		log.Error("failed to reset login attempts", slogger.Err(err))
 	}
 
 	// ?-Где хранить приватный ключ приложения
 	// БД
 	app, err := a.appProvider.App(ctx, appID)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op, err)
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Пароль верный, поэтому ответ уже может отличаться от неверных данных
+	if app.RequireVerifiedEmail && !user.EmailVerified {
+		log.Info("email not verified")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
 	}
 
-	token, err = jwt.NewToken(user, app, a.tokenTTL)
+	familyID, err := newFamilyID()
 	if err != nil {
-		log.Error("failed to generate token", slogger.Err(err))
-		return "", fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to generate token family", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	issued, err := a.newTokens(ctx, user, app, familyID)
+	if err != nil {
+		log.Error("failed to generate tokens", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.transactor.WithTx(ctx, issued.save(a.tokenStorage)); err != nil {
+		log.Error("failed to save tokens", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
 	}
+	tokens = issued.pair
 
 	log.Info("user logged in successfully")
 
-	return token, nil
+	return tokens, nil
 }
 
 // RegisterNewUser registers new user in the system and returns userID
 // If User with given email already exists, returns error
+// С hideExistingUsers занятый email не отличить от нового: userID всегда 0, владельцу уходит уведомление
 func (a *Auth) RegisterNewUser(
 	ctx context.Context,
 	email string,
@@ -124,14 +364,19 @@ func (a *Auth) RegisterNewUser(
 ) (userID uint32, err error) {
 	const op = "auth.RegisterNewUser"
 
-	log := a.log.With(
+	log := a.logger(ctx).With(
 		slog.String("op", op),
 		slog.String("email", email),
 	)
 
 	log.Info("registering user")
 
-	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err := a.passwordPolicy.Check(email, password); err != nil {
+		log.Info("password rejected by policy", slogger.Err(err))
+		return emptyValue, fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.hasher.Hash(password)
 	if err != nil {
 		log.Error("failed to generate password hash", slogger.Err(err))
 		return emptyValue, fmt.Errorf("%s: %w", op, err)
@@ -139,35 +384,114 @@ func (a *Auth) RegisterNewUser(
 
 	userID, err = a.userSaver.SaveUser(ctx, email, passHash)
 	if err != nil {
+		if errors.Is(err, db.ErrUserExists) && a.hideExistingUsers {
+			log.Info("user already exists, notifying owner")
+			a.notifyRegistrationAttempt(ctx, log, email)
+			return emptyValue, nil
+		}
 		log.Error("failed to save user", slogger.Err(err))
 		return emptyValue, fmt.Errorf("%s: %w", op, err)
 	}
 
 	log.Info("user registered")
 
+	a.sendVerification(ctx, log, userID, email)
+
+	// Ответ не должен отличаться от ответа для занятого email
+	if a.hideExistingUsers {
+		return emptyValue, nil
+	}
+
 	return userID, nil
 }
 
-// IsAdmin checks if User is admin
-func (a *Auth) IsAdmin(
+// notifyRegistrationAttempt sends notice in background: время отправки не должно быть видно в ответе
+func (a *Auth) notifyRegistrationAttempt(ctx context.Context, log *slog.Logger, email string) {
+	ctx = context.WithoutCancel(ctx)
+	a.background(log, func() {
+		if err := a.notifier.RegistrationAttempt(ctx, email); err != nil {
+			log.Error("failed to send registration notice", slogger.Err(err))
+		}
+	})
+}
+
+// background runs fn in a goroutine, if less than MaxPendingNotices are running
+// Иначе fn отбрасывается, а не ждёт: поток запросов не копит горутины, а время ответа не меняется
+func (a *Auth) background(log *slog.Logger, fn func()) {
+	select {
+	case a.pending <- struct{}{}:
+	default:
+		log.Warn("too many pending notices, notice dropped")
+		return
+	}
+
+	go func() {
+		defer func() { <-a.pending }()
+		fn()
+	}()
+}
+
+// verifyDummy spends the same time as checking password of existing user
+func (a *Auth) verifyDummy(password string) {
+	if a.dummyHash != nil {
+		_, _ = a.hasher.Verify(a.dummyHash, password)
+	}
+}
+
+// loginFailed counts failed attempt. Ошибка хранилища не меняет ответ клиенту
+func (a *Auth) loginFailed(ctx context.Context, log *slog.Logger, email string, ip string) {
+	if err := a.loginLimiter.Failure(ctx, email, ip); err != nil {
+		log.Error("failed to count login failure", slogger.Err(err))
+	}
+}
+
+// UnlockAccount removes login lock of the email and, if given, of the ip
+func (a *Auth) UnlockAccount(
 	ctx context.Context,
-	userID uint32,
-) (isAdmin bool, err error) {
-	const op = "auth.IsAdmin"
+	email string,
+	ip string,
+) error {
+	const op = "auth.UnlockAccount"
 
-	log := a.log.With(
+	log := a.logger(ctx).With(
 		slog.String("op", op),
-		slog.Any("userID", userID),
+		slog.String("email", email),
+		slog.String("ip", ip),
 	)
 
-	log.Info("checking if user is admin")
+	if err := a.loginLimiter.Unlock(ctx, email, ip); err != nil {
+		log.Error("failed to unlock account", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("account unlocked")
 
-	isAdmin, err = a.userProvider.IsAdmin(ctx, userID)
+	return nil
+}
+
+// rehash upgrades outdated password hash. Ошибка не мешает входу: попробуем при следующем
+// Хэш заменяется, только если он всё ещё тот, что проверен: иначе вход со старым паролем,
+// совпавший со сбросом или сменой пароля, вернул бы старый пароль
+func (a *Auth) rehash(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	password string,
+) {
+	passHash, err := a.hasher.Hash(password)
 	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		log.Error("failed to rehash password", slogger.Err(err))
+		return
 	}
 
-	log.Info("checked if user is admin", slog.Bool("IsAdmin", isAdmin))
+	if err := a.userSaver.ReplacePassHash(ctx, user.ID, user.PassHash, passHash); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Info("password changed concurrently, rehash skipped")
+			return
+		}
+		log.Error("failed to save rehashed password", slogger.Err(err))
+		return
+	}
 
-	return isAdmin, nil
+	log.Info("password hash upgraded")
 }
@@ -0,0 +1,719 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/actiontoken"
+	"grpc_service/internal/db"
+	"grpc_service/internal/db/memory"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/passhash"
+	"grpc_service/internal/passpolicy"
+	"grpc_service/internal/services/keys"
+	"grpc_service/internal/services/limiter"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	// Столько замеров на каждый путь, сравниваются медианы
+	timingSamples = 40
+	// Допустимое отличие медиан
+	timingTolerance = 0.3
+
+	testVerificationURL = "https://example.com/verify?token="
+	testResetURL        = "https://example.com/reset?token="
+	testEmailChangeURL  = "https://example.com/email?token="
+)
+
+// noticeRecorder remembers emails the notices were sent to
+type noticeRecorder struct {
+	sent chan string
+	// Ссылки подтверждения email
+	links chan string
+	// Ссылки сброса пароля
+	resets chan string
+	// Ссылки подтверждения нового email
+	emailChanges chan string
+}
+
+func (n *noticeRecorder) RegistrationAttempt(_ context.Context, email string) error {
+	n.sent <- email
+	return nil
+}
+
+func (n *noticeRecorder) EmailVerification(_ context.Context, _ string, link string) error {
+	n.links <- link
+	return nil
+}
+
+func (n *noticeRecorder) PasswordReset(_ context.Context, _ string, link string) error {
+	n.resets <- link
+	return nil
+}
+
+func (n *noticeRecorder) EmailChange(_ context.Context, _ string, link string) error {
+	n.emailChanges <- link
+	return nil
+}
+
+func newTestAuth(t *testing.T, hideExistingUsers bool) (*Auth, *memory.DB, *noticeRecorder) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := memory.New()
+
+	// Хэш должен занимать заметно больше времени, чем остальная работа
+	hasher, err := passhash.New(passhash.Params{
+		Algorithm:     passhash.AlgArgon2id,
+		Argon2Memory:  4 * 1024,
+		Argon2Time:    2,
+		Argon2Threads: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := passpolicy.New(passpolicy.Rules{MinLength: 8, MaxLength: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loginLimiter := limiter.New(log, limiter.NewMemoryStorage(), limiter.Config{Enabled: false})
+	notices := &noticeRecorder{
+		sent:   make(chan string, 2*timingSamples),
+		links:  make(chan string, 2*timingSamples),
+		resets: make(chan string, 2*timingSamples),
+
+		emailChanges: make(chan string, 2*timingSamples),
+	}
+	actionTokens, err := actiontoken.New([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyManager, err := keys.New(log, storage, 30*24*time.Hour, time.Hour, time.Minute, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := New(log, Deps{
+		UserSaver:      storage,
+		UserProvider:   storage,
+		AppProvider:    storage,
+		RoleSaver:      storage,
+		TokenStorage:   storage,
+		Transactor:     storage,
+		KeyProvider:    keyManager,
+		Hasher:         hasher,
+		PasswordPolicy: policy,
+		LoginLimiter:   loginLimiter,
+		Notifier:       notices,
+		ActionTokens:   actionTokens,
+		Audit:          storage,
+		ResetLimiter:   limiter.New(log, limiter.NewMemoryStorage(), limiter.Config{Enabled: false}),
+	}, Options{
+		Verification:      LinkParams{URL: testVerificationURL, TTL: time.Hour},
+		PasswordReset:     LinkParams{URL: testResetURL, TTL: time.Hour},
+		EmailChange:       LinkParams{URL: testEmailChangeURL, TTL: time.Hour},
+		TokenParams:       jwt.Params{Issuer: "test", TTL: time.Hour},
+		RefreshTokenTTL:   time.Hour,
+		HideExistingUsers: hideExistingUsers,
+	})
+	return auth, storage, notices
+}
+
+// median returns median duration of fn
+func median(samples []time.Duration) time.Duration {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// compareTimings runs both functions in turns and checks that their medians are close
+func compareTimings(t *testing.T, nameA string, a func(i int), nameB string, b func(i int)) {
+	t.Helper()
+
+	timesA := make([]time.Duration, 0, timingSamples)
+	timesB := make([]time.Duration, 0, timingSamples)
+	for i := 0; i < timingSamples; i++ {
+		start := time.Now()
+		a(i)
+		timesA = append(timesA, time.Since(start))
+
+		start = time.Now()
+		b(i)
+		timesB = append(timesB, time.Since(start))
+	}
+
+	medianA, medianB := median(timesA), median(timesB)
+	slower, faster := max(medianA, medianB), min(medianA, medianB)
+	if float64(slower-faster) > timingTolerance*float64(slower) {
+		t.Errorf("median %s = %s, median %s = %s, differ by more than %.0f%%",
+			nameA, medianA, nameB, medianB, timingTolerance*100)
+	}
+}
+
+func TestLoginTimingUnknownEmail(t *testing.T) {
+	auth, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "correct password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	login := func(email string) func(int) {
+		return func(int) {
+			_, err := auth.Login(ctx, email, "wrong password", 1, "")
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("Login(%s): err = %v, want %v", email, err, ErrInvalidCredentials)
+			}
+		}
+	}
+
+	compareTimings(t,
+		"wrong password", login("user@example.com"),
+		"unknown email", login("unknown@example.com"),
+	)
+}
+
+// Пароль длиннее max_length отклоняется как неверный, не доходя до хэширования
+func TestLoginTooLongPassword(t *testing.T) {
+	auth, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "correct password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	for _, email := range []string{"user@example.com", "unknown@example.com"} {
+		if _, err := auth.Login(ctx, email, strings.Repeat("a", 1<<20), 1, ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%s) with too long password: err = %v, want %v", email, err, ErrInvalidCredentials)
+		}
+	}
+}
+
+func TestRegisterHideExisting(t *testing.T) {
+	auth, _, notices := newTestAuth(t, true)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "other password")
+	if err != nil || userID != emptyValue {
+		t.Fatalf("RegisterNewUser of existing email = %d, %v, want %d, nil", userID, err, emptyValue)
+	}
+
+	select {
+	case email := <-notices.sent:
+		if email != "user@example.com" {
+			t.Errorf("notice sent to %s, want user@example.com", email)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notice is not sent")
+	}
+
+	// Первая регистрация тоже не сообщает id
+	userID, err = auth.RegisterNewUser(ctx, "new@example.com", "password")
+	if err != nil || userID != emptyValue {
+		t.Errorf("RegisterNewUser of new email = %d, %v, want %d, nil", userID, err, emptyValue)
+	}
+}
+
+func TestRegisterTimingHideExisting(t *testing.T) {
+	auth, _, _ := newTestAuth(t, true)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	register := func(email func(i int) string) func(int) {
+		return func(i int) {
+			if _, err := auth.RegisterNewUser(ctx, email(i), "password"); err != nil {
+				t.Fatalf("RegisterNewUser: %v", err)
+			}
+		}
+	}
+
+	compareTimings(t,
+		"existing email", register(func(int) string { return "user@example.com" }),
+		"new email", register(func(i int) string { return fmt.Sprintf("new-%d@example.com", i) }),
+	)
+}
+
+// linkToken waits for the link and returns its token
+func linkToken(t *testing.T, links chan string, prefix string) string {
+	t.Helper()
+
+	select {
+	case link := <-links:
+		token, ok := strings.CutPrefix(link, prefix)
+		if !ok {
+			t.Fatalf("link %s, want prefix %s", link, prefix)
+		}
+		return token
+	case <-time.After(time.Second):
+		t.Fatal("link is not sent")
+	}
+	return ""
+}
+
+// noLink checks that nothing is sent
+func noLink(t *testing.T, links chan string) {
+	t.Helper()
+
+	select {
+	case link := <-links:
+		t.Errorf("unexpected link %s", link)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func verificationToken(t *testing.T, notices *noticeRecorder) string {
+	t.Helper()
+	return linkToken(t, notices.links, testVerificationURL)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	auth, storage, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	err := storage.SaveApp(ctx, models.App{ID: 1, Name: "strict", Secret: "secret", RequireVerifiedEmail: true})
+	if err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	token := verificationToken(t, notices)
+
+	if _, err := auth.Login(ctx, "user@example.com", "password", 1, ""); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("Login before verification: err = %v, want %v", err, ErrEmailNotVerified)
+	}
+	// Неверный пароль не должен выдавать, что email не подтверждён
+	if _, err := auth.Login(ctx, "user@example.com", "wrong", 1, ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login with wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	if err := auth.VerifyEmail(ctx, token+"x"); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail with bad token: err = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+	if err := auth.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if err := auth.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("second VerifyEmail: err = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+
+	if _, err := auth.Login(ctx, "user@example.com", "password", 1, ""); err != nil {
+		t.Errorf("Login after verification: %v", err)
+	}
+
+	// Подтверждённому email и неизвестному email ничего не отправляется
+	for _, email := range []string{"user@example.com", "unknown@example.com"} {
+		if err := auth.SendVerification(ctx, email); err != nil {
+			t.Errorf("SendVerification(%s): %v", email, err)
+		}
+	}
+	noLink(t, notices.links)
+}
+
+func TestSendVerification(t *testing.T) {
+	auth, _, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	first := verificationToken(t, notices)
+
+	if err := auth.SendVerification(ctx, "user@example.com"); err != nil {
+		t.Fatalf("SendVerification: %v", err)
+	}
+	second := verificationToken(t, notices)
+
+	// Действует любая из выданных ссылок, но только одна
+	if err := auth.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+	if err := auth.VerifyEmail(ctx, first); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail with first token: err = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	auth, storage, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if err := storage.SaveApp(ctx, models.App{ID: 1, Name: "test", Secret: "secret"}); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "old password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	session, err := auth.Login(ctx, "user@example.com", "old password", 1, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// Неизвестный email - тот же ответ, но письма нет
+	if err := auth.RequestPasswordReset(ctx, "unknown@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset of unknown email: %v", err)
+	}
+	noLink(t, notices.resets)
+
+	if err := auth.RequestPasswordReset(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := linkToken(t, notices.resets, testResetURL)
+
+	// Пароль не по политике не тратит токен
+	var policyErr *passpolicy.Error
+	if err := auth.ResetPassword(ctx, token, "short", ""); !errors.As(err, &policyErr) {
+		t.Fatalf("ResetPassword with short password: err = %v, want *passpolicy.Error", err)
+	}
+
+	if err := auth.ResetPassword(ctx, token, "new password", "192.0.2.1"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if err := auth.ResetPassword(ctx, token, "other password", ""); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("second ResetPassword: err = %v, want %v", err, ErrInvalidResetToken)
+	}
+
+	if _, err := auth.Refresh(ctx, session.RefreshToken); err == nil {
+		t.Error("Refresh with session from before the reset: err = nil")
+	}
+	if info, err := auth.Introspect(ctx, session.AccessToken); err != nil || info.Active {
+		t.Errorf("Introspect of access token from before the reset = %+v, %v, want inactive", info, err)
+	}
+	if _, err := auth.Login(ctx, "user@example.com", "old password", 1, ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login with old password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, err := auth.Login(ctx, "user@example.com", "new password", 1, ""); err != nil {
+		t.Errorf("Login with new password: %v", err)
+	}
+
+	events, err := storage.AuditEvents(ctx, userID)
+	if err != nil {
+		t.Fatalf("AuditEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != models.AuditPasswordReset || events[0].IP != "192.0.2.1" {
+		t.Errorf("AuditEvents = %+v, want password_reset from 192.0.2.1", events)
+	}
+}
+
+// Новый запрос сброса заменяет прежнюю ссылку
+func TestRequestPasswordResetReplacesToken(t *testing.T) {
+	auth, _, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "old password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	if err := auth.RequestPasswordReset(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	first := linkToken(t, notices.resets, testResetURL)
+	if err := auth.RequestPasswordReset(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("second RequestPasswordReset: %v", err)
+	}
+	second := linkToken(t, notices.resets, testResetURL)
+
+	if err := auth.ResetPassword(ctx, first, "new password", ""); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("ResetPassword with replaced token: err = %v, want %v", err, ErrInvalidResetToken)
+	}
+	if err := auth.ResetPassword(ctx, second, "new password", ""); err != nil {
+		t.Errorf("ResetPassword with last token: %v", err)
+	}
+}
+
+func TestRequestPasswordResetLimit(t *testing.T) {
+	auth, _, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	auth.resetLimiter = limiter.New(slog.New(slog.NewTextHandler(io.Discard, nil)), limiter.NewMemoryStorage(), limiter.Config{
+		Enabled:   true,
+		Email:     limiter.Rules{BackoffAfter: 1},
+		IP:        limiter.Rules{BackoffAfter: 2},
+		BaseDelay: time.Hour,
+		MaxDelay:  time.Hour,
+		Window:    time.Hour,
+	})
+
+	tests := []struct {
+		email, ip string
+		limited   bool
+	}{
+		{"user@example.com", "192.0.2.1", false},
+		// Тот же email с другого адреса
+		{"user@example.com", "192.0.2.2", true},
+		{"other@example.com", "192.0.2.1", false},
+		// Новый email с адреса, исчерпавшего лимит
+		{"third@example.com", "192.0.2.1", true},
+	}
+
+	for _, tt := range tests {
+		err := auth.RequestPasswordReset(ctx, tt.email, tt.ip)
+		if limited := errors.Is(err, limiter.ErrLimited); limited != tt.limited || (err != nil && !limited) {
+			t.Errorf("RequestPasswordReset(%s, %s): err = %v, want limited %v", tt.email, tt.ip, err, tt.limited)
+		}
+	}
+}
+
+// Сверх MaxPendingNotices письма отбрасываются, а не копятся в горутинах
+func TestRequestPasswordResetPendingLimit(t *testing.T) {
+	auth, _, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	verificationToken(t, notices)
+
+	for range cap(auth.pending) {
+		auth.pending <- struct{}{}
+	}
+	if err := auth.RequestPasswordReset(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	noLink(t, notices.resets)
+
+	for range cap(auth.pending) {
+		<-auth.pending
+	}
+	if err := auth.RequestPasswordReset(ctx, "user@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	linkToken(t, notices.resets, testResetURL)
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "old password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	expired := models.PasswordResetToken{Hash: hashToken("expired"), UserID: userID, ExpiresAt: time.Now().Add(-time.Second)}
+	if err := storage.SavePasswordResetToken(ctx, expired); err != nil {
+		t.Fatalf("SavePasswordResetToken: %v", err)
+	}
+
+	for _, token := range []string{"expired", "unknown"} {
+		if err := auth.ResetPassword(ctx, token, "new password", ""); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("ResetPassword(%s): err = %v, want %v", token, err, ErrInvalidResetToken)
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if err := storage.SaveApp(ctx, models.App{ID: 1, Name: "test", Secret: "secret"}); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "old password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	other, err := auth.Login(ctx, "user@example.com", "old password", 1, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, err = auth.ChangePassword(ctx, userID, 1, "wrong password", "new password", false, "")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ChangePassword with wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	var policyErr *passpolicy.Error
+	if _, err := auth.ChangePassword(ctx, userID, 1, "old password", "short", false, ""); !errors.As(err, &policyErr) {
+		t.Fatalf("ChangePassword with short password: err = %v, want *passpolicy.Error", err)
+	}
+
+	// Без отзыва сессии остаются, новых токенов нет
+	tokens, err := auth.ChangePassword(ctx, userID, 1, "old password", "new password", false, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+	if tokens != (models.TokenPair{}) {
+		t.Errorf("ChangePassword without revoke returned tokens %+v", tokens)
+	}
+	if info, err := auth.Introspect(ctx, other.AccessToken); err != nil || !info.Active {
+		t.Errorf("Introspect of other session = %+v, %v, want active", info, err)
+	}
+
+	tokens, err = auth.ChangePassword(ctx, userID, 1, "new password", "newest password", true, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("ChangePassword with revoke: %v", err)
+	}
+	if _, err := auth.Refresh(ctx, other.RefreshToken); err == nil {
+		t.Error("Refresh of other session after revoke: err = nil")
+	}
+	if info, err := auth.Introspect(ctx, other.AccessToken); err != nil || info.Active {
+		t.Errorf("Introspect of other session = %+v, %v, want inactive", info, err)
+	}
+	if info, err := auth.Introspect(ctx, tokens.AccessToken); err != nil || !info.Active {
+		t.Errorf("Introspect of new token = %+v, %v, want active", info, err)
+	}
+	if _, err := auth.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("Refresh of new token: %v", err)
+	}
+	if _, err := auth.Login(ctx, "user@example.com", "newest password", 1, ""); err != nil {
+		t.Errorf("Login with new password: %v", err)
+	}
+
+	events, err := storage.AuditEvents(ctx, userID)
+	if err != nil {
+		t.Fatalf("AuditEvents: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != models.AuditPasswordChange || events[0].IP != "192.0.2.1" {
+		t.Errorf("AuditEvents = %+v, want two password_change from 192.0.2.1", events)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	auth, storage, notices := newTestAuth(t, false)
+	ctx := context.Background()
+
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	if _, err := auth.RegisterNewUser(ctx, "taken@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	if err := auth.ChangeEmail(ctx, userID, "new@example.com", "wrong password", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ChangeEmail with wrong password: err = %v, want %v", err, ErrInvalidCredentials)
+	}
+	if err := auth.ChangeEmail(ctx, userID, "user@example.com", "password", ""); !errors.Is(err, ErrEmailUnchanged) {
+		t.Errorf("ChangeEmail to the same email: err = %v, want %v", err, ErrEmailUnchanged)
+	}
+	if err := auth.ChangeEmail(ctx, userID, "taken@example.com", "password", ""); !errors.Is(err, db.ErrUserExists) {
+		t.Errorf("ChangeEmail to taken email: err = %v, want %v", err, db.ErrUserExists)
+	}
+	noLink(t, notices.emailChanges)
+
+	if err := auth.ChangeEmail(ctx, userID, "new@example.com", "password", ""); err != nil {
+		t.Fatalf("ChangeEmail: %v", err)
+	}
+	token := linkToken(t, notices.emailChanges, testEmailChangeURL)
+
+	// Токен смены email не подходит для подтверждения
+	if err := auth.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("VerifyEmail with email change token: err = %v, want %v", err, ErrInvalidVerificationToken)
+	}
+
+	if err := auth.ConfirmEmailChange(ctx, token, "192.0.2.1"); err != nil {
+		t.Fatalf("ConfirmEmailChange: %v", err)
+	}
+	if err := auth.ConfirmEmailChange(ctx, token, ""); !errors.Is(err, ErrInvalidEmailChangeToken) {
+		t.Errorf("second ConfirmEmailChange: err = %v, want %v", err, ErrInvalidEmailChangeToken)
+	}
+
+	user, err := storage.UserByID(ctx, userID)
+	if err != nil {
+		t.Fatalf("UserByID: %v", err)
+	}
+	if user.Email != "new@example.com" || !user.EmailVerified {
+		t.Errorf("user = %s, verified %v, want new@example.com, verified", user.Email, user.EmailVerified)
+	}
+	// Старый адрес освободился
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Errorf("RegisterNewUser with old email: %v", err)
+	}
+
+	events, err := storage.AuditEvents(ctx, userID)
+	if err != nil {
+		t.Fatalf("AuditEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].Type != models.AuditEmailChange || events[0].IP != "192.0.2.1" {
+		t.Errorf("AuditEvents = %+v, want email_change from 192.0.2.1", events)
+	}
+}
+
+func TestChangeEmailHideExisting(t *testing.T) {
+	auth, storage, notices := newTestAuth(t, true)
+	ctx := context.Background()
+
+	for _, email := range []string{"user@example.com", "taken@example.com"} {
+		if _, err := auth.RegisterNewUser(ctx, email, "password"); err != nil {
+			t.Fatalf("RegisterNewUser(%s): %v", email, err)
+		}
+	}
+	// В этом режиме RegisterNewUser не возвращает id
+	user, err := storage.User(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("User: %v", err)
+	}
+
+	if err := auth.ChangeEmail(ctx, user.ID, "taken@example.com", "password", ""); err != nil {
+		t.Errorf("ChangeEmail to taken email: %v", err)
+	}
+	noLink(t, notices.emailChanges)
+}
+
+// Ссылка смены email, выданная до сброса или смены пароля, не должна сохранять захват аккаунта
+func TestConfirmEmailChangeAfterPasswordChange(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, auth *Auth, notices *noticeRecorder, userID uint32)
+	}{
+		{"reset", func(t *testing.T, auth *Auth, notices *noticeRecorder, _ uint32) {
+			if err := auth.RequestPasswordReset(context.Background(), "user@example.com", ""); err != nil {
+				t.Fatalf("RequestPasswordReset: %v", err)
+			}
+			token := linkToken(t, notices.resets, testResetURL)
+			if err := auth.ResetPassword(context.Background(), token, "new password", ""); err != nil {
+				t.Fatalf("ResetPassword: %v", err)
+			}
+		}},
+		{"change", func(t *testing.T, auth *Auth, _ *noticeRecorder, userID uint32) {
+			_, err := auth.ChangePassword(context.Background(), userID, 1, "password", "new password", false, "")
+			if err != nil {
+				t.Fatalf("ChangePassword: %v", err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, storage, notices := newTestAuth(t, false)
+			ctx := context.Background()
+
+			userID, err := auth.RegisterNewUser(ctx, "user@example.com", "password")
+			if err != nil {
+				t.Fatalf("RegisterNewUser: %v", err)
+			}
+			if err := auth.ChangeEmail(ctx, userID, "attacker@example.com", "password", ""); err != nil {
+				t.Fatalf("ChangeEmail: %v", err)
+			}
+			token := linkToken(t, notices.emailChanges, testEmailChangeURL)
+
+			tt.change(t, auth, notices, userID)
+
+			if err := auth.ConfirmEmailChange(ctx, token, ""); !errors.Is(err, ErrInvalidEmailChangeToken) {
+				t.Errorf("ConfirmEmailChange: err = %v, want %v", err, ErrInvalidEmailChangeToken)
+			}
+			user, err := storage.UserByID(ctx, userID)
+			if err != nil {
+				t.Fatalf("UserByID: %v", err)
+			}
+			if user.Email != "user@example.com" {
+				t.Errorf("email = %s, want user@example.com", user.Email)
+			}
+		})
+	}
+}
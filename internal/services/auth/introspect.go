@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/services/keys"
+	"grpc_service/internal/slogger"
+	"log/slog"
+)
+
+// Introspect checks access token and returns its claims (RFC 7662)
+// Invalid token is not an error: TokenInfo.Active is false and Reason is set
+// Error is returned only if token can`t be checked, e.g. storage is unavailable
+func (a *Auth) Introspect(
+	ctx context.Context,
+	token string,
+) (info models.TokenInfo, err error) {
+	const op = "auth.Introspect"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	claims, reason, err := a.verifyToken(ctx, token)
+	if err != nil {
+		log.Error("failed to verify token", slogger.Err(err))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if reason != models.ReasonNone {
+		// Данные из непроверенного токена наружу не отдаём
+		log.Info("token is not active", slog.Int("reason", int(reason)))
+		return models.TokenInfo{Reason: reason}, nil
+	}
+
+	return models.TokenInfo{
+		Active:    true,
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		AppID:     claims.AppID,
+		ExpiresAt: claims.ExpiresAt,
+		Roles:     claims.Access.Roles,
+		Scope:     claims.Access.Scope,
+	}, nil
+}
+
+// Authenticate returns the caller of the access token
+// If token is not active, returns ErrInvalidToken
+func (a *Auth) Authenticate(
+	ctx context.Context,
+	token string,
+) (models.Principal, error) {
+	const op = "auth.Authenticate"
+
+	claims, reason, err := a.verifyToken(ctx, token)
+	if err != nil {
+		a.logger(ctx).Error("failed to verify token", slog.String("op", op), slogger.Err(err))
+		return models.Principal{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if reason != models.ReasonNone {
+		return models.Principal{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	return models.Principal{
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		AppID:     claims.AppID,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt,
+		Roles:     claims.Access.Roles,
+		Scope:     claims.Access.Scope,
+		Token:     token,
+	}, nil
+}
+
+// verifyToken checks signature, claims and the denylist
+// If token is not active, returns the reason. Error means that token can`t be checked
+func (a *Auth) verifyToken(
+	ctx context.Context,
+	token string,
+) (jwt.Claims, models.InactiveReason, error) {
+	claims, err := jwt.ParseToken(token, a.tokenParams.Issuer, func(appID uint32, keyID string, alg string) (jwt.Key, error) {
+		app, err := a.appProvider.App(ctx, appID)
+		if err != nil {
+			return jwt.Key{}, err
+		}
+		return a.keyProvider.VerificationKey(ctx, app, keyID, alg)
+	})
+
+	switch {
+	case err == nil:
+	case errors.Is(err, jwt.ErrExpired):
+		return claims, models.ReasonExpired, nil
+	case errors.Is(err, jwt.ErrBadSignature), errors.Is(err, keys.ErrKeyNotFound):
+		return claims, models.ReasonBadSignature, nil
+	case errors.Is(err, db.ErrAppNotFound):
+		return claims, models.ReasonUnknownApp, nil
+	case errors.Is(err, jwt.ErrNotValidYet):
+		return claims, models.ReasonNotValidYet, nil
+	case errors.Is(err, jwt.ErrMalformed), errors.Is(err, jwt.ErrInvalidClaims):
+		return claims, models.ReasonMalformed, nil
+	default:
+		return claims, models.ReasonNone, err
+	}
+
+	revoked, err := a.tokenStorage.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return claims, models.ReasonNone, err
+	}
+	if revoked {
+		return claims, models.ReasonRevoked, nil
+	}
+
+	return claims, models.ReasonNone, nil
+}
+
+// JWKS returns public keys to verify tokens offline
+func (a *Auth) JWKS(ctx context.Context) ([]models.JWK, error) {
+	const op = "auth.JWKS"
+
+	jwks, err := a.keyProvider.JWKS(ctx)
+	if err != nil {
+		a.logger(ctx).Error("failed to get jwks", slog.String("op", op), slogger.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jwks, nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"testing"
+	"time"
+)
+
+// loginToken registers the user (once) and returns access token for the app
+func loginToken(t *testing.T, auth *Auth, appID uint32) string {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := auth.userProvider.User(ctx, "user@example.com"); err != nil {
+		if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+			t.Fatalf("RegisterNewUser: %v", err)
+		}
+	}
+	tokens, err := auth.Login(ctx, "user@example.com", "password", appID, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return tokens.AccessToken
+}
+
+func TestIntrospect(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	apps := []models.App{
+		{ID: 1, Name: "hs", Secret: "secret"},
+		{ID: 2, Name: "rs", Secret: "secret", SigningAlg: jwt.AlgRS256},
+	}
+	for _, app := range apps {
+		if err := storage.SaveApp(ctx, app); err != nil {
+			t.Fatalf("SaveApp: %v", err)
+		}
+	}
+
+	// Второй сервер со своим хранилищем: свои ключи и свой секрет приложения 1
+	other, otherStorage, _ := newTestAuth(t, false)
+	otherApps := []models.App{
+		{ID: 1, Name: "hs", Secret: "other secret"},
+		{ID: 2, Name: "rs", Secret: "secret", SigningAlg: jwt.AlgRS256},
+		{ID: 3, Name: "unknown here", Secret: "secret"},
+	}
+	for _, app := range otherApps {
+		if err := otherStorage.SaveApp(ctx, app); err != nil {
+			t.Fatalf("SaveApp: %v", err)
+		}
+	}
+
+	active := loginToken(t, auth, 1)
+	revoked := loginToken(t, auth, 1)
+	principal, err := auth.Authenticate(ctx, revoked)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if err := auth.Logout(ctx, principal.UserID, revoked, ""); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	auth.tokenParams.TTL = -time.Minute
+	expired := loginToken(t, auth, 1)
+	auth.tokenParams.TTL = time.Hour
+
+	auth.tokenParams.Issuer = "other issuer"
+	wrongIssuer := loginToken(t, auth, 1)
+	auth.tokenParams.Issuer = "test"
+
+	tests := []struct {
+		name   string
+		token  string
+		reason models.InactiveReason
+	}{
+		{"active", active, models.ReasonNone},
+		{"expired", expired, models.ReasonExpired},
+		{"revoked", revoked, models.ReasonRevoked},
+		{"wrong issuer", wrongIssuer, models.ReasonMalformed},
+		{"other secret", loginToken(t, other, 1), models.ReasonBadSignature},
+		{"unknown key", loginToken(t, other, 2), models.ReasonBadSignature},
+		{"unknown app", loginToken(t, other, 3), models.ReasonUnknownApp},
+		{"garbage", "not a token", models.ReasonMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := auth.Introspect(ctx, tt.token)
+			if err != nil {
+				t.Fatalf("Introspect: %v", err)
+			}
+			if info.Active != (tt.reason == models.ReasonNone) || info.Reason != tt.reason {
+				t.Errorf("Introspect = active %v, reason %d, want reason %d", info.Active, info.Reason, tt.reason)
+			}
+			// Данные неактивного токена не отдаются
+			if !info.Active && info.UserID != 0 {
+				t.Errorf("inactive token info has user %d", info.UserID)
+			}
+		})
+	}
+}
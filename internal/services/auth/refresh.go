@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"time"
+)
+
+const refreshTokenSize = 32
+
+// Refresh exchanges refresh token for a new token pair
+// Every refresh token can be used only once. If already used token comes again,
+// the whole family of tokens is revoked and the user has to login again
+func (a *Auth) Refresh(
+	ctx context.Context,
+	refreshToken string,
+) (tokens models.TokenPair, err error) {
+	const op = "auth.Refresh"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	log.Info("attempting to refresh tokens")
+
+	stored, err := a.tokenStorage.RefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, db.ErrTokenNotFound) {
+			log.Warn("refresh token not found", slogger.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+		log.Error("failed to get refresh token", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(
+		slog.Any("userID", stored.UserID),
+		slog.String("familyID", stored.FamilyID),
+	)
+
+	if stored.Used || stored.Revoked {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, a.revokeReusedFamily(ctx, log, stored.FamilyID))
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		log.Info("refresh token expired")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Warn("user not found", slogger.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+		log.Error("failed to get user", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	app, err := a.appProvider.App(ctx, stored.AppID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Ключ подписи может создаваться при первом обращении, поэтому токены готовятся до транзакции
+	issued, err := a.newTokens(ctx, user, app, stored.FamilyID)
+	if err != nil {
+		log.Error("failed to generate tokens", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Старый токен помечается использованным вместе с сохранением нового:
+	// при ошибке пользователь может повторить Refresh тем же токеном
+	err = a.transactor.WithTx(ctx, func(ctx context.Context) error {
+		if err := a.tokenStorage.UseRefreshToken(ctx, stored.ID); err != nil {
+			return err
+		}
+		return issued.save(a.tokenStorage)(ctx)
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrTokenUsed) {
+			// Токен успели использовать между чтением и обновлением
+			// Отзыв семьи вне транзакции, иначе он откатится вместе с ней
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, a.revokeReusedFamily(ctx, log, stored.FamilyID))
+		}
+		log.Error("failed to rotate refresh token", slogger.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	tokens = issued.pair
+
+	log.Info("tokens refreshed")
+
+	return tokens, nil
+}
+
+// revokeReusedFamily revokes family of the token that was presented twice
+// Returns ErrRefreshTokenReused or storage error
+func (a *Auth) revokeReusedFamily(
+	ctx context.Context,
+	log *slog.Logger,
+	familyID string,
+) error {
+	log.Warn("refresh token reuse detected, revoking token family")
+
+	if err := a.tokenStorage.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		log.Error("failed to revoke token family", slogger.Err(err))
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// issuedTokens - новая пара токенов и то, что о ней нужно сохранить
+type issuedTokens struct {
+	pair    models.TokenPair
+	access  models.AccessToken
+	refresh models.RefreshToken
+}
+
+// newTokens creates access token and a new refresh token of the given family
+// Nothing is saved yet, see issuedTokens.save
+func (a *Auth) newTokens(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+	familyID string,
+) (issuedTokens, error) {
+	key, err := a.keyProvider.SigningKey(ctx, app)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+
+	access, err := a.tokenAccess(ctx, user, app)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+
+	accessToken, claims, err := jwt.NewToken(user, app, key, a.tokenParams, access)
+	if err != nil {
+		return issuedTokens{}, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return issuedTokens{}, err
+	}
+
+	return issuedTokens{
+		pair: models.TokenPair{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+		},
+		// Запоминаем jti, чтобы можно было отозвать все токены пользователя
+		access: models.AccessToken{
+			ID:        claims.ID,
+			UserID:    user.ID,
+			AppID:     app.ID,
+			ExpiresAt: claims.ExpiresAt,
+		},
+		refresh: models.RefreshToken{
+			Hash:      hashToken(refreshToken),
+			FamilyID:  familyID,
+			UserID:    user.ID,
+			AppID:     app.ID,
+			ExpiresAt: time.Now().Add(a.refreshTokenTTL),
+		},
+	}, nil
+}
+
+// save returns function that saves jti and refresh token, to be run in a transaction
+func (t issuedTokens) save(storage TokenStorage) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := storage.SaveAccessToken(ctx, t.access); err != nil {
+			return err
+		}
+		return storage.SaveRefreshToken(ctx, t.refresh)
+	}
+}
+
+// newRefreshToken generates opaque random token
+func newRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newFamilyID generates id for a new chain of refresh tokens
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns hash under which the token is stored
+func hashToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"testing"
+	"time"
+)
+
+// newRefreshTestAuth returns Auth with app 1 and a logged in user
+func newRefreshTestAuth(t *testing.T) (*Auth, models.TokenPair) {
+	t.Helper()
+
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if err := storage.SaveApp(ctx, models.App{ID: 1, Name: "test", Secret: "secret"}); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+	if _, err := auth.RegisterNewUser(ctx, "user@example.com", "password"); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	session, err := auth.Login(ctx, "user@example.com", "password", 1, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return auth, session
+}
+
+func TestRefreshRotation(t *testing.T) {
+	auth, session := newRefreshTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := auth.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if tokens.RefreshToken == "" || tokens.RefreshToken == session.RefreshToken {
+		t.Errorf("Refresh returned refresh token %q, want a new one", tokens.RefreshToken)
+	}
+	if info, err := auth.Introspect(ctx, tokens.AccessToken); err != nil || !info.Active {
+		t.Errorf("Introspect of new access token = %+v, %v, want active", info, err)
+	}
+
+	// Новый токен той же семьи снова обменивается
+	if _, err := auth.Refresh(ctx, tokens.RefreshToken); err != nil {
+		t.Errorf("Refresh with rotated token: %v", err)
+	}
+}
+
+func TestRefreshReuse(t *testing.T) {
+	auth, session := newRefreshTestAuth(t)
+	ctx := context.Background()
+
+	tokens, err := auth.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := auth.Refresh(ctx, session.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Refresh with used token: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+	// Семья отозвана: токен, выданный взамен использованного, тоже не действует
+	if _, err := auth.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Refresh after reuse: err = %v, want %v", err, ErrRefreshTokenReused)
+	}
+
+	// Другие сессии пользователя не затронуты
+	other, err := auth.Login(ctx, "user@example.com", "password", 1, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := auth.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Refresh of other family: %v", err)
+	}
+}
+
+func TestRefreshExpired(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	if err := storage.SaveApp(ctx, models.App{ID: 1, Name: "test", Secret: "secret"}); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+	userID, err := auth.RegisterNewUser(ctx, "user@example.com", "password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+
+	expired := models.RefreshToken{
+		Hash:      hashToken("expired"),
+		FamilyID:  "family",
+		UserID:    userID,
+		AppID:     1,
+		ExpiresAt: time.Now().Add(-time.Second),
+	}
+	if err := storage.SaveRefreshToken(ctx, expired); err != nil {
+		t.Fatalf("SaveRefreshToken: %v", err)
+	}
+
+	for _, token := range []string{"expired", "unknown"} {
+		if _, err := auth.Refresh(ctx, token); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Refresh(%s): err = %v, want %v", token, err, ErrInvalidRefreshToken)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/services/limiter"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// RequestPasswordReset sends the password reset link to the email
+// Всё делается в фоне: ни ответ, ни время ответа не зависят от того, есть ли такой пользователь
+// Запросы ограничиваются по email и по ip, иначе через сервис можно завалить ящик письмами; пустой ip не учитывается
+func (a *Auth) RequestPasswordReset(
+	ctx context.Context,
+	email string,
+	ip string,
+) error {
+	const op = "auth.RequestPasswordReset"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.String("email", email),
+		slog.String("ip", ip),
+	)
+
+	// Лимит считается по введённому email, поэтому тоже не выдаёт, есть ли пользователь
+	if err := a.resetLimiter.Allow(ctx, email, ip); err != nil {
+		if errors.Is(err, limiter.ErrLimited) {
+			log.Warn("password reset rate limited", slogger.Err(err))
+		} else {
+			log.Error("failed to check password reset limits", slogger.Err(err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := a.resetLimiter.Failure(ctx, email, ip); err != nil {
+		log.Error("failed to count password reset request", slogger.Err(err))
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	a.background(log, func() {
+		if err := a.sendPasswordReset(ctx, log, email); err != nil {
+			log.Error("failed to send password reset", slogger.Err(err))
+		}
+	})
+
+	return nil
+}
+
+func (a *Auth) sendPasswordReset(ctx context.Context, log *slog.Logger, email string) error {
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Info("user not found, password reset is not sent")
+			return nil
+		}
+		return err
+	}
+
+	token, err := newRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	// Новая ссылка заменяет прежние: у пользователя не больше одного действующего токена
+	err = a.transactor.WithTx(ctx, func(ctx context.Context) error {
+		if err := a.tokenStorage.DeletePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		return a.tokenStorage.SavePasswordResetToken(ctx, models.PasswordResetToken{
+			Hash:      hashToken(token),
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(a.passwordReset.TTL),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := a.notifier.PasswordReset(ctx, user.Email, a.passwordReset.URL+url.QueryEscape(token)); err != nil {
+		return err
+	}
+
+	log.Info("password reset sent", slog.Any("userID", user.ID))
+
+	return nil
+}
+
+// ResetPassword sets a new password by the token from the reset link
+// Токен одноразовый; после сброса остальные токены сброса удаляются, а сессии пользователя отзываются во всех приложениях
+// ip - адрес клиента для аудита
+func (a *Auth) ResetPassword(
+	ctx context.Context,
+	token string,
+	password string,
+	ip string,
+) error {
+	const op = "auth.ResetPassword"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.String("ip", ip),
+	)
+
+	tokenHash := hashToken(token)
+	stored, err := a.tokenStorage.PasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, db.ErrTokenNotFound) {
+			log.Info("password reset token not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to get password reset token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		log.Info("password reset token expired")
+		return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+	}
+
+	log = log.With(
+		slog.Any("userID", stored.UserID),
+	)
+
+	user, err := a.userProvider.UserByID(ctx, stored.UserID)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Info("user not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to get user", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Токен тратится только на подходящий пароль
+	if err := a.passwordPolicy.Check(user.Email, password); err != nil {
+		log.Info("password rejected by policy", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.transactor.WithTx(ctx, func(ctx context.Context) error {
+		if err := a.tokenStorage.UsePasswordResetToken(ctx, tokenHash); err != nil {
+			return err
+		}
+		if err := a.userSaver.UpdatePassHash(ctx, user.ID, passHash); err != nil {
+			return err
+		}
+		if err := a.tokenStorage.DeletePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := a.tokenStorage.RevokeUserTokens(ctx, user.ID, 0); err != nil {
+			return err
+		}
+		return a.audit.SaveAuditEvent(ctx, models.AuditEvent{
+			Type:      models.AuditPasswordReset,
+			UserID:    user.ID,
+			IP:        ip,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrTokenUsed) {
+			log.Info("password reset token already used")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to reset password", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset, user tokens revoked")
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/db"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/slogger"
+	"log/slog"
+)
+
+// Logout revokes access token and, if given, the session of the refresh token
+// Both tokens must belong to userID (the caller), otherwise ErrNotTokenOwner
+// Access token stays in the denylist until it expires
+func (a *Auth) Logout(
+	ctx context.Context,
+	userID uint32,
+	accessToken string,
+	refreshToken string,
+) error {
+	const op = "auth.Logout"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+	)
+
+	claims, reason, err := a.verifyToken(ctx, accessToken)
+	if err != nil {
+		log.Error("failed to verify token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if reason != models.ReasonNone {
+		log.Info("token is not active", slog.Int("reason", int(reason)))
+		return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+	if claims.UserID != userID {
+		log.Warn("access token belongs to another user", slog.Any("ownerID", claims.UserID))
+		return fmt.Errorf("%s: %w", op, ErrNotTokenOwner)
+	}
+
+	// Проверяем refresh token до отзыва, чтобы чужой токен не отзывал и access token
+	var familyID string
+	if refreshToken != "" {
+		stored, err := a.tokenStorage.RefreshToken(ctx, hashToken(refreshToken))
+		switch {
+		case errors.Is(err, db.ErrTokenNotFound):
+			log.Info("refresh token not found")
+		case err != nil:
+			log.Error("failed to get refresh token", slogger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		case stored.UserID != userID:
+			log.Warn("refresh token belongs to another user", slog.Any("ownerID", stored.UserID))
+			return fmt.Errorf("%s: %w", op, ErrNotTokenOwner)
+		default:
+			familyID = stored.FamilyID
+		}
+	}
+
+	if err := a.tokenStorage.RevokeToken(ctx, claims.ID, claims.ExpiresAt); err != nil {
+		log.Error("failed to revoke token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if familyID != "" {
+		if err := a.tokenStorage.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+			log.Error("failed to revoke token family", slogger.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("user logged out")
+
+	return nil
+}
+
+// RevokeUserTokens revokes all access and refresh tokens of the user
+// appID = 0 revokes tokens of all apps
+func (a *Auth) RevokeUserTokens(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) error {
+	const op = "auth.RevokeUserTokens"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.Any("appID", appID),
+	)
+
+	if err := a.tokenStorage.RevokeUserTokens(ctx, userID, appID); err != nil {
+		log.Error("failed to revoke user tokens", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user tokens revoked")
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"grpc_service/internal/domain/models"
+	"testing"
+)
+
+// loginAs registers the user and returns his id and a session in the app
+func loginAs(t *testing.T, auth *Auth, email string, appID uint32) (uint32, models.TokenPair) {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := auth.userProvider.User(ctx, email); err != nil {
+		if _, err := auth.RegisterNewUser(ctx, email, "password"); err != nil {
+			t.Fatalf("RegisterNewUser: %v", err)
+		}
+	}
+	session, err := auth.Login(ctx, email, "password", appID, "")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	principal, err := auth.Authenticate(ctx, session.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	return principal.UserID, session
+}
+
+func isActive(t *testing.T, auth *Auth, accessToken string) bool {
+	t.Helper()
+
+	info, err := auth.Introspect(context.Background(), accessToken)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	return info.Active
+}
+
+func TestLogout(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+	if err := storage.SaveApp(ctx, models.App{ID: 1, Name: "test", Secret: "secret"}); err != nil {
+		t.Fatalf("SaveApp: %v", err)
+	}
+
+	t.Run("own tokens", func(t *testing.T) {
+		userID, session := loginAs(t, auth, "user@example.com", 1)
+		_, other := loginAs(t, auth, "user@example.com", 1)
+
+		if err := auth.Logout(ctx, userID, session.AccessToken, session.RefreshToken); err != nil {
+			t.Fatalf("Logout: %v", err)
+		}
+		if isActive(t, auth, session.AccessToken) {
+			t.Error("access token is active after Logout")
+		}
+		if _, err := auth.Refresh(ctx, session.RefreshToken); err == nil {
+			t.Error("Refresh after Logout: err = nil")
+		}
+		// Другая сессия пользователя не затронута
+		if !isActive(t, auth, other.AccessToken) {
+			t.Error("token of other session is revoked")
+		}
+	})
+
+	t.Run("access token of another user", func(t *testing.T) {
+		userID, session := loginAs(t, auth, "user@example.com", 1)
+		_, victim := loginAs(t, auth, "victim@example.com", 1)
+
+		if err := auth.Logout(ctx, userID, victim.AccessToken, ""); !errors.Is(err, ErrNotTokenOwner) {
+			t.Fatalf("Logout: err = %v, want %v", err, ErrNotTokenOwner)
+		}
+		if !isActive(t, auth, victim.AccessToken) {
+			t.Error("token of another user is revoked")
+		}
+		if !isActive(t, auth, session.AccessToken) {
+			t.Error("caller token is revoked")
+		}
+	})
+
+	t.Run("refresh token of another user", func(t *testing.T) {
+		userID, session := loginAs(t, auth, "user@example.com", 1)
+		_, victim := loginAs(t, auth, "victim@example.com", 1)
+
+		if err := auth.Logout(ctx, userID, session.AccessToken, victim.RefreshToken); !errors.Is(err, ErrNotTokenOwner) {
+			t.Fatalf("Logout: err = %v, want %v", err, ErrNotTokenOwner)
+		}
+		if _, err := auth.Refresh(ctx, victim.RefreshToken); err != nil {
+			t.Errorf("Refresh of another user session: %v", err)
+		}
+		// Запрос отклонён целиком
+		if !isActive(t, auth, session.AccessToken) {
+			t.Error("caller token is revoked by rejected Logout")
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		userID, session := loginAs(t, auth, "user@example.com", 1)
+		if err := auth.Logout(ctx, userID, session.AccessToken, ""); err != nil {
+			t.Fatalf("Logout: %v", err)
+		}
+		if err := auth.Logout(ctx, userID, session.AccessToken, ""); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("second Logout: err = %v, want %v", err, ErrInvalidToken)
+		}
+	})
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+	for _, app := range []models.App{{ID: 1, Name: "first", Secret: "secret"}, {ID: 2, Name: "second", Secret: "secret"}} {
+		if err := storage.SaveApp(ctx, app); err != nil {
+			t.Fatalf("SaveApp: %v", err)
+		}
+	}
+
+	userID, first := loginAs(t, auth, "user@example.com", 1)
+	_, second := loginAs(t, auth, "user@example.com", 2)
+	_, other := loginAs(t, auth, "other@example.com", 1)
+
+	jti := func(token string) string {
+		principal, err := auth.Authenticate(ctx, token)
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		return principal.TokenID
+	}
+	firstID, secondID, otherID := jti(first.AccessToken), jti(second.AccessToken), jti(other.AccessToken)
+
+	denied := func(tokenID string) bool {
+		revoked, err := storage.IsTokenRevoked(ctx, tokenID)
+		if err != nil {
+			t.Fatalf("IsTokenRevoked: %v", err)
+		}
+		return revoked
+	}
+
+	if err := auth.RevokeUserTokens(ctx, userID, 1); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+	if !denied(firstID) || isActive(t, auth, first.AccessToken) {
+		t.Error("access token of app 1 is not in the denylist")
+	}
+	if _, err := auth.Refresh(ctx, first.RefreshToken); err == nil {
+		t.Error("Refresh of app 1 after RevokeUserTokens: err = nil")
+	}
+	if denied(secondID) || denied(otherID) {
+		t.Error("RevokeUserTokens for app 1 revoked tokens of app 2 or of another user")
+	}
+
+	// appID = 0 - все приложения
+	if err := auth.RevokeUserTokens(ctx, userID, 0); err != nil {
+		t.Fatalf("RevokeUserTokens: %v", err)
+	}
+	if !denied(secondID) || isActive(t, auth, second.AccessToken) {
+		t.Error("access token of app 2 is not in the denylist")
+	}
+	if _, err := auth.Refresh(ctx, second.RefreshToken); err == nil {
+		t.Error("Refresh of app 2 after RevokeUserTokens: err = nil")
+	}
+	if denied(otherID) || !isActive(t, auth, other.AccessToken) {
+		t.Error("token of another user is revoked")
+	}
+}
@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"sort"
+)
+
+// IsAdmin checks if User is admin
+// appID = 0 checks only global admin role, otherwise admin of the app or global admin
+func (a *Auth) IsAdmin(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) (isAdmin bool, err error) {
+	const op = "auth.IsAdmin"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.Any("appID", appID),
+	)
+
+	log.Info("checking if user is admin")
+
+	roles, err := a.userProvider.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, role := range roles {
+		if role.Role.Name == models.RoleAdmin && (role.AppID == 0 || role.AppID == appID) {
+			isAdmin = true
+			break
+		}
+	}
+
+	log.Info("checked if user is admin", slog.Bool("IsAdmin", isAdmin))
+
+	return isAdmin, nil
+}
+
+// ListUserRoles returns roles of the user in the app and global roles
+// appID = 0 returns roles in all apps
+func (a *Auth) ListUserRoles(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+) ([]models.UserRole, error) {
+	const op = "auth.ListUserRoles"
+
+	roles, err := a.userProvider.UserRoles(ctx, userID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission checks if the user has the permission in the app
+func (a *Auth) HasPermission(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	permission string,
+) (bool, error) {
+	const op = "auth.HasPermission"
+
+	allowed, err := a.userProvider.HasPermission(ctx, userID, appID, permission)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed, nil
+}
+
+// AssignRole gives the role to the user in the app, appID = 0 - in all apps
+func (a *Auth) AssignRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "auth.AssignRole"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.Any("appID", appID),
+		slog.String("role", role),
+	)
+
+	if err := a.checkApp(ctx, appID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.roleSaver.AssignRole(ctx, userID, appID, role); err != nil {
+		log.Error("failed to assign role", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role assigned")
+
+	return nil
+}
+
+// RevokeRole takes the role from the user in the app
+func (a *Auth) RevokeRole(
+	ctx context.Context,
+	userID uint32,
+	appID uint32,
+	role string,
+) error {
+	const op = "auth.RevokeRole"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.Any("userID", userID),
+		slog.Any("appID", appID),
+		slog.String("role", role),
+	)
+
+	if err := a.roleSaver.RevokeRole(ctx, userID, appID, role); err != nil {
+		log.Error("failed to revoke role", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("role revoked")
+
+	return nil
+}
+
+// checkApp returns ErrAppNotFound if appID is not 0 and there is no such app
+func (a *Auth) checkApp(ctx context.Context, appID uint32) error {
+	if appID == 0 {
+		return nil
+	}
+	_, err := a.appProvider.App(ctx, appID)
+	return err
+}
+
+// tokenAccess returns roles and permissions of the user to embed into the token
+// What is embedded is configured per app. If claims exceed the size limit,
+// scope and then roles are dropped: services have to ask HasPermission instead
+func (a *Auth) tokenAccess(
+	ctx context.Context,
+	user models.User,
+	app models.App,
+) (jwt.Access, error) {
+	if !app.TokenRoles && !app.TokenScope {
+		return jwt.Access{}, nil
+	}
+
+	roles, err := a.userProvider.UserRoles(ctx, user.ID, app.ID)
+	if err != nil {
+		return jwt.Access{}, err
+	}
+
+	var (
+		access      jwt.Access
+		seenRoles   = make(map[string]bool)
+		seenPermits = make(map[string]bool)
+	)
+	for _, role := range roles {
+		if app.TokenRoles && !seenRoles[role.Role.Name] {
+			seenRoles[role.Role.Name] = true
+			access.Roles = append(access.Roles, role.Role.Name)
+		}
+		if !app.TokenScope {
+			continue
+		}
+		for _, permission := range role.Role.Permissions {
+			if !seenPermits[permission] {
+				seenPermits[permission] = true
+				access.Scope = append(access.Scope, permission)
+			}
+		}
+	}
+	sort.Strings(access.Roles)
+	sort.Strings(access.Scope)
+
+	maxSize := a.tokenParams.MaxAccessSize
+	if maxSize > 0 && access.Size() > maxSize {
+		log := a.logger(ctx).With(
+			slog.String("op", "auth.tokenAccess"),
+			slog.Any("userID", user.ID),
+			slog.Any("appID", app.ID),
+			slog.Int("size", access.Size()),
+			slog.Int("maxSize", maxSize),
+		)
+
+		access.Scope = nil
+		log.Warn("scope claim is too big, dropped")
+
+		if access.Size() > maxSize {
+			access.Roles = nil
+			log.Warn("roles claim is too big, dropped")
+		}
+	}
+
+	return access, nil
+}
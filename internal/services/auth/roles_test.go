@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/db"
+	"grpc_service/internal/db/memory"
+	"grpc_service/internal/domain/models"
+	"slices"
+	"testing"
+)
+
+// newRolesTestAuth returns Auth with apps 1 and 2 and roles editor (app permissions) and viewer
+func newRolesTestAuth(t *testing.T) (*Auth, *memory.DB) {
+	t.Helper()
+
+	auth, storage, _ := newTestAuth(t, false)
+	ctx := context.Background()
+
+	for _, app := range []models.App{{ID: 1, Name: "first", Secret: "secret"}, {ID: 2, Name: "second", Secret: "secret"}} {
+		if err := storage.SaveApp(ctx, app); err != nil {
+			t.Fatalf("SaveApp: %v", err)
+		}
+	}
+	if err := storage.SaveRole(ctx, "editor", []string{"posts.read", "posts.write"}); err != nil {
+		t.Fatalf("SaveRole: %v", err)
+	}
+	if err := storage.SaveRole(ctx, "viewer", []string{"posts.read"}); err != nil {
+		t.Fatalf("SaveRole: %v", err)
+	}
+	return auth, storage
+}
+
+func registerUser(t *testing.T, auth *Auth, email string) uint32 {
+	t.Helper()
+
+	userID, err := auth.RegisterNewUser(context.Background(), email, "password")
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	return uint32(userID)
+}
+
+func assignRoles(t *testing.T, auth *Auth, userID uint32, roles map[string]uint32) {
+	t.Helper()
+
+	for role, appID := range roles {
+		if err := auth.AssignRole(context.Background(), userID, appID, role); err != nil {
+			t.Fatalf("AssignRole(%s, app %d): %v", role, appID, err)
+		}
+	}
+}
+
+// roleNames returns "app:role" of the roles in storage order
+func roleNames(roles []models.UserRole) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, fmt.Sprintf("%d:%s", role.AppID, role.Role.Name))
+	}
+	return names
+}
+
+func TestRoleScopes(t *testing.T) {
+	auth, _ := newRolesTestAuth(t)
+	ctx := context.Background()
+
+	userID := registerUser(t, auth, "user@example.com")
+	assignRoles(t, auth, userID, map[string]uint32{"viewer": 0, "editor": 1})
+
+	tests := []struct {
+		appID uint32
+		want  []string
+	}{
+		{1, []string{"0:viewer", "1:editor"}},
+		// Глобальная роль действует во всех приложениях
+		{2, []string{"0:viewer"}},
+		// appID = 0 - роли во всех приложениях
+		{0, []string{"0:viewer", "1:editor"}},
+	}
+	for _, tt := range tests {
+		roles, err := auth.ListUserRoles(ctx, userID, tt.appID)
+		if err != nil {
+			t.Fatalf("ListUserRoles: %v", err)
+		}
+		if got := roleNames(roles); !slices.Equal(got, tt.want) {
+			t.Errorf("ListUserRoles(app %d) = %v, want %v", tt.appID, got, tt.want)
+		}
+	}
+}
+
+func TestIsAdminScopes(t *testing.T) {
+	auth, _ := newRolesTestAuth(t)
+	ctx := context.Background()
+
+	appAdmin := registerUser(t, auth, "app-admin@example.com")
+	assignRoles(t, auth, appAdmin, map[string]uint32{models.RoleAdmin: 1})
+	globalAdmin := registerUser(t, auth, "global-admin@example.com")
+	assignRoles(t, auth, globalAdmin, map[string]uint32{models.RoleAdmin: 0})
+
+	tests := []struct {
+		name   string
+		userID uint32
+		appID  uint32
+		want   bool
+	}{
+		{"app admin in own app", appAdmin, 1, true},
+		{"app admin in other app", appAdmin, 2, false},
+		{"app admin globally", appAdmin, 0, false},
+		{"global admin in app", globalAdmin, 2, true},
+		{"global admin globally", globalAdmin, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.IsAdmin(ctx, tt.userID, tt.appID)
+			if err != nil || got != tt.want {
+				t.Errorf("IsAdmin = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	auth, _ := newRolesTestAuth(t)
+	ctx := context.Background()
+
+	userID := registerUser(t, auth, "user@example.com")
+	assignRoles(t, auth, userID, map[string]uint32{"viewer": 0, "editor": 1})
+	adminID := registerUser(t, auth, "admin@example.com")
+	assignRoles(t, auth, adminID, map[string]uint32{models.RoleAdmin: 2})
+
+	tests := []struct {
+		name       string
+		userID     uint32
+		appID      uint32
+		permission string
+		want       bool
+	}{
+		{"app role", userID, 1, "posts.write", true},
+		{"app role in other app", userID, 2, "posts.write", false},
+		{"global role", userID, 2, "posts.read", true},
+		{"unknown permission", userID, 1, "posts.delete", false},
+		{"admin wildcard", adminID, 2, "posts.delete", true},
+		{"admin wildcard in other app", adminID, 1, "posts.read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.HasPermission(ctx, tt.userID, tt.appID, tt.permission)
+			if err != nil || got != tt.want {
+				t.Errorf("HasPermission = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := auth.HasPermission(ctx, 100500, 1, "posts.read"); !errors.Is(err, db.ErrUserNotFound) {
+		t.Errorf("HasPermission of unknown user: err = %v, want %v", err, db.ErrUserNotFound)
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	auth, _ := newRolesTestAuth(t)
+	ctx := context.Background()
+
+	userID := registerUser(t, auth, "user@example.com")
+
+	// Повторное назначение не ошибка и не создаёт второй записи
+	for i := 0; i < 2; i++ {
+		if err := auth.AssignRole(ctx, userID, 1, "editor"); err != nil {
+			t.Fatalf("AssignRole #%d: %v", i+1, err)
+		}
+	}
+	roles, err := auth.ListUserRoles(ctx, userID, 1)
+	if err != nil {
+		t.Fatalf("ListUserRoles: %v", err)
+	}
+	if got := roleNames(roles); !slices.Equal(got, []string{"1:editor"}) {
+		t.Errorf("roles after assigning twice = %v, want [1:editor]", got)
+	}
+
+	if err := auth.AssignRole(ctx, userID, 3, "editor"); !errors.Is(err, db.ErrAppNotFound) {
+		t.Errorf("AssignRole in unknown app: err = %v, want %v", err, db.ErrAppNotFound)
+	}
+	if err := auth.AssignRole(ctx, userID, 1, "no-such-role"); !errors.Is(err, db.ErrRoleNotFound) {
+		t.Errorf("AssignRole of unknown role: err = %v, want %v", err, db.ErrRoleNotFound)
+	}
+}
+
+func TestRevokeRole(t *testing.T) {
+	auth, _ := newRolesTestAuth(t)
+	ctx := context.Background()
+
+	userID := registerUser(t, auth, "user@example.com")
+	assignRoles(t, auth, userID, map[string]uint32{"viewer": 0, "editor": 1})
+
+	// Роли, которой у пользователя нет (или она в другом приложении) - не ошибка, остальные роли не меняются
+	if err := auth.RevokeRole(ctx, userID, 1, models.RoleAdmin); err != nil {
+		t.Errorf("RevokeRole of role the user doesn't have: %v", err)
+	}
+	if err := auth.RevokeRole(ctx, userID, 2, "editor"); err != nil {
+		t.Errorf("RevokeRole in other app: %v", err)
+	}
+	if err := auth.RevokeRole(ctx, userID, 1, "no-such-role"); !errors.Is(err, db.ErrRoleNotFound) {
+		t.Errorf("RevokeRole of unknown role: err = %v, want %v", err, db.ErrRoleNotFound)
+	}
+
+	roles, err := auth.ListUserRoles(ctx, userID, 0)
+	if err != nil {
+		t.Fatalf("ListUserRoles: %v", err)
+	}
+	if got := roleNames(roles); !slices.Equal(got, []string{"0:viewer", "1:editor"}) {
+		t.Errorf("roles = %v, want unchanged", got)
+	}
+
+	// Глобальная роль снимается только с appID = 0
+	if err := auth.RevokeRole(ctx, userID, 1, "viewer"); err != nil {
+		t.Fatalf("RevokeRole: %v", err)
+	}
+	if ok, _ := auth.HasPermission(ctx, userID, 2, "posts.read"); !ok {
+		t.Error("global role is revoked by RevokeRole in app 1")
+	}
+	if err := auth.RevokeRole(ctx, userID, 0, "viewer"); err != nil {
+		t.Fatalf("RevokeRole: %v", err)
+	}
+	if ok, _ := auth.HasPermission(ctx, userID, 2, "posts.read"); ok {
+		t.Error("permission of revoked global role is still granted")
+	}
+}
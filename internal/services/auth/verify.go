@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/actiontoken"
+	"grpc_service/internal/db"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"net/url"
+)
+
+// SendVerification sends a new verification link to the email
+// Ответ не зависит от того, есть ли такой пользователь и подтверждён ли email
+func (a *Auth) SendVerification(
+	ctx context.Context,
+	email string,
+) error {
+	const op = "auth.SendVerification"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Info("user not found, verification is not sent")
+			return nil
+		}
+		log.Error("failed to get user", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.EmailVerified {
+		log.Info("email already verified")
+		return nil
+	}
+
+	a.sendVerification(ctx, log, user.ID, user.Email)
+
+	return nil
+}
+
+// VerifyEmail marks email from the token as verified
+// Токен действует, пока email пользователя не изменился и ещё не подтверждён, поэтому он одноразовый
+func (a *Auth) VerifyEmail(
+	ctx context.Context,
+	token string,
+) error {
+	const op = "auth.VerifyEmail"
+
+	log := a.logger(ctx).With(
+		slog.String("op", op),
+	)
+
+	claims, err := a.actionTokens.Verify(token, actiontoken.PurposeVerifyEmail)
+	if err != nil {
+		log.Info("invalid verification token", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+	}
+
+	log = log.With(
+		slog.Any("userID", claims.UserID),
+	)
+
+	if err := a.userSaver.MarkEmailVerified(ctx, claims.UserID, claims.Email); err != nil {
+		if errors.Is(err, db.ErrUserNotFound) {
+			log.Info("email changed or already verified")
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+		log.Error("failed to mark email verified", slogger.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email verified")
+
+	return nil
+}
+
+// sendVerification signs the token and sends the link in background, как и notifyRegistrationAttempt
+func (a *Auth) sendVerification(ctx context.Context, log *slog.Logger, userID uint32, email string) {
+	token, err := a.actionTokens.Sign(actiontoken.Claims{
+		Purpose: actiontoken.PurposeVerifyEmail,
+		UserID:  userID,
+		Email:   email,
+	}, a.verification.TTL)
+	if err != nil {
+		log.Error("failed to sign verification token", slogger.Err(err))
+		return
+	}
+	link := a.verification.URL + url.QueryEscape(token)
+
+	ctx = context.WithoutCancel(ctx)
+	a.background(log, func() {
+		if err := a.notifier.EmailVerification(ctx, email, link); err != nil {
+			log.Error("failed to send verification email", slogger.Err(err))
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package cleanup
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"time"
+)
+
+// Storage удаляет записи, срок жизни которых истёк
+type Storage interface {
+	DeleteExpiredTokens(ctx context.Context) error
+	DeleteExpiredLoginAttempts(ctx context.Context) error
+}
+
+// Cleaner periodically deletes expired records from the storage
+// Запросы и так не учитывают истёкшие записи, чистка нужна только чтобы таблицы не росли
+type Cleaner struct {
+	log      *slog.Logger
+	storage  Storage
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	interval time.Duration,
+) *Cleaner {
+	return &Cleaner{
+		log:      log,
+		storage:  storage,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Run deletes expired records every interval until Stop is called
+func (c *Cleaner) Run() {
+	const op = "cleanup.Run"
+
+	log := c.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("cleanup is running", slog.Duration("interval", c.interval))
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.storage.DeleteExpiredTokens(context.Background()); err != nil {
+				log.Error("failed to delete expired tokens", slogger.Err(err))
+			}
+			if err := c.storage.DeleteExpiredLoginAttempts(context.Background()); err != nil {
+				log.Error("failed to delete expired login attempts", slogger.Err(err))
+			}
+		}
+	}
+}
+
+func (c *Cleaner) Stop() {
+	const op = "cleanup.Stop"
+
+	c.log.With(
+		slog.String("op", op),
+	).Info("stopping cleanup")
+	close(c.stop)
+}
@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"time"
+)
+
+// Pinger checks that the storage is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Reporter publishes serving status, e.g. to grpc.health.v1
+type Reporter interface {
+	SetServing(serving bool)
+}
+
+// Checker periodically pings the storage and reports whether the service can serve requests
+type Checker struct {
+	log      *slog.Logger
+	pinger   Pinger
+	reporter Reporter
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func New(
+	log *slog.Logger,
+	pinger Pinger,
+	reporter Reporter,
+	interval time.Duration,
+) *Checker {
+	return &Checker{
+		log:      log,
+		pinger:   pinger,
+		reporter: reporter,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Run checks the storage right away and then every interval until Stop is called
+func (c *Checker) Run() {
+	const op = "health.Run"
+
+	log := c.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("health checker is running", slog.Duration("interval", c.interval))
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	serving := c.check(log, true)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			serving = c.check(log, serving)
+		}
+	}
+}
+
+// check pings the storage and reports the status
+// В лог пишутся только изменения статуса, чтобы не засорять его каждым тиком
+func (c *Checker) check(log *slog.Logger, wasServing bool) bool {
+	// Ping не должен пережить следующую проверку
+	ctx, cancel := context.WithTimeout(context.Background(), c.interval)
+	defer cancel()
+
+	err := c.pinger.Ping(ctx)
+	serving := err == nil
+
+	switch {
+	case !serving && wasServing:
+		log.Error("storage is unavailable, not serving", slogger.Err(err))
+	case serving && !wasServing:
+		log.Info("storage is available again, serving")
+	}
+
+	c.reporter.SetServing(serving)
+	return serving
+}
+
+func (c *Checker) Stop() {
+	const op = "health.Stop"
+
+	c.log.With(
+		slog.String("op", op),
+	).Info("stopping health checker")
+	close(c.stop)
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePinger fails while err is set
+type fakePinger struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (p *fakePinger) Ping(context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *fakePinger) set(err error) {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+}
+
+// chanReporter sends reported statuses to the channel, drops them if nobody reads
+type chanReporter chan bool
+
+func (r chanReporter) SetServing(serving bool) {
+	select {
+	case r <- serving:
+	default:
+	}
+}
+
+// waitStatus skips repeated statuses until the wanted one is reported
+func waitStatus(t *testing.T, reports chanReporter, want bool) {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case serving := <-reports:
+			if serving == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("status serving=%v is not reported", want)
+		}
+	}
+}
+
+func TestCheckerTransitions(t *testing.T) {
+	pinger := &fakePinger{err: errors.New("connection refused")}
+	reports := make(chanReporter, 16)
+
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), pinger, reports, 5*time.Millisecond)
+	go c.Run()
+	defer c.Stop()
+
+	// Первая проверка сразу при запуске
+	select {
+	case serving := <-reports:
+		if serving {
+			t.Fatal("NOT_SERVING storage is reported as SERVING")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no status after Run")
+	}
+
+	pinger.set(nil)
+	waitStatus(t, reports, true)
+
+	pinger.set(errors.New("connection reset"))
+	waitStatus(t, reports, false)
+
+	pinger.set(nil)
+	waitStatus(t, reports, true)
+}
+
+func TestCheckerStop(t *testing.T) {
+	reports := make(chanReporter, 16)
+	c := New(slog.New(slog.NewTextHandler(io.Discard, nil)), &fakePinger{}, reports, time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		c.Run()
+		close(done)
+	}()
+	waitStatus(t, reports, true)
+
+	c.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after Stop")
+	}
+}
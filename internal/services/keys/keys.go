@@ -0,0 +1,535 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	rsaBits = 2048
+	// Как часто перечитывать ключи из хранилища (ключи могли создать другие реплики)
+	reloadInterval = time.Minute
+	// Не чаще этого перечитываем ключи при запросе неизвестного kid
+	minReloadInterval = 5 * time.Second
+)
+
+var (
+	ErrKeyNotFound    = errors.New("signing key not found")
+	ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+)
+
+type KeyStorage interface {
+	SaveSigningKey(ctx context.Context, key models.SigningKey) error
+	SigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	RetireSigningKey(ctx context.Context, keyID string, expiresAt time.Time) error
+	DeleteExpiredSigningKeys(ctx context.Context) error
+}
+
+// Manager выдаёт ключи для подписи токенов и занимается их ротацией
+type Manager struct {
+	log            *slog.Logger
+	storage        KeyStorage
+	rotationPeriod time.Duration
+	overlap        time.Duration
+	checkInterval  time.Duration
+	perApp         bool
+	sealer         *sealer
+
+	mu       sync.RWMutex
+	keys     map[string]parsedKey // по kid
+	loadedAt time.Time
+
+	genMu sync.Mutex
+	stop  chan struct{}
+}
+
+type parsedKey struct {
+	models.SigningKey
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+type scope struct {
+	appID uint32
+	alg   string
+}
+
+// New returns a new instance of key Manager
+// overlap - how long the key is published after rotation, must be not less than token TTL
+// encryptionKey - 32 bytes to encrypt private keys in storage, empty - keys are stored as plain PKCS #8
+func New(
+	log *slog.Logger,
+	storage KeyStorage,
+	rotationPeriod time.Duration,
+	overlap time.Duration,
+	checkInterval time.Duration,
+	perApp bool,
+	encryptionKey []byte,
+) (*Manager, error) {
+	const op = "keys.New"
+
+	sealer, err := newSealer(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Manager{
+		log:            log,
+		storage:        storage,
+		rotationPeriod: rotationPeriod,
+		overlap:        overlap,
+		checkInterval:  checkInterval,
+		perApp:         perApp,
+		sealer:         sealer,
+		keys:           make(map[string]parsedKey),
+		stop:           make(chan struct{}),
+	}, nil
+}
+
+// SigningKey returns key to sign tokens of the app
+// For HS256 apps it is the app secret, otherwise the newest active key pair
+func (m *Manager) SigningKey(
+	ctx context.Context,
+	app models.App,
+) (jwt.Key, error) {
+	const op = "keys.SigningKey"
+
+	alg := appAlg(app)
+	if alg == jwt.AlgHS256 {
+		return secretKey(app), nil
+	}
+	if !supportedAlg(alg) {
+		return jwt.Key{}, fmt.Errorf("%s: %w: %s", op, ErrUnsupportedAlg, alg)
+	}
+
+	sc := m.scope(app, alg)
+
+	if err := m.loadIfStale(ctx, reloadInterval); err != nil {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if key, ok := m.activeKey(sc); ok {
+		return key.jwtKey(), nil
+	}
+
+	// Ключа ещё нет: создаём первый ключ для этой области
+	m.genMu.Lock()
+	defer m.genMu.Unlock()
+
+	if key, ok := m.activeKey(sc); ok {
+		return key.jwtKey(), nil
+	}
+
+	key, err := m.createKey(ctx, sc)
+	if err != nil {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key.jwtKey(), nil
+}
+
+// VerificationKey returns key to check signature of the app token
+// Key must belong to the app (or be global) and match the app algorithm
+func (m *Manager) VerificationKey(
+	ctx context.Context,
+	app models.App,
+	keyID string,
+	alg string,
+) (jwt.Key, error) {
+	const op = "keys.VerificationKey"
+
+	appAlgorithm := appAlg(app)
+	if appAlgorithm == jwt.AlgHS256 {
+		return secretKey(app), nil
+	}
+	if keyID == "" || alg != appAlgorithm {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, ErrKeyNotFound)
+	}
+
+	key, ok := m.key(keyID)
+	if !ok {
+		if err := m.loadIfStale(ctx, minReloadInterval); err != nil {
+			return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+		}
+		key, ok = m.key(keyID)
+	}
+	if !ok || key.Algorithm != alg || (key.AppID != 0 && key.AppID != app.ID) {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, ErrKeyNotFound)
+	}
+
+	return key.jwtKey(), nil
+}
+
+// JWKS returns public keys of all published key pairs
+func (m *Manager) JWKS(ctx context.Context) ([]models.JWK, error) {
+	const op = "keys.JWKS"
+
+	if err := m.loadIfStale(ctx, reloadInterval); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	jwks := make([]models.JWK, 0, len(m.keys))
+	for _, key := range m.keys {
+		if !key.ExpiresAt.IsZero() && now.After(key.ExpiresAt) {
+			continue
+		}
+		jwks = append(jwks, key.jwk())
+	}
+
+	return jwks, nil
+}
+
+// Rotate replaces active keys older than rotation period
+// Old keys stay published for the overlap, so issued tokens can still be verified
+func (m *Manager) Rotate(ctx context.Context) error {
+	const op = "keys.Rotate"
+
+	log := m.log.With(
+		slog.String("op", op),
+	)
+
+	m.genMu.Lock()
+	defer m.genMu.Unlock()
+
+	if err := m.load(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	active := make(map[scope][]parsedKey)
+	for _, key := range m.keys {
+		if key.ExpiresAt.IsZero() {
+			sc := scope{appID: key.AppID, alg: key.Algorithm}
+			active[sc] = append(active[sc], key)
+		}
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	for sc, keys := range active {
+		newest := newestKey(keys)
+
+		if now.Sub(newest.CreatedAt) >= m.rotationPeriod {
+			if _, err := m.createKey(ctx, sc); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+		} else {
+			// Лишние активные ключи (например, созданные параллельно репликами)
+			keys = removeKey(keys, newest.ID)
+		}
+
+		for _, key := range keys {
+			err := m.storage.RetireSigningKey(ctx, key.ID, now.Add(m.overlap))
+			if err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+			log.Info("signing key retired", slog.String("kid", key.ID))
+		}
+	}
+
+	if err := m.storage.DeleteExpiredSigningKeys(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.load(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Run rotates keys every check interval until Stop is called
+func (m *Manager) Run() {
+	const op = "keys.Run"
+
+	log := m.log.With(
+		slog.String("op", op),
+	)
+
+	log.Info("key rotation is running", slog.Duration("interval", m.checkInterval))
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if err := m.Rotate(context.Background()); err != nil {
+				log.Error("failed to rotate keys", slogger.Err(err))
+			}
+		}
+	}
+}
+
+func (m *Manager) Stop() {
+	const op = "keys.Stop"
+
+	m.log.With(
+		slog.String("op", op),
+	).Info("stopping key rotation")
+	close(m.stop)
+}
+
+func (m *Manager) scope(app models.App, alg string) scope {
+	if m.perApp {
+		return scope{appID: app.ID, alg: alg}
+	}
+	return scope{appID: 0, alg: alg}
+}
+
+func (m *Manager) key(keyID string) (parsedKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[keyID]
+	return key, ok
+}
+
+func (m *Manager) activeKey(sc scope) (parsedKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []parsedKey
+	for _, key := range m.keys {
+		if key.ExpiresAt.IsZero() && key.AppID == sc.appID && key.Algorithm == sc.alg {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return parsedKey{}, false
+	}
+
+	return newestKey(keys), true
+}
+
+func (m *Manager) loadIfStale(ctx context.Context, maxAge time.Duration) error {
+	m.mu.RLock()
+	loadedAt := m.loadedAt
+	m.mu.RUnlock()
+
+	if time.Since(loadedAt) < maxAge {
+		return nil
+	}
+
+	return m.load(ctx)
+}
+
+// load перечитывает все опубликованные ключи из хранилища
+func (m *Manager) load(ctx context.Context) error {
+	stored, err := m.storage.SigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]parsedKey, len(stored))
+	for _, s := range stored {
+		private, err := m.sealer.open(s.ID, s.PrivateKey)
+		if err != nil {
+			m.log.Error("failed to decrypt signing key", slog.String("kid", s.ID), slogger.Err(err))
+			continue
+		}
+		s.PrivateKey = private
+
+		key, err := parseKey(s)
+		if err != nil {
+			m.log.Error("failed to parse signing key", slog.String("kid", s.ID), slogger.Err(err))
+			continue
+		}
+		keys[key.ID] = key
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Manager) createKey(ctx context.Context, sc scope) (parsedKey, error) {
+	stored, err := generateKey(sc)
+	if err != nil {
+		return parsedKey{}, err
+	}
+
+	sealed := stored
+	sealed.PrivateKey, err = m.sealer.seal(stored.ID, stored.PrivateKey)
+	if err != nil {
+		return parsedKey{}, err
+	}
+	if err := m.storage.SaveSigningKey(ctx, sealed); err != nil {
+		return parsedKey{}, err
+	}
+
+	key, err := parseKey(stored)
+	if err != nil {
+		return parsedKey{}, err
+	}
+
+	m.mu.Lock()
+	m.keys[key.ID] = key
+	m.mu.Unlock()
+
+	m.log.Info("signing key created",
+		slog.String("kid", key.ID),
+		slog.String("alg", key.Algorithm),
+		slog.Any("appID", key.AppID),
+	)
+
+	return key, nil
+}
+
+func generateKey(sc scope) (models.SigningKey, error) {
+	var (
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+	)
+
+	switch sc.alg {
+	case jwt.AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaBits)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		private, public = key, &key.PublicKey
+	case jwt.AlgEdDSA:
+		pub, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return models.SigningKey{}, err
+		}
+		private, public = key, pub
+	default:
+		return models.SigningKey{}, fmt.Errorf("%w: %s", ErrUnsupportedAlg, sc.alg)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return models.SigningKey{}, err
+	}
+
+	return models.SigningKey{
+		ID:         hex.EncodeToString(id),
+		AppID:      sc.appID,
+		Algorithm:  sc.alg,
+		PrivateKey: privateDER,
+		PublicKey:  publicDER,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func parseKey(key models.SigningKey) (parsedKey, error) {
+	private, err := x509.ParsePKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return parsedKey{}, err
+	}
+	public, err := x509.ParsePKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return parsedKey{}, err
+	}
+
+	return parsedKey{
+		SigningKey: key,
+		private:    private,
+		public:     public,
+	}, nil
+}
+
+func (k parsedKey) jwtKey() jwt.Key {
+	return jwt.Key{
+		ID:        k.ID,
+		Algorithm: k.Algorithm,
+		Private:   k.private,
+		Public:    k.public,
+	}
+}
+
+func (k parsedKey) jwk() models.JWK {
+	jwk := models.JWK{
+		KeyID:     k.ID,
+		Algorithm: k.Algorithm,
+		Use:       "sig",
+	}
+
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
+
+func secretKey(app models.App) jwt.Key {
+	//!-Быть аккуратным и не залогировать app.Secret
+	return jwt.Key{
+		Algorithm: jwt.AlgHS256,
+		Private:   []byte(app.Secret),
+		Public:    []byte(app.Secret),
+	}
+}
+
+// appAlg returns signing algorithm of the app, HS256 by default
+func appAlg(app models.App) string {
+	if app.SigningAlg == "" {
+		return jwt.AlgHS256
+	}
+	return app.SigningAlg
+}
+
+func supportedAlg(alg string) bool {
+	return alg == jwt.AlgRS256 || alg == jwt.AlgEdDSA
+}
+
+func newestKey(keys []parsedKey) parsedKey {
+	newest := keys[0]
+	for _, key := range keys[1:] {
+		if key.CreatedAt.After(newest.CreatedAt) {
+			newest = key
+		}
+	}
+	return newest
+}
+
+func removeKey(keys []parsedKey, keyID string) []parsedKey {
+	res := make([]parsedKey, 0, len(keys))
+	for _, key := range keys {
+		if key.ID != keyID {
+			res = append(res, key)
+		}
+	}
+	return res
+}
@@ -0,0 +1,290 @@
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"grpc_service/internal/db/memory"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/jwt"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestManager(t *testing.T, storage KeyStorage, perApp bool, encryptionKey []byte) *Manager {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m, err := New(log, storage, time.Hour, time.Hour, time.Minute, perApp, encryptionKey)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+// storedKey returns the key as it is saved in storage
+func storedKey(t *testing.T, storage KeyStorage, keyID string) models.SigningKey {
+	t.Helper()
+
+	keys, err := storage.SigningKeys(context.Background())
+	if err != nil {
+		t.Fatalf("SigningKeys: %v", err)
+	}
+	for _, key := range keys {
+		if key.ID == keyID {
+			return key
+		}
+	}
+	t.Fatalf("key %s is not in storage", keyID)
+	return models.SigningKey{}
+}
+
+func jwksHas(t *testing.T, m *Manager, keyID string) bool {
+	t.Helper()
+
+	jwks, err := m.JWKS(context.Background())
+	if err != nil {
+		t.Fatalf("JWKS: %v", err)
+	}
+	for _, jwk := range jwks {
+		if jwk.KeyID == keyID {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	m := newTestManager(t, storage, false, nil)
+	app := models.App{ID: 1, SigningAlg: jwt.AlgRS256}
+
+	old, err := m.SigningKey(ctx, app)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+
+	// Ключ моложе rotation_period не меняется
+	if err := m.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if key, _ := m.SigningKey(ctx, app); key.ID != old.ID {
+		t.Fatalf("key rotated before rotation_period: %s, want %s", key.ID, old.ID)
+	}
+
+	stored := storedKey(t, storage, old.ID)
+	stored.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := storage.SaveSigningKey(ctx, stored); err != nil {
+		t.Fatalf("SaveSigningKey: %v", err)
+	}
+
+	if err := m.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	current, err := m.SigningKey(ctx, app)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	if current.ID == old.ID {
+		t.Fatal("key is not rotated after rotation_period")
+	}
+
+	// В overlap старый ключ проверяет подпись и публикуется
+	if _, err := m.VerificationKey(ctx, app, old.ID, jwt.AlgRS256); err != nil {
+		t.Errorf("VerificationKey of retired key during overlap: %v", err)
+	}
+	if !jwksHas(t, m, old.ID) || !jwksHas(t, m, current.ID) {
+		t.Error("JWKS must have both keys during overlap")
+	}
+	if expiresAt := storedKey(t, storage, old.ID).ExpiresAt; time.Until(expiresAt) <= 0 || time.Until(expiresAt) > time.Hour {
+		t.Errorf("retired key expires at %s, want within overlap", expiresAt)
+	}
+
+	// overlap прошёл
+	stored = storedKey(t, storage, old.ID)
+	stored.ExpiresAt = time.Now().Add(-time.Second)
+	if err := storage.SaveSigningKey(ctx, stored); err != nil {
+		t.Fatalf("SaveSigningKey: %v", err)
+	}
+	if err := m.Rotate(ctx); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	if _, err := m.VerificationKey(ctx, app, old.ID, jwt.AlgRS256); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("VerificationKey of expired key: err = %v, want %v", err, ErrKeyNotFound)
+	}
+	if jwksHas(t, m, old.ID) {
+		t.Error("JWKS has expired key")
+	}
+	if key, _ := m.SigningKey(ctx, app); key.ID != current.ID {
+		t.Errorf("signing key = %s, want %s", key.ID, current.ID)
+	}
+}
+
+func TestVerificationKey(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, memory.New(), true, nil)
+
+	app := models.App{ID: 1, SigningAlg: jwt.AlgRS256}
+	key, err := m.SigningKey(ctx, app)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		app   models.App
+		keyID string
+		alg   string
+		ok    bool
+	}{
+		{"own key", app, key.ID, jwt.AlgRS256, true},
+		{"wrong alg", app, key.ID, jwt.AlgEdDSA, false},
+		{"other app", models.App{ID: 2, SigningAlg: jwt.AlgRS256}, key.ID, jwt.AlgRS256, false},
+		{"other app alg", models.App{ID: 1, SigningAlg: jwt.AlgEdDSA}, key.ID, jwt.AlgEdDSA, false},
+		{"unknown kid", app, "unknown", jwt.AlgRS256, false},
+		{"no kid", app, "", jwt.AlgRS256, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.VerificationKey(ctx, tt.app, tt.keyID, tt.alg)
+			if !tt.ok {
+				if !errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("err = %v, want %v", err, ErrKeyNotFound)
+				}
+				return
+			}
+			if err != nil || got.ID != key.ID {
+				t.Errorf("VerificationKey = %s, %v, want %s", got.ID, err, key.ID)
+			}
+		})
+	}
+}
+
+func TestJWK(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t, memory.New(), false, nil)
+
+	t.Run("RSA", func(t *testing.T) {
+		key, err := m.SigningKey(ctx, models.App{ID: 1, SigningAlg: jwt.AlgRS256})
+		if err != nil {
+			t.Fatalf("SigningKey: %v", err)
+		}
+		public := key.Public.(*rsa.PublicKey)
+
+		jwk, _ := m.key(key.ID)
+		got := jwk.jwk()
+		if got.KeyType != "RSA" || got.Algorithm != jwt.AlgRS256 || got.Use != "sig" || got.KeyID != key.ID {
+			t.Errorf("jwk = %+v", got)
+		}
+		if n := decode(t, got.N); new(big.Int).SetBytes(n).Cmp(public.N) != 0 {
+			t.Error("jwk n does not match the public key")
+		}
+		// 65537 -> AQAB
+		if got.E != "AQAB" {
+			t.Errorf("jwk e = %q, want AQAB", got.E)
+		}
+	})
+
+	t.Run("Ed25519", func(t *testing.T) {
+		key, err := m.SigningKey(ctx, models.App{ID: 1, SigningAlg: jwt.AlgEdDSA})
+		if err != nil {
+			t.Fatalf("SigningKey: %v", err)
+		}
+		public := key.Public.(ed25519.PublicKey)
+
+		jwk, _ := m.key(key.ID)
+		got := jwk.jwk()
+		if got.KeyType != "OKP" || got.Curve != "Ed25519" || got.Algorithm != jwt.AlgEdDSA || got.KeyID != key.ID {
+			t.Errorf("jwk = %+v", got)
+		}
+		if got.N != "" || got.E != "" {
+			t.Errorf("Ed25519 jwk has RSA fields: %+v", got)
+		}
+		if x := decode(t, got.X); !bytes.Equal(x, public) {
+			t.Error("jwk x does not match the public key")
+		}
+	})
+}
+
+func TestEncryptedKeys(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	app := models.App{ID: 1, SigningAlg: jwt.AlgEdDSA}
+
+	// Ключ, сохранённый до включения шифрования
+	plain, err := newTestManager(t, storage, false, nil).SigningKey(ctx, app)
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+
+	m := newTestManager(t, storage, true, testEncryptionKey)
+	sealed, err := m.SigningKey(ctx, models.App{ID: 2, SigningAlg: jwt.AlgEdDSA})
+	if err != nil {
+		t.Fatalf("SigningKey: %v", err)
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(storedKey(t, storage, sealed.ID).PrivateKey); err == nil {
+		t.Error("private key is stored as plain PKCS #8")
+	}
+
+	tests := []struct {
+		name          string
+		encryptionKey []byte
+		keyID         string
+		appID         uint32
+		ok            bool
+	}{
+		{"encrypted", testEncryptionKey, sealed.ID, 2, true},
+		{"plain with encryption key", testEncryptionKey, plain.ID, 1, true},
+		{"encrypted without encryption key", nil, sealed.ID, 2, false},
+		{"plain without encryption key", nil, plain.ID, 1, true},
+		{"encrypted with other key", []byte("fedcba9876543210fedcba9876543210"), sealed.ID, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Другая реплика читает ключи из того же хранилища
+			replica := newTestManager(t, storage, true, tt.encryptionKey)
+			appWithKey := models.App{ID: tt.appID, SigningAlg: jwt.AlgEdDSA}
+
+			key, err := replica.VerificationKey(ctx, appWithKey, tt.keyID, jwt.AlgEdDSA)
+			if !tt.ok {
+				if !errors.Is(err, ErrKeyNotFound) {
+					t.Errorf("err = %v, want %v", err, ErrKeyNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerificationKey: %v", err)
+			}
+			if _, ok := key.Private.(ed25519.PrivateKey); !ok {
+				t.Errorf("private key type %T", key.Private)
+			}
+		})
+	}
+
+	if _, err := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, time.Hour, time.Hour, time.Minute, false, []byte("short")); err == nil {
+		t.Error("New with 5 byte encryption key: err = nil")
+	}
+}
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
@@ -0,0 +1,76 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Зашифрованный ключ начинается с этого префикса. PKCS #8 DER начинается с 0x30,
+// поэтому ключи, сохранённые до включения шифрования, читаются как есть
+var sealedPrefix = []byte("\x00kek1:")
+
+var ErrNoEncryptionKey = errors.New("signing key is encrypted, keys.encryption_key is not set")
+
+// sealer encrypts private keys with the key-encryption key (AES-256-GCM)
+// nil sealer хранит ключи открытым текстом
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(encryptionKey []byte) (*sealer, error) {
+	if len(encryptionKey) == 0 {
+		return nil, nil
+	}
+	if len(encryptionKey) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(encryptionKey))
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealer{aead: aead}, nil
+}
+
+// seal encrypts private key, kid is authenticated so the ciphertext can't be moved to another row
+func (s *sealer) seal(keyID string, private []byte) ([]byte, error) {
+	if s == nil {
+		return private, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte{}, sealedPrefix...)
+	sealed = append(sealed, nonce...)
+	return s.aead.Seal(sealed, nonce, private, []byte(keyID)), nil
+}
+
+// open decrypts private key, plaintext keys are returned unchanged
+func (s *sealer) open(keyID string, stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, sealedPrefix) {
+		return stored, nil
+	}
+	if s == nil {
+		return nil, ErrNoEncryptionKey
+	}
+
+	data := stored[len(sealedPrefix):]
+	if len(data) < s.aead.NonceSize() {
+		return nil, errors.New("sealed signing key is too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+
+	return s.aead.Open(nil, nonce, ciphertext, []byte(keyID))
+}
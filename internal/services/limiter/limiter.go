@@ -0,0 +1,220 @@
+// Package limiter slows down password guessing.
+// Неудачные входы считаются отдельно по email и по IP: после нескольких попыток
+// следующая разрешается через экспоненциально растущую паузу, затем ключ блокируется на время
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"grpc_service/internal/domain/models"
+	"grpc_service/internal/slogger"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var ErrLimited = errors.New("too many login attempts")
+
+// Storage keeps attempts. Общее хранилище нужно, чтобы лимиты работали на всех репликах
+type Storage interface {
+	LoginAttempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	AddLoginFailure(ctx context.Context, key string, at time.Time, window time.Duration) (models.LoginAttempts, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+// Rules for one kind of key
+type Rules struct {
+	// Сколько неудачных попыток проходит без паузы
+	BackoffAfter int
+	// После стольких неудачных попыток ключ блокируется, 0 - не блокировать
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+type Config struct {
+	Enabled bool
+	Email   Rules
+	IP      Rules
+	// Пауза после BackoffAfter попыток, дальше удваивается до MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Попытки старше Window забываются
+	Window time.Duration
+	// Приставка ключей: лимитеры с разными приставками не мешают друг другу в одном хранилище
+	KeyPrefix string
+}
+
+// Error is returned when login is not allowed yet
+type Error struct {
+	RetryAfter time.Duration
+	Locked     bool // заблокирован, а не просто пауза
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLimited, e.RetryAfter)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrLimited
+}
+
+type Limiter struct {
+	log     *slog.Logger
+	storage Storage
+	cfg     Config
+	now     func() time.Time
+}
+
+func New(
+	log *slog.Logger,
+	storage Storage,
+	cfg Config,
+) *Limiter {
+	return &Limiter{
+		log:     log,
+		storage: storage,
+		cfg:     cfg,
+		now:     time.Now,
+	}
+}
+
+// Allow returns *Error if login for the email or from the ip must wait.
+// Пустой ip не проверяется
+func (l *Limiter) Allow(ctx context.Context, email string, ip string) error {
+	const op = "limiter.Allow"
+
+	if !l.cfg.Enabled {
+		return nil
+	}
+
+	now := l.now()
+	var limited *Error
+	for _, k := range l.keys(email, ip) {
+		attempts, err := l.storage.LoginAttempts(ctx, k.key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		blocked := l.check(attempts, k.rules, now)
+		if blocked != nil && (limited == nil || blocked.RetryAfter > limited.RetryAfter) {
+			limited = blocked
+		}
+	}
+
+	if limited != nil {
+		return limited
+	}
+	return nil
+}
+
+// Failure counts failed login and locks keys that reached the limit
+func (l *Limiter) Failure(ctx context.Context, email string, ip string) error {
+	const op = "limiter.Failure"
+
+	if !l.cfg.Enabled {
+		return nil
+	}
+
+	now := l.now()
+	for _, k := range l.keys(email, ip) {
+		attempts, err := l.storage.AddLoginFailure(ctx, k.key, now, l.cfg.Window)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if k.rules.LockoutAfter > 0 && attempts.Failures >= k.rules.LockoutAfter {
+			until := now.Add(k.rules.LockoutDuration)
+			if err := l.storage.LockLogin(ctx, k.key, until); err != nil {
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			slogger.FromContext(ctx, l.log).Warn("login locked",
+				slog.String("key", k.key),
+				slog.Int("failures", attempts.Failures),
+				slog.Time("until", until),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Success forgets failures of the email. Счётчик IP не сбрасывается:
+// иначе вход в свой аккаунт позволял бы перебирать чужие
+func (l *Limiter) Success(ctx context.Context, email string) error {
+	const op = "limiter.Success"
+
+	if !l.cfg.Enabled {
+		return nil
+	}
+
+	if err := l.storage.ResetLoginAttempts(ctx, l.cfg.KeyPrefix+emailKey(email)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Unlock removes lock and failures of the email and the ip. Пустые значения пропускаются
+func (l *Limiter) Unlock(ctx context.Context, email string, ip string) error {
+	const op = "limiter.Unlock"
+
+	for _, k := range l.keys(email, ip) {
+		if err := l.storage.ResetLoginAttempts(ctx, k.key); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// check returns *Error if the key is locked or the backoff pause is not over
+func (l *Limiter) check(attempts models.LoginAttempts, rules Rules, now time.Time) *Error {
+	if !attempts.ExpiresAt.After(now) {
+		return nil
+	}
+
+	if attempts.LockedUntil.After(now) {
+		return &Error{RetryAfter: attempts.LockedUntil.Sub(now), Locked: true}
+	}
+
+	if attempts.Failures == 0 || attempts.Failures < rules.BackoffAfter {
+		return nil
+	}
+
+	next := attempts.LastFailure.Add(l.delay(attempts.Failures - rules.BackoffAfter))
+	if next.After(now) {
+		return &Error{RetryAfter: next.Sub(now)}
+	}
+	return nil
+}
+
+// delay returns BaseDelay * 2^n, but not more than MaxDelay
+func (l *Limiter) delay(n int) time.Duration {
+	delay := l.cfg.BaseDelay
+	for i := 0; i < n && delay < l.cfg.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, l.cfg.MaxDelay)
+}
+
+type limitKey struct {
+	key   string
+	rules Rules
+}
+
+func (l *Limiter) keys(email string, ip string) []limitKey {
+	keys := make([]limitKey, 0, 2)
+	if email != "" {
+		keys = append(keys, limitKey{key: l.cfg.KeyPrefix + emailKey(email), rules: l.cfg.Email})
+	}
+	if ip != "" {
+		keys = append(keys, limitKey{key: l.cfg.KeyPrefix + "ip:" + ip, rules: l.cfg.IP})
+	}
+	return keys
+}
+
+// emailKey - email без учёта регистра, иначе лимит обходится заменой букв
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,236 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+const (
+	testEmail = "user@example.com"
+	testIP    = "192.0.2.1"
+)
+
+var testConfig = Config{
+	Enabled:   true,
+	Email:     Rules{BackoffAfter: 2, LockoutAfter: 5, LockoutDuration: 15 * time.Minute},
+	IP:        Rules{BackoffAfter: 10, LockoutAfter: 0},
+	BaseDelay: time.Second,
+	MaxDelay:  4 * time.Second,
+	Window:    time.Hour,
+}
+
+// clock is a manual time source
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Add(d time.Duration) { c.now = c.now.Add(d) }
+
+func newLimiter(cfg Config) (*Limiter, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(slog.New(slog.NewTextHandler(io.Discard, nil)), NewMemoryStorage(), cfg)
+	l.now = c.Now
+	return l, c
+}
+
+// retryAfter returns pause required by Allow, 0 - allowed
+func retryAfter(t *testing.T, l *Limiter, email string, ip string) time.Duration {
+	t.Helper()
+
+	err := l.Allow(context.Background(), email, ip)
+	if err == nil {
+		return 0
+	}
+
+	var limitErr *Error
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimited) {
+		t.Fatalf("Allow: err = %v, want *Error", err)
+	}
+	return limitErr.RetryAfter
+}
+
+func fail(t *testing.T, l *Limiter, email string, ip string) {
+	t.Helper()
+
+	if err := l.Failure(context.Background(), email, ip); err != nil {
+		t.Fatalf("Failure: %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	l, c := newLimiter(testConfig)
+
+	// Первые BackoffAfter попыток без паузы
+	for i := 0; i < testConfig.Email.BackoffAfter; i++ {
+		if d := retryAfter(t, l, testEmail, testIP); d != 0 {
+			t.Fatalf("attempt %d: retry after %s, want allowed", i+1, d)
+		}
+		fail(t, l, testEmail, testIP)
+	}
+
+	// Дальше пауза удваивается
+	for _, want := range []time.Duration{time.Second, 2 * time.Second} {
+		if d := retryAfter(t, l, testEmail, testIP); d != want {
+			t.Fatalf("retry after %s, want %s", d, want)
+		}
+		c.Add(want - time.Millisecond)
+		if d := retryAfter(t, l, testEmail, testIP); d != time.Millisecond {
+			t.Fatalf("retry after %s, want 1ms", d)
+		}
+		c.Add(time.Millisecond)
+		if d := retryAfter(t, l, testEmail, testIP); d != 0 {
+			t.Fatalf("retry after %s, want allowed", d)
+		}
+		fail(t, l, testEmail, testIP)
+	}
+
+	// Другой email с того же IP не ждёт
+	if d := retryAfter(t, l, "other@example.com", testIP); d != 0 {
+		t.Errorf("other email: retry after %s, want allowed", d)
+	}
+}
+
+func TestMaxDelay(t *testing.T) {
+	cfg := testConfig
+	cfg.Email.LockoutAfter = 0
+	l, c := newLimiter(cfg)
+
+	for i := 0; i < 20; i++ {
+		c.Add(time.Minute)
+		fail(t, l, testEmail, "")
+	}
+
+	if d := retryAfter(t, l, testEmail, ""); d != cfg.MaxDelay {
+		t.Errorf("retry after %s, want %s", d, cfg.MaxDelay)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	l, c := newLimiter(testConfig)
+
+	for i := 0; i < testConfig.Email.LockoutAfter; i++ {
+		c.Add(time.Minute)
+		fail(t, l, testEmail, testIP)
+	}
+
+	err := l.Allow(context.Background(), testEmail, testIP)
+	var limitErr *Error
+	if !errors.As(err, &limitErr) || !limitErr.Locked || limitErr.RetryAfter != testConfig.Email.LockoutDuration {
+		t.Fatalf("Allow = %v, want lock for %s", err, testConfig.Email.LockoutDuration)
+	}
+
+	// После блокировки счётчик начинается заново
+	c.Add(testConfig.Email.LockoutDuration)
+	if d := retryAfter(t, l, testEmail, testIP); d != 0 {
+		t.Errorf("after lockout: retry after %s, want allowed", d)
+	}
+}
+
+func TestIPLimit(t *testing.T) {
+	l, c := newLimiter(testConfig)
+
+	// Перебор разных email с одного адреса
+	for i := 0; i < testConfig.IP.BackoffAfter; i++ {
+		c.Add(time.Minute)
+		fail(t, l, "", testIP)
+	}
+
+	if d := retryAfter(t, l, testEmail, testIP); d != time.Second {
+		t.Errorf("retry after %s, want 1s", d)
+	}
+	if d := retryAfter(t, l, testEmail, "198.51.100.1"); d != 0 {
+		t.Errorf("other ip: retry after %s, want allowed", d)
+	}
+}
+
+func TestSuccessResetsEmailOnly(t *testing.T) {
+	l, c := newLimiter(testConfig)
+
+	for i := 0; i < testConfig.IP.BackoffAfter; i++ {
+		c.Add(time.Minute)
+		fail(t, l, testEmail, testIP)
+		if err := l.Success(context.Background(), testEmail); err != nil {
+			t.Fatalf("Success: %v", err)
+		}
+	}
+
+	if d := retryAfter(t, l, testEmail, ""); d != 0 {
+		t.Errorf("email: retry after %s, want allowed", d)
+	}
+	if d := retryAfter(t, l, "", testIP); d == 0 {
+		t.Error("ip: allowed, want pause")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	l, c := newLimiter(testConfig)
+
+	for i := 0; i < testConfig.Email.LockoutAfter-1; i++ {
+		fail(t, l, testEmail, "")
+	}
+
+	// Старые попытки забываются
+	c.Add(testConfig.Window)
+	fail(t, l, testEmail, "")
+
+	if d := retryAfter(t, l, testEmail, ""); d != 0 {
+		t.Errorf("retry after %s, want allowed", d)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	l, _ := newLimiter(testConfig)
+
+	for i := 0; i < testConfig.Email.LockoutAfter; i++ {
+		fail(t, l, testEmail, testIP)
+	}
+	if d := retryAfter(t, l, testEmail, ""); d == 0 {
+		t.Fatal("allowed before unlock")
+	}
+
+	if err := l.Unlock(context.Background(), "USER@example.com", ""); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if d := retryAfter(t, l, testEmail, ""); d != 0 {
+		t.Errorf("retry after %s, want allowed", d)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	cfg := testConfig
+	cfg.Enabled = false
+	l, _ := newLimiter(cfg)
+
+	for i := 0; i < 100; i++ {
+		fail(t, l, testEmail, testIP)
+	}
+	if d := retryAfter(t, l, testEmail, testIP); d != 0 {
+		t.Errorf("retry after %s, want allowed", d)
+	}
+}
+
+// Лимитеры с разными приставками в одном хранилище считают попытки отдельно
+func TestKeyPrefix(t *testing.T) {
+	login, c := newLimiter(testConfig)
+
+	cfg := testConfig
+	cfg.KeyPrefix = "reset:"
+	reset := New(slog.New(slog.NewTextHandler(io.Discard, nil)), login.storage, cfg)
+	reset.now = c.Now
+
+	for i := 0; i < testConfig.Email.LockoutAfter; i++ {
+		fail(t, reset, testEmail, testIP)
+	}
+	if d := retryAfter(t, reset, testEmail, testIP); d == 0 {
+		t.Fatal("prefixed limiter allowed after lockout")
+	}
+	if d := retryAfter(t, login, testEmail, testIP); d != 0 {
+		t.Errorf("limiter without prefix: retry after %s, want allowed", d)
+	}
+}
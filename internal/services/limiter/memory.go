@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"context"
+	"grpc_service/internal/domain/models"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps attempts in the process. Подходит для одной реплики:
+// у каждой реплики свои счётчики, и они теряются при перезапуске
+type MemoryStorage struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+	// Размер, при котором в следующий раз удаляются истёкшие записи
+	sweepAt int
+}
+
+const minSweepSize = 1024
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		attempts: make(map[string]models.LoginAttempts),
+		sweepAt:  minSweepSize,
+	}
+}
+
+func (s *MemoryStorage) LoginAttempts(_ context.Context, key string) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return models.LoginAttempts{Key: key}, nil
+	}
+	return attempts, nil
+}
+
+func (s *MemoryStorage) AddLoginFailure(
+	_ context.Context,
+	key string,
+	at time.Time,
+	window time.Duration,
+) (models.LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok || !attempts.ExpiresAt.After(at) {
+		attempts = models.LoginAttempts{Key: key}
+	}
+	attempts.Failures++
+	attempts.LastFailure = at
+	if expiresAt := at.Add(window); expiresAt.After(attempts.ExpiresAt) {
+		attempts.ExpiresAt = expiresAt
+	}
+	s.attempts[key] = attempts
+
+	if len(s.attempts) >= s.sweepAt {
+		s.sweep(at)
+	}
+
+	return attempts, nil
+}
+
+func (s *MemoryStorage) LockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	attempts.Failures = 0
+	attempts.LockedUntil = until
+	if until.After(attempts.ExpiresAt) {
+		attempts.ExpiresAt = until
+	}
+	s.attempts[key] = attempts
+
+	return nil
+}
+
+func (s *MemoryStorage) ResetLoginAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// sweep deletes expired attempts. Вызывается, когда map выросла вдвое с прошлой чистки,
+// поэтому в среднем стоит O(1) на попытку
+func (s *MemoryStorage) sweep(now time.Time) {
+	for key, attempts := range s.attempts {
+		if !attempts.ExpiresAt.After(now) {
+			delete(s.attempts, key)
+		}
+	}
+	s.sweepAt = max(2*len(s.attempts), minSweepSize)
+}
@@ -0,0 +1,10 @@
+-- key: "email:<email>" или "ip:<ip>"
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_login_attempts_expires on login_attempts (expires_at);
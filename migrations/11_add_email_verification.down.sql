@@ -0,0 +1,2 @@
+ALTER TABLE apps DROP COLUMN IF EXISTS require_verified_email;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
@@ -0,0 +1,19 @@
+-- Хранится только хэш токена, строка удаляется при использовании
+CREATE TABLE IF NOT EXISTS password_reset_tokens
+(
+    token_hash BYTEA PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_password_reset_tokens_user on password_reset_tokens (user_id);
+CREATE INDEX IF NOT EXISTS index_password_reset_tokens_expires on password_reset_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_audit_events_user on audit_events (user_id, created_at);
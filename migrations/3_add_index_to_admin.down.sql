@@ -1 +1 @@
-DELETE INDEX IF NOT EXISTS index_is_admin on users (is_admin);
\ No newline at end of file
+DROP INDEX IF EXISTS index_is_admin;
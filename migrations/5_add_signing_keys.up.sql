@@ -0,0 +1,13 @@
+ALTER TABLE apps
+    ADD COLUMN signing_alg TEXT NOT NULL DEFAULT 'HS256';
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    kid TEXT PRIMARY KEY,
+    app_id INTEGER NOT NULL DEFAULT 0,
+    alg TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS index_signing_keys_app on signing_keys (app_id, alg);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS access_tokens
+(
+    jti TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_access_tokens_user on access_tokens (user_id, app_id);
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS index_revoked_tokens_expires on revoked_tokens (expires_at);
@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS roles
+(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+-- app_id = 0: роль действует во всех приложениях
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id INTEGER NOT NULL DEFAULT 0,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, app_id, role_id)
+);
+
+-- admin может всё
+INSERT INTO roles (name) VALUES ('admin') ON CONFLICT (name) DO NOTHING;
+INSERT INTO permissions (name) VALUES ('*') ON CONFLICT (name) DO NOTHING;
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT r.id, p.id FROM roles r, permissions p WHERE r.name = 'admin' AND p.name = '*'
+    ON CONFLICT DO NOTHING;
+
+-- is_admin переезжает в user_roles
+INSERT INTO user_roles (user_id, app_id, role_id)
+    SELECT u.id, 0, r.id FROM users u, roles r WHERE u.is_admin AND r.name = 'admin'
+    ON CONFLICT DO NOTHING;
+DROP INDEX IF EXISTS index_is_admin;
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,3 @@
+ALTER TABLE apps
+    DROP COLUMN token_roles,
+    DROP COLUMN token_scope;
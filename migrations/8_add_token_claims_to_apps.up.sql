@@ -0,0 +1,3 @@
+ALTER TABLE apps
+    ADD COLUMN token_roles BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN token_scope BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,4 @@
+-- id в 1_init объявлен без SERIAL, INSERT без id падал на NOT NULL
+CREATE SEQUENCE IF NOT EXISTS users_id_seq OWNED BY users.id;
+SELECT setval('users_id_seq', COALESCE((SELECT max(id) FROM users), 0) + 1, false);
+ALTER TABLE users ALTER COLUMN id SET DEFAULT nextval('users_id_seq');
@@ -0,0 +1,7 @@
+// Package openapiv2 embeds OpenAPI documents generated by protoc-gen-openapiv2
+package openapiv2
+
+import _ "embed"
+
+//go:embed sso/sso.swagger.json
+var SSO []byte